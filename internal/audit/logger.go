@@ -8,13 +8,14 @@ import (
 )
 
 type Entry struct {
-	Timestamp string `json:"timestamp"`
-	SessionID string `json:"session_id,omitempty"`
-	Client    string `json:"client_name,omitempty"`
-	Method    string `json:"method"`
-	Params    any    `json:"params,omitempty"`
-	Result    any    `json:"result,omitempty"`
-	Error     any    `json:"error,omitempty"`
+	Timestamp string   `json:"timestamp"`
+	SessionID string   `json:"session_id,omitempty"`
+	Client    string   `json:"client_name,omitempty"`
+	Method    string   `json:"method"`
+	Params    any      `json:"params,omitempty"`
+	Paths     []string `json:"paths,omitempty"`
+	Result    any      `json:"result,omitempty"`
+	Error     any      `json:"error,omitempty"`
 }
 
 type Logger struct {
@@ -2,16 +2,21 @@ package config
 
 import (
 	"errors"
+	"fmt"
 	"os"
 
 	"github.com/BurntSushi/toml"
 )
 
 type Config struct {
-	Server   ServerConfig   `toml:"server"`
-	Limits   LimitsConfig   `toml:"limits"`
-	Security SecurityConfig `toml:"security"`
-	Audit    AuditConfig    `toml:"audit"`
+	Server    ServerConfig    `toml:"server"`
+	Limits    LimitsConfig    `toml:"limits"`
+	Security  SecurityConfig  `toml:"security"`
+	Exec      ExecConfig      `toml:"exec"`
+	Audit     AuditConfig     `toml:"audit"`
+	Journal   JournalConfig   `toml:"journal"`
+	Git       GitConfig       `toml:"git"`
+	Workspace WorkspaceConfig `toml:"workspace"`
 }
 
 type ServerConfig struct {
@@ -29,15 +34,30 @@ type LimitsConfig struct {
 	MaxFileReadBytes      int `toml:"max_file_read_bytes"`
 	MaxProcessesPerSess   int `toml:"max_processes_per_session"`
 	MaxConcurrentSessions int `toml:"max_concurrent_sessions"`
+	MaxArchiveBytes       int `toml:"max_archive_bytes"`
+	MaxArchiveEntries     int `toml:"max_archive_entries"`
+	DownloadIdleTimeoutMs int `toml:"download_idle_timeout_ms"`
 }
 
 type SecurityConfig struct {
-	AllowShell  bool          `toml:"allow_shell"`
-	AllowedRoot []AllowedRoot `toml:"allowed_roots"`
+	AllowShell    bool          `toml:"allow_shell"`
+	AllowSymlinks bool          `toml:"allow_symlinks"`
+	AllowedRoot   []AllowedRoot `toml:"allowed_roots"`
+	Deny          []string      `toml:"deny"`
 }
 
 type AllowedRoot struct {
-	Path string `toml:"path"`
+	Path string   `toml:"path"`
+	Mode string   `toml:"mode"`
+	Deny []string `toml:"deny"`
+}
+
+type ExecConfig struct {
+	Shell              string   `toml:"shell"`
+	AllowedShells      []string `toml:"allowed_shells"`
+	ScriptInterpreters []string `toml:"script_interpreters"`
+	OutputBatchBytes   int      `toml:"output_batch_bytes"`
+	OutputFlushMs      int      `toml:"output_flush_ms"`
 }
 
 type AuditConfig struct {
@@ -45,6 +65,24 @@ type AuditConfig struct {
 	Path    string `toml:"path"`
 }
 
+type JournalConfig struct {
+	Enabled    bool  `toml:"enabled"`
+	MaxEntries int   `toml:"max_entries"`
+	MaxBytes   int64 `toml:"max_bytes"`
+}
+
+type GitConfig struct {
+	Binary     string `toml:"binary"`
+	MaxEntries int    `toml:"max_entries"`
+	MaxBytes   int64  `toml:"max_bytes"`
+}
+
+type WorkspaceConfig struct {
+	WorktreeRoot           string `toml:"worktree_root"`
+	BranchPrefix           string `toml:"branch_prefix"`
+	MaxWorktreesPerSession int    `toml:"max_worktrees_per_session"`
+}
+
 func Default() Config {
 	return Config{
 		Server: ServerConfig{
@@ -61,9 +99,33 @@ func Default() Config {
 			MaxFileReadBytes:      1048576,
 			MaxProcessesPerSess:   8,
 			MaxConcurrentSessions: 16,
+			MaxArchiveBytes:       1073741824,
+			MaxArchiveEntries:     100000,
+			DownloadIdleTimeoutMs: 60000,
 		},
 		Security: SecurityConfig{
-			AllowShell: true,
+			AllowShell:    true,
+			AllowSymlinks: true,
+		},
+		Exec: ExecConfig{
+			Shell:              "sh",
+			AllowedShells:      []string{"sh", "bash", "zsh"},
+			ScriptInterpreters: []string{},
+			OutputBatchBytes:   32768,
+			OutputFlushMs:      10,
+		},
+		Journal: JournalConfig{
+			MaxEntries: 100,
+			MaxBytes:   67108864,
+		},
+		Git: GitConfig{
+			Binary:     "git",
+			MaxEntries: 1000,
+			MaxBytes:   4194304,
+		},
+		Workspace: WorkspaceConfig{
+			BranchPrefix:           "rexd/",
+			MaxWorktreesPerSession: 4,
 		},
 	}
 }
@@ -82,6 +144,11 @@ func Load(path string) (Config, error) {
 	if _, err := toml.DecodeFile(path, &cfg); err != nil {
 		return Config{}, err
 	}
+	for _, r := range cfg.Security.AllowedRoot {
+		if r.Mode != "" && r.Mode != "ro" && r.Mode != "rw" {
+			return Config{}, fmt.Errorf("allowed root %s: mode must be \"ro\" or \"rw\", got %q", r.Path, r.Mode)
+		}
+	}
 	return cfg, nil
 }
 
@@ -2,6 +2,8 @@ package events
 
 import (
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/samiralibabic/rexd/internal/protocol"
 )
@@ -9,12 +11,26 @@ import (
 type Bus struct {
 	mu          sync.RWMutex
 	nextSubID   int
-	subscribers map[string]map[int]chan protocol.Notification
+	subscribers map[string]map[int]*subscriber
+	seq         map[string]*sessionSeq
+	dropped     atomic.Int64
+}
+
+type subscriber struct {
+	ch       chan protocol.Notification
+	gone     chan struct{}
+	goneOnce sync.Once
+}
+
+type sessionSeq struct {
+	mu   sync.Mutex
+	next int64
 }
 
 func NewBus() *Bus {
 	return &Bus{
-		subscribers: map[string]map[int]chan protocol.Notification{},
+		subscribers: map[string]map[int]*subscriber{},
+		seq:         map[string]*sessionSeq{},
 	}
 }
 
@@ -23,17 +39,20 @@ func (b *Bus) Subscribe(sessionID string) (chan protocol.Notification, func()) {
 	defer b.mu.Unlock()
 	b.nextSubID++
 	id := b.nextSubID
-	ch := make(chan protocol.Notification, 128)
+	sub := &subscriber{ch: make(chan protocol.Notification, 128), gone: make(chan struct{})}
 	if _, ok := b.subscribers[sessionID]; !ok {
-		b.subscribers[sessionID] = map[int]chan protocol.Notification{}
+		b.subscribers[sessionID] = map[int]*subscriber{}
 	}
-	b.subscribers[sessionID][id] = ch
-	return ch, func() {
+	b.subscribers[sessionID][id] = sub
+	return sub.ch, func() {
+		// Release any PublishWait blocked on this subscriber before taking
+		// the write lock it would otherwise hold off.
+		sub.goneOnce.Do(func() { close(sub.gone) })
 		b.mu.Lock()
 		defer b.mu.Unlock()
 		if sessSubs, ok := b.subscribers[sessionID]; ok {
-			if c, ok := sessSubs[id]; ok {
-				close(c)
+			if _, ok := sessSubs[id]; ok {
+				close(sub.ch)
 				delete(sessSubs, id)
 			}
 			if len(sessSubs) == 0 {
@@ -43,18 +62,80 @@ func (b *Bus) Subscribe(sessionID string) (chan protocol.Notification, func()) {
 	}
 }
 
-func (b *Bus) Publish(sessionID, method string, params any) {
+func (b *Bus) Publish(sessionID, method string, params map[string]any) {
+	b.publish(sessionID, method, params, func(sub *subscriber, evt protocol.Notification) bool {
+		select {
+		case sub.ch <- evt:
+			return true
+		default:
+			return false
+		}
+	})
+}
+
+// PublishWait is Publish for bulk streams such as fs.data: rather than
+// dropping the event when a subscriber's queue is full, it waits up to
+// timeout for room, or until done is closed. It reports whether every
+// subscriber received the event.
+func (b *Bus) PublishWait(sessionID, method string, params map[string]any, done <-chan struct{}, timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	return b.publish(sessionID, method, params, func(sub *subscriber, evt protocol.Notification) bool {
+		select {
+		case sub.ch <- evt:
+			return true
+		case <-sub.gone:
+			return false
+		case <-done:
+			return false
+		case <-timer.C:
+			return false
+		}
+	})
+}
+
+func (b *Bus) publish(sessionID, method string, params map[string]any, deliver func(*subscriber, protocol.Notification) bool) bool {
+	b.mu.RLock()
+	seq, ok := b.seq[sessionID]
+	if !ok {
+		b.mu.RUnlock()
+		b.mu.Lock()
+		if seq, ok = b.seq[sessionID]; !ok {
+			seq = &sessionSeq{}
+			b.seq[sessionID] = seq
+		}
+		b.mu.Unlock()
+		b.mu.RLock()
+	}
+	defer b.mu.RUnlock()
+	// The per-session lock keeps event_seq in delivery order without
+	// serializing publishers of other sessions.
+	seq.mu.Lock()
+	defer seq.mu.Unlock()
+	seq.next++
+	params["event_seq"] = seq.next
+	params["ts"] = time.Now().UTC().Format(time.RFC3339Nano)
 	evt := protocol.Notification{
 		JSONRPC: protocol.Version,
 		Method:  method,
 		Params:  params,
 	}
-	b.mu.RLock()
-	defer b.mu.RUnlock()
-	for _, ch := range b.subscribers[sessionID] {
-		select {
-		case ch <- evt:
-		default:
+	delivered := true
+	for _, sub := range b.subscribers[sessionID] {
+		if !deliver(sub, evt) {
+			b.dropped.Add(1)
+			delivered = false
 		}
 	}
+	return delivered
+}
+
+func (b *Bus) Dropped() int64 {
+	return b.dropped.Load()
+}
+
+func (b *Bus) Forget(sessionID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.seq, sessionID)
 }
@@ -2,6 +2,7 @@ package exec
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"errors"
 	"io"
@@ -9,6 +10,7 @@ import (
 	"sync"
 	"syscall"
 	"time"
+	"unicode/utf8"
 
 	"github.com/samiralibabic/rexd/internal/events"
 )
@@ -37,6 +39,7 @@ type RunningProcess struct {
 	TimedOut      bool
 	ExitCh        chan ProcessState
 	cancelTimeout context.CancelFunc
+	streams       sync.WaitGroup
 	mu            sync.Mutex
 }
 
@@ -52,16 +55,23 @@ func (p *RunningProcess) MarkTimedOut() {
 	p.TimedOut = true
 }
 
+type OutputBatching struct {
+	MaxBytes      int
+	FlushInterval time.Duration
+}
+
 type Manager struct {
 	mu        sync.RWMutex
 	processes map[string]*RunningProcess
 	bus       *events.Bus
+	batch     OutputBatching
 }
 
-func NewManager(bus *events.Bus) *Manager {
+func NewManager(bus *events.Bus, batch OutputBatching) *Manager {
 	return &Manager{
 		processes: map[string]*RunningProcess{},
 		bus:       bus,
+		batch:     batch,
 	}
 }
 
@@ -100,47 +110,155 @@ func (m *Manager) Kill(id, sig string) error {
 }
 
 func (m *Manager) WireStreams(p *RunningProcess, stdout, stderr io.Reader) {
-	go m.pipeStream(p, stdout, "exec.stdout")
-	go m.pipeStream(p, stderr, "exec.stderr")
+	for _, s := range []struct {
+		r      io.Reader
+		method string
+	}{{stdout, "exec.stdout"}, {stderr, "exec.stderr"}} {
+		if s.r == nil {
+			continue
+		}
+		p.streams.Add(1)
+		go func(r io.Reader, method string) {
+			defer p.streams.Done()
+			m.pipeStream(p, r, method)
+		}(s.r, s.method)
+	}
+}
+
+func (p *RunningProcess) WaitStreams(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		p.streams.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
 }
 
 func (m *Manager) pipeStream(p *RunningProcess, r io.Reader, method string) {
+	if m.batch.MaxBytes <= 0 {
+		m.pipeLines(p, r, method)
+		return
+	}
+	chunks := make(chan []byte, 16)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		defer close(chunks)
+		for {
+			buf := make([]byte, 32*1024)
+			n, err := r.Read(buf)
+			if n > 0 {
+				select {
+				case chunks <- buf[:n]:
+				case <-done:
+					_, _ = io.Copy(io.Discard, r)
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	var pending []byte
+	var timer *time.Timer
+	var timerC <-chan time.Time
+	flush := func(force, eof bool) bool {
+		for len(pending) > 0 && (force || len(pending) >= m.batch.MaxBytes) {
+			cut := min(len(pending), m.batch.MaxBytes)
+			if i := bytes.LastIndexByte(pending[:cut], '\n'); i >= 0 {
+				cut = i + 1
+			} else if !eof {
+				cut = runeBoundary(pending, cut)
+				if cut == 0 {
+					return true
+				}
+			}
+			if !m.emit(p, method, pending[:cut]) {
+				return false
+			}
+			pending = pending[cut:]
+		}
+		return true
+	}
+	for {
+		select {
+		case chunk, ok := <-chunks:
+			if !ok {
+				flush(true, true)
+				return
+			}
+			pending = append(pending, chunk...)
+			if !flush(m.batch.FlushInterval <= 0, false) {
+				return
+			}
+			if len(pending) > 0 && timerC == nil {
+				timer = time.NewTimer(m.batch.FlushInterval)
+				timerC = timer.C
+			}
+		case <-timerC:
+			timerC = nil
+			if !flush(true, false) {
+				return
+			}
+		}
+		if len(pending) == 0 && timerC != nil {
+			timer.Stop()
+			timerC = nil
+		}
+	}
+}
+
+func (m *Manager) pipeLines(p *RunningProcess, r io.Reader, method string) {
 	scanner := bufio.NewScanner(r)
 	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
 	for scanner.Scan() {
-		line := scanner.Text() + "\n"
-		p.mu.Lock()
-		if method == "exec.stdout" {
-			p.StdoutSeq++
-			p.BytesStdout += int64(len(line))
-		} else {
-			p.StderrSeq++
-			p.BytesStderr += int64(len(line))
-		}
-		seq := p.StdoutSeq
-		if method == "exec.stderr" {
-			seq = p.StderrSeq
-		}
-		total := p.BytesStdout + p.BytesStderr
-		maxOutput := p.MaxOutput
-		p.mu.Unlock()
-		if maxOutput > 0 && total > maxOutput {
-			_ = p.Cmd.Process.Kill()
-			p.mu.Lock()
-			p.TimedOut = true
-			p.mu.Unlock()
+		if !m.emit(p, method, append(scanner.Bytes(), '\n')) {
 			return
 		}
-		m.bus.Publish(p.SessionID, method, map[string]any{
-			"session_id": p.SessionID,
-			"process_id": p.ID,
-			"seq":        seq,
-			"data":       line,
-			"encoding":   "utf8",
-		})
 	}
 }
 
+func (m *Manager) emit(p *RunningProcess, method string, data []byte) bool {
+	p.mu.Lock()
+	if method == "exec.stdout" {
+		p.StdoutSeq++
+		p.BytesStdout += int64(len(data))
+	} else {
+		p.StderrSeq++
+		p.BytesStderr += int64(len(data))
+	}
+	seq := p.StdoutSeq
+	if method == "exec.stderr" {
+		seq = p.StderrSeq
+	}
+	total := p.BytesStdout + p.BytesStderr
+	maxOutput := p.MaxOutput
+	p.mu.Unlock()
+	if maxOutput > 0 && total > maxOutput {
+		_ = p.Cmd.Process.Kill()
+		p.mu.Lock()
+		p.TimedOut = true
+		p.mu.Unlock()
+		return false
+	}
+	m.bus.Publish(p.SessionID, method, map[string]any{
+		"session_id": p.SessionID,
+		"process_id": p.ID,
+		"seq":        seq,
+		"data":       string(data),
+		"encoding":   "utf8",
+		"lines":      bytes.Count(data, []byte{'\n'}),
+	})
+	return true
+}
+
 func (m *Manager) Wait(p *RunningProcess, waitErr error) ProcessState {
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -171,3 +289,25 @@ func (m *Manager) Wait(p *RunningProcess, waitErr error) ProcessState {
 	}
 	return state
 }
+
+func runeBoundary(b []byte, n int) int {
+	for i := n; i > 0 && i > n-utf8.UTFMax; i-- {
+		if i < len(b) {
+			if utf8.RuneStart(b[i]) {
+				return i
+			}
+			continue
+		}
+		start := i - 1
+		for start > 0 && i-start < utf8.UTFMax && !utf8.RuneStart(b[start]) {
+			start--
+		}
+		if utf8.FullRune(b[start:i]) {
+			return i
+		}
+	}
+	if n < utf8.UTFMax {
+		return 0
+	}
+	return n
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"sort"
 	"sync"
 	"syscall"
 	"time"
@@ -15,15 +16,87 @@ import (
 	"github.com/samiralibabic/rexd/internal/events"
 )
 
+var (
+	ErrPTYNotAttached = errors.New("session is not attached to pty")
+	ErrPTYReadOnly    = errors.New("pty is read-only for this session")
+	ErrPTYNotOwner    = errors.New("only the pty owner may do this")
+	ErrPTYNeedsGrant  = errors.New("pty access must be granted by the pty owner; use pty.grant")
+)
+
+const (
+	PTYRoleOwner  = "owner"
+	PTYRoleWriter = "writer"
+	PTYRoleViewer = "viewer"
+)
+
+type PTYParticipant struct {
+	SessionID  string `json:"session_id"`
+	Role       string `json:"role"`
+	AttachedAt string `json:"attached_at"`
+}
+
 type PTYSession struct {
-	ID        string
-	ProcessID string
-	SessionID string
-	Cmd       *exec.Cmd
-	File      *os.File
-	Cols      uint16
-	Rows      uint16
-	StartedAt time.Time
+	ID           string
+	ProcessID    string
+	SessionID    string
+	Cmd          *exec.Cmd
+	File         *os.File
+	Cols         uint16
+	Rows         uint16
+	StartedAt    time.Time
+	mu           sync.RWMutex
+	participants map[string]*PTYParticipant
+	grants       map[string]string
+}
+
+func (ps *PTYSession) Role(sessionID string) (string, error) {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	p, ok := ps.participants[sessionID]
+	if !ok {
+		return "", ErrPTYNotAttached
+	}
+	return p.Role, nil
+}
+
+func (ps *PTYSession) Participants() []PTYParticipant {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	out := make([]PTYParticipant, 0, len(ps.participants))
+	for _, p := range ps.participants {
+		out = append(out, *p)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].AttachedAt != out[j].AttachedAt {
+			return out[i].AttachedAt < out[j].AttachedAt
+		}
+		return out[i].SessionID < out[j].SessionID
+	})
+	return out
+}
+
+func (ps *PTYSession) sessionIDs() []string {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	ids := make([]string, 0, len(ps.participants))
+	for id := range ps.participants {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func (ps *PTYSession) setRole(sessionID, role string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if p, ok := ps.participants[sessionID]; ok {
+		p.Role = role
+		return
+	}
+	ps.participants[sessionID] = &PTYParticipant{
+		SessionID:  sessionID,
+		Role:       role,
+		AttachedAt: time.Now().UTC().Format(time.RFC3339Nano),
+	}
 }
 
 type PTYManager struct {
@@ -39,13 +112,13 @@ func NewPTYManager(bus *events.Bus) *PTYManager {
 	}
 }
 
-func (m *PTYManager) Open(ctx context.Context, sessionID string, argv []string, shell bool, command, cwd string, env map[string]string, cols, rows uint16) (*PTYSession, error) {
+func (m *PTYManager) Open(ctx context.Context, sessionID string, argv []string, shell bool, interpreter, command, cwd string, env map[string]string, cols, rows uint16) (*PTYSession, error) {
 	if !shell && len(argv) == 0 {
 		return nil, errors.New("argv is required")
 	}
 	var cmd *exec.Cmd
 	if shell {
-		cmd = exec.CommandContext(ctx, "sh", "-lc", command)
+		cmd = exec.CommandContext(ctx, interpreter, "-lc", command)
 	} else {
 		cmd = exec.CommandContext(ctx, argv[0], argv[1:]...)
 	}
@@ -66,15 +139,18 @@ func (m *PTYManager) Open(ctx context.Context, sessionID string, argv []string,
 		return nil, err
 	}
 	ps := &PTYSession{
-		ID:        fmt.Sprintf("pty_%d", time.Now().UnixNano()),
-		ProcessID: fmt.Sprintf("p_%d", time.Now().UnixNano()),
-		SessionID: sessionID,
-		Cmd:       cmd,
-		File:      ptmx,
-		Cols:      cols,
-		Rows:      rows,
-		StartedAt: time.Now().UTC(),
+		ID:           fmt.Sprintf("pty_%d", time.Now().UnixNano()),
+		ProcessID:    fmt.Sprintf("p_%d", time.Now().UnixNano()),
+		SessionID:    sessionID,
+		Cmd:          cmd,
+		File:         ptmx,
+		Cols:         cols,
+		Rows:         rows,
+		StartedAt:    time.Now().UTC(),
+		participants: map[string]*PTYParticipant{},
+		grants:       map[string]string{},
 	}
+	ps.setRole(sessionID, PTYRoleOwner)
 	m.mu.Lock()
 	m.ptys[ps.ID] = ps
 	m.mu.Unlock()
@@ -89,14 +165,17 @@ func (m *PTYManager) readOutput(ps *PTYSession) {
 	seq := 0
 	for scanner.Scan() {
 		seq++
-		m.bus.Publish(ps.SessionID, "pty.output", map[string]any{
-			"session_id": ps.SessionID,
-			"pty_id":     ps.ID,
-			"process_id": ps.ProcessID,
-			"seq":        seq,
-			"data":       scanner.Text() + "\n",
-			"encoding":   "utf8",
-		})
+		data := scanner.Text() + "\n"
+		for _, sessionID := range ps.sessionIDs() {
+			m.bus.Publish(sessionID, "pty.output", map[string]any{
+				"session_id": sessionID,
+				"pty_id":     ps.ID,
+				"process_id": ps.ProcessID,
+				"seq":        seq,
+				"data":       data,
+				"encoding":   "utf8",
+			})
+		}
 	}
 }
 
@@ -115,14 +194,16 @@ func (m *PTYManager) wait(ps *PTYSession) {
 			}
 		}
 	}
-	m.bus.Publish(ps.SessionID, "pty.exit", map[string]any{
-		"session_id":  ps.SessionID,
-		"pty_id":      ps.ID,
-		"process_id":  ps.ProcessID,
-		"exit_code":   exitCode,
-		"signal":      sig,
-		"duration_ms": time.Since(ps.StartedAt).Milliseconds(),
-	})
+	for _, sessionID := range ps.sessionIDs() {
+		m.bus.Publish(sessionID, "pty.exit", map[string]any{
+			"session_id":  sessionID,
+			"pty_id":      ps.ID,
+			"process_id":  ps.ProcessID,
+			"exit_code":   exitCode,
+			"signal":      sig,
+			"duration_ms": time.Since(ps.StartedAt).Milliseconds(),
+		})
+	}
 	_ = ps.File.Close()
 	m.mu.Lock()
 	delete(m.ptys, ps.ID)
@@ -139,27 +220,215 @@ func (m *PTYManager) Get(id string) (*PTYSession, error) {
 	return ps, nil
 }
 
-func (m *PTYManager) Input(id, data string) (int, error) {
+func (m *PTYManager) Attach(id, sessionID, role string) (*PTYSession, error) {
+	ps, err := m.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if role == "" {
+		role = PTYRoleViewer
+	}
+	if role != PTYRoleViewer && role != PTYRoleWriter {
+		return nil, fmt.Errorf("unsupported pty role %q", role)
+	}
+	ps.mu.Lock()
+	if p, ok := ps.participants[sessionID]; ok && p.Role == PTYRoleOwner {
+		ps.mu.Unlock()
+		return nil, errors.New("pty owner cannot change its own role; use pty.handoff")
+	}
+	granted, ok := ps.grants[sessionID]
+	if !ok || (role == PTYRoleWriter && granted != PTYRoleWriter) {
+		ps.mu.Unlock()
+		return nil, ErrPTYNeedsGrant
+	}
+	ps.mu.Unlock()
+	ps.setRole(sessionID, role)
+	m.publishParticipants(ps)
+	return ps, nil
+}
+
+func (m *PTYManager) Grant(id, ownerSessionID, toSessionID, role string) (*PTYSession, error) {
+	ps, err := m.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if role != "" && role != PTYRoleViewer && role != PTYRoleWriter {
+		return nil, fmt.Errorf("unsupported pty role %q", role)
+	}
+	ps.mu.Lock()
+	owner, ok := ps.participants[ownerSessionID]
+	if !ok {
+		ps.mu.Unlock()
+		return nil, ErrPTYNotAttached
+	}
+	if owner.Role != PTYRoleOwner {
+		ps.mu.Unlock()
+		return nil, ErrPTYNotOwner
+	}
+	if ownerSessionID == toSessionID {
+		ps.mu.Unlock()
+		return nil, errors.New("pty owner cannot change its own role; use pty.handoff")
+	}
+	to, attached := ps.participants[toSessionID]
+	switch {
+	case role == "":
+		delete(ps.grants, toSessionID)
+		delete(ps.participants, toSessionID)
+	case attached:
+		ps.grants[toSessionID] = role
+		to.Role = role
+	default:
+		ps.grants[toSessionID] = role
+	}
+	ps.mu.Unlock()
+	m.publishParticipants(ps)
+	return ps, nil
+}
+
+func (m *PTYManager) Detach(id, sessionID string) error {
 	ps, err := m.Get(id)
+	if err != nil {
+		return err
+	}
+	role, err := ps.Role(sessionID)
+	if err != nil {
+		return err
+	}
+	if role == PTYRoleOwner {
+		return errors.New("pty owner cannot detach; use pty.handoff or pty.close")
+	}
+	ps.mu.Lock()
+	delete(ps.participants, sessionID)
+	ps.mu.Unlock()
+	m.publishParticipants(ps)
+	return nil
+}
+
+func (m *PTYManager) Handoff(id, fromSessionID, toSessionID, fromRole string) (*PTYSession, error) {
+	ps, err := m.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if fromRole == "" {
+		fromRole = PTYRoleViewer
+	}
+	if fromRole != PTYRoleViewer && fromRole != PTYRoleWriter {
+		return nil, fmt.Errorf("unsupported pty role %q", fromRole)
+	}
+	ps.mu.Lock()
+	from, ok := ps.participants[fromSessionID]
+	if !ok {
+		ps.mu.Unlock()
+		return nil, ErrPTYNotAttached
+	}
+	if from.Role != PTYRoleOwner {
+		ps.mu.Unlock()
+		return nil, ErrPTYNotOwner
+	}
+	to, ok := ps.participants[toSessionID]
+	if !ok {
+		ps.mu.Unlock()
+		return nil, fmt.Errorf("target session %s is not attached to pty", toSessionID)
+	}
+	if fromSessionID != toSessionID {
+		to.Role = PTYRoleOwner
+		from.Role = fromRole
+		ps.SessionID = toSessionID
+		delete(ps.grants, toSessionID)
+		ps.grants[fromSessionID] = fromRole
+	}
+	ps.mu.Unlock()
+	m.publishParticipants(ps)
+	return ps, nil
+}
+
+func (m *PTYManager) publishParticipants(ps *PTYSession) {
+	participants := ps.Participants()
+	for _, p := range participants {
+		m.bus.Publish(p.SessionID, "pty.participants", map[string]any{
+			"session_id":   p.SessionID,
+			"pty_id":       ps.ID,
+			"owner":        ps.Owner(),
+			"participants": participants,
+		})
+	}
+}
+
+func (ps *PTYSession) Owner() string {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	return ps.SessionID
+}
+
+func (m *PTYManager) Input(id, sessionID, data string) (int, error) {
+	ps, err := m.Get(id)
+	if err != nil {
+		return 0, err
+	}
+	role, err := ps.Role(sessionID)
 	if err != nil {
 		return 0, err
 	}
+	if role == PTYRoleViewer {
+		return 0, ErrPTYReadOnly
+	}
 	return ps.File.Write([]byte(data))
 }
 
-func (m *PTYManager) Resize(id string, cols, rows uint16) error {
+func (m *PTYManager) Resize(id, sessionID string, cols, rows uint16) error {
 	ps, err := m.Get(id)
 	if err != nil {
 		return err
 	}
+	role, err := ps.Role(sessionID)
+	if err != nil {
+		return err
+	}
+	if role == PTYRoleViewer {
+		return ErrPTYReadOnly
+	}
 	return pty.Setsize(ps.File, &pty.Winsize{Cols: cols, Rows: rows})
 }
 
-func (m *PTYManager) Close(id string) error {
+func (m *PTYManager) Close(id, sessionID string) error {
 	ps, err := m.Get(id)
 	if err != nil {
 		return err
 	}
+	role, err := ps.Role(sessionID)
+	if err != nil {
+		return err
+	}
+	if role != PTYRoleOwner {
+		return ErrPTYNotOwner
+	}
 	_ = ps.Cmd.Process.Kill()
-	return ps.File.Close()
+	if err := ps.File.Close(); err != nil && !errors.Is(err, os.ErrClosed) {
+		return err
+	}
+	return nil
+}
+
+func (m *PTYManager) CloseSession(sessionID string) {
+	m.mu.RLock()
+	ptys := make([]*PTYSession, 0, len(m.ptys))
+	for _, ps := range m.ptys {
+		ptys = append(ptys, ps)
+	}
+	m.mu.RUnlock()
+	for _, ps := range ptys {
+		ps.mu.Lock()
+		p, attached := ps.participants[sessionID]
+		delete(ps.participants, sessionID)
+		delete(ps.grants, sessionID)
+		ps.mu.Unlock()
+		if !attached {
+			continue
+		}
+		if p.Role == PTYRoleOwner {
+			_ = ps.Cmd.Process.Kill()
+			continue
+		}
+		m.publishParticipants(ps)
+	}
 }
@@ -0,0 +1,412 @@
+package exec
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var ErrShellClosed = errors.New("shell has exited")
+
+type ShellExitError struct {
+	Result ShellResult
+}
+
+func (e *ShellExitError) Error() string {
+	if e.Result.ExitCode != nil {
+		return fmt.Sprintf("shell exited with code %d while running the command", *e.Result.ExitCode)
+	}
+	return "shell exited while running the command"
+}
+
+func (e *ShellExitError) Unwrap() error {
+	return ErrShellClosed
+}
+
+func (e *ShellExitError) ErrorData() any {
+	return e.Result
+}
+
+type ShellResult struct {
+	Stdout     string            `json:"stdout"`
+	Stderr     string            `json:"stderr"`
+	ExitCode   *int              `json:"exit_code"`
+	Cwd        string            `json:"cwd,omitempty"`
+	Env        map[string]string `json:"env,omitempty"`
+	DurationMS int64             `json:"duration_ms"`
+	TimedOut   bool              `json:"timed_out"`
+	Truncated  bool              `json:"truncated"`
+	Exited     bool              `json:"exited"`
+}
+
+type ShellSession struct {
+	ID          string
+	SessionID   string
+	Interpreter string
+	Cmd         *exec.Cmd
+	StartedAt   time.Time
+	stdin       io.WriteCloser
+	stdout      *shellStream
+	stderr      *shellStream
+	done        chan struct{}
+	runMu       sync.Mutex
+	env         map[string]string
+	exported    map[string]string
+}
+
+type ShellManager struct {
+	mu     sync.RWMutex
+	shells map[string]*ShellSession
+}
+
+func NewShellManager() *ShellManager {
+	return &ShellManager{shells: map[string]*ShellSession{}}
+}
+
+func (m *ShellManager) Open(sessionID, interpreter, cwd string, env map[string]string, login bool, maxOutput int) (*ShellSession, error) {
+	args := []string{}
+	if login {
+		args = append(args, "-l")
+	}
+	cmd := exec.Command(interpreter, args...)
+	cmd.Dir = cwd
+	cmd.Env = os.Environ()
+	for k, v := range env {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	sh := &ShellSession{
+		ID:          fmt.Sprintf("sh_%d", time.Now().UnixNano()),
+		SessionID:   sessionID,
+		Interpreter: interpreter,
+		Cmd:         cmd,
+		StartedAt:   time.Now().UTC(),
+		stdin:       stdin,
+		stdout:      newShellStream(stdout, maxOutput),
+		stderr:      newShellStream(stderr, maxOutput),
+		done:        make(chan struct{}),
+		env:         parseEnv([]byte(strings.Join(cmd.Env, "\x00"))),
+		exported:    map[string]string{},
+	}
+	for k, v := range env {
+		sh.exported[k] = v
+	}
+	go func() {
+		sh.stdout.wait()
+		sh.stderr.wait()
+		_ = cmd.Wait()
+		close(sh.done)
+		m.mu.Lock()
+		delete(m.shells, sh.ID)
+		m.mu.Unlock()
+	}()
+	m.mu.Lock()
+	m.shells[sh.ID] = sh
+	m.mu.Unlock()
+	return sh, nil
+}
+
+func (m *ShellManager) Get(id, sessionID string) (*ShellSession, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	sh, ok := m.shells[id]
+	if !ok || sh.SessionID != sessionID {
+		return nil, errors.New("shell not found")
+	}
+	return sh, nil
+}
+
+func (m *ShellManager) Close(id, sessionID string) error {
+	sh, err := m.Get(id, sessionID)
+	if err != nil {
+		return err
+	}
+	sh.kill()
+	<-sh.done
+	return nil
+}
+
+func (m *ShellManager) CloseSession(sessionID string) {
+	m.mu.RLock()
+	closing := []*ShellSession{}
+	for _, sh := range m.shells {
+		if sh.SessionID == sessionID {
+			closing = append(closing, sh)
+		}
+	}
+	m.mu.RUnlock()
+	for _, sh := range closing {
+		sh.kill()
+		<-sh.done
+	}
+}
+
+func (sh *ShellSession) Done() <-chan struct{} {
+	return sh.done
+}
+
+func (sh *ShellSession) kill() {
+	_ = sh.stdin.Close()
+	if sh.Cmd.Process != nil {
+		_ = syscall.Kill(-sh.Cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
+
+func (sh *ShellSession) Run(command string, timeout time.Duration, maxOutput int) (ShellResult, error) {
+	sh.runMu.Lock()
+	defer sh.runMu.Unlock()
+	select {
+	case <-sh.done:
+		return ShellResult{}, ErrShellClosed
+	default:
+	}
+
+	marker := "__REXD_" + randomToken()
+	script := fmt.Sprintf("eval %s </dev/null\n"+
+		"__rexd_rc=$?\n"+
+		"printf '\\n%%s\\n' '%s' >&2\n"+
+		"printf '\\n%%s:%%d:%%s\\n' '%s' \"$__rexd_rc\" \"$PWD\"\n"+
+		"env -0 2>/dev/null || env\n"+
+		"printf '%%s\\n' '%s:END'\n",
+		shellQuote(command), marker, marker, marker)
+
+	start := time.Now()
+	sh.stdout.reset(maxOutput)
+	sh.stderr.reset(maxOutput)
+	if _, err := io.WriteString(sh.stdin, script); err != nil {
+		return ShellResult{}, ErrShellClosed
+	}
+
+	stdoutEnd := []byte(marker + ":END\n")
+	stderrEnd := []byte("\n" + marker + "\n")
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	result := ShellResult{}
+	for {
+		outDone := sh.stdout.contains(stdoutEnd)
+		errDone := sh.stderr.contains(stderrEnd)
+		if outDone && errDone {
+			break
+		}
+		if sh.stdout.closed() && sh.stderr.closed() {
+			<-sh.done
+			result.Exited = true
+			break
+		}
+		select {
+		case <-sh.stdout.notify:
+		case <-sh.stderr.notify:
+		case <-deadline.C:
+			sh.kill()
+			<-sh.done
+			result.TimedOut = true
+			result.Exited = true
+		}
+		if result.TimedOut {
+			break
+		}
+	}
+	result.DurationMS = time.Since(start).Milliseconds()
+
+	stdout, outTruncated := sh.stdout.take()
+	stderr, errTruncated := sh.stderr.take()
+	result.Truncated = outTruncated || errTruncated
+	if result.Exited {
+		result.Stdout = string(stdout)
+		result.Stderr = string(stderr)
+		if result.TimedOut {
+			return result, nil
+		}
+		if st := sh.Cmd.ProcessState; st != nil {
+			code := st.ExitCode()
+			result.ExitCode = &code
+		}
+		return result, &ShellExitError{Result: result}
+	}
+
+	if i := bytes.Index(stderr, stderrEnd); i >= 0 {
+		stderr = stderr[:i]
+	}
+	result.Stderr = string(stderr)
+
+	meta := []byte("\n" + marker + ":")
+	i := bytes.Index(stdout, meta)
+	if i < 0 {
+		return result, errors.New("shell output is missing its result marker")
+	}
+	result.Stdout = string(stdout[:i])
+	rest := stdout[i+len(meta):]
+	nl := bytes.IndexByte(rest, '\n')
+	if nl < 0 {
+		return result, errors.New("shell output is missing its result marker")
+	}
+	codeText, cwd, _ := strings.Cut(string(rest[:nl]), ":")
+	if code, err := strconv.Atoi(codeText); err == nil {
+		result.ExitCode = &code
+	}
+	result.Cwd = cwd
+	envBlock := rest[nl+1:]
+	if j := bytes.Index(envBlock, stdoutEnd); j >= 0 {
+		envBlock = envBlock[:j]
+	}
+	result.Env = sh.syncEnv(parseEnv(envBlock))
+	return result, nil
+}
+
+var shellManagedEnv = map[string]bool{"PWD": true, "OLDPWD": true, "SHLVL": true, "_": true}
+
+func (sh *ShellSession) syncEnv(env map[string]string) map[string]string {
+	for k, v := range env {
+		if shellManagedEnv[k] {
+			continue
+		}
+		if old, ok := sh.env[k]; !ok || old != v {
+			sh.exported[k] = v
+		}
+	}
+	for k := range sh.exported {
+		if _, ok := env[k]; !ok {
+			delete(sh.exported, k)
+		}
+	}
+	sh.env = env
+	out := make(map[string]string, len(sh.exported))
+	for k, v := range sh.exported {
+		out[k] = v
+	}
+	return out
+}
+
+func parseEnv(block []byte) map[string]string {
+	sep := byte('\n')
+	if bytes.IndexByte(block, 0) >= 0 {
+		sep = 0
+	}
+	env := map[string]string{}
+	for _, entry := range bytes.Split(block, []byte{sep}) {
+		k, v, ok := strings.Cut(string(entry), "=")
+		if !ok || k == "" || strings.HasPrefix(k, "__rexd_") {
+			continue
+		}
+		env[k] = v
+	}
+	return env
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func randomToken() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+const shellTailWindow = 64 * 1024
+
+type shellStream struct {
+	mu        sync.Mutex
+	buf       []byte
+	limit     int
+	truncated bool
+	eof       bool
+	notify    chan struct{}
+	finished  chan struct{}
+}
+
+func newShellStream(r io.Reader, limit int) *shellStream {
+	s := &shellStream{limit: limit, notify: make(chan struct{}, 1), finished: make(chan struct{})}
+	go s.read(r)
+	return s
+}
+
+func (s *shellStream) read(r io.Reader) {
+	defer close(s.finished)
+	chunk := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(chunk)
+		if n > 0 {
+			s.mu.Lock()
+			s.buf = append(s.buf, chunk[:n]...)
+			if s.limit > 0 && len(s.buf) > s.limit+shellTailWindow {
+				tail := s.buf[len(s.buf)-shellTailWindow:]
+				s.buf = append(s.buf[:s.limit], tail...)
+				s.truncated = true
+			}
+			s.mu.Unlock()
+			s.signal()
+		}
+		if err != nil {
+			s.mu.Lock()
+			s.eof = true
+			s.mu.Unlock()
+			s.signal()
+			return
+		}
+	}
+}
+
+func (s *shellStream) signal() {
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (s *shellStream) wait() {
+	<-s.finished
+}
+
+func (s *shellStream) reset(limit int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buf = s.buf[:0]
+	s.limit = limit
+	s.truncated = false
+}
+
+func (s *shellStream) contains(marker []byte) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return bytes.Contains(s.buf, marker)
+}
+
+func (s *shellStream) closed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.eof
+}
+
+func (s *shellStream) take() ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := append([]byte(nil), s.buf...)
+	s.buf = s.buf[:0]
+	return out, s.truncated
+}
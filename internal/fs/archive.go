@@ -0,0 +1,563 @@
+package fs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	ArchiveTarGz = "tar.gz"
+	ArchiveTar   = "tar"
+	ArchiveZip   = "zip"
+
+	maxArchiveLinkTarget = 4096
+)
+
+var ErrArchiveLimit = errors.New("archive exceeds limit")
+
+type ArchiveOptions struct {
+	Format     string
+	Include    []string
+	Exclude    []string
+	MaxBytes   int64
+	MaxEntries int
+}
+
+type ArchiveResult struct {
+	DownloadID string `json:"download_id"`
+	Path       string `json:"path"`
+	Format     string `json:"format"`
+	Size       int64  `json:"size"`
+	Entries    int    `json:"entries"`
+	Bytes      int64  `json:"bytes"`
+}
+
+type ExtractOptions struct {
+	Format          string
+	Overwrite       bool
+	StripComponents int
+	MaxBytes        int64
+	MaxEntries      int
+}
+
+type ExtractResult struct {
+	Path     string   `json:"path"`
+	Format   string   `json:"format"`
+	Files    int      `json:"files"`
+	Dirs     int      `json:"dirs"`
+	Symlinks int      `json:"symlinks"`
+	Bytes    int64    `json:"bytes"`
+	Skipped  []string `json:"skipped"`
+	links    map[string]bool
+}
+
+func (r *ExtractResult) AffectedPaths() []string { return []string{r.Path} }
+
+func ValidArchiveFormat(format string) bool {
+	switch format {
+	case ArchiveTarGz, ArchiveTar, ArchiveZip:
+		return true
+	}
+	return false
+}
+
+func (m *TransferManager) StartArchive(sessionID, root string, opts ArchiveOptions, dl DownloadOptions) (*ArchiveResult, error) {
+	if opts.Format == "" {
+		opts.Format = ArchiveTarGz
+	}
+	if !ValidArchiveFormat(opts.Format) {
+		return nil, fmt.Errorf("unsupported archive format %q", opts.Format)
+	}
+	tmp, err := os.CreateTemp("", "rexd-archive-*")
+	if err != nil {
+		return nil, err
+	}
+	_ = os.Remove(tmp.Name())
+	entries, total, err := m.fs.writeArchive(tmp, root, opts)
+	if err != nil {
+		_ = tmp.Close()
+		return nil, err
+	}
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		_ = tmp.Close()
+		return nil, err
+	}
+	stream := m.startStream(sessionID, root, tmp, size, DownloadOptions{ChunkSize: dl.ChunkSize, Window: dl.Window})
+	return &ArchiveResult{DownloadID: stream.ID, Path: root, Format: opts.Format, Size: size, Entries: entries, Bytes: total}, nil
+}
+
+type archiveWriter interface {
+	add(name string, info fs.FileInfo, link string, body io.Reader) error
+	Close() error
+}
+
+type tarArchive struct {
+	tw *tar.Writer
+	gz *gzip.Writer
+}
+
+func (a *tarArchive) add(name string, info fs.FileInfo, link string, body io.Reader) error {
+	hdr, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	hdr.Uname, hdr.Gname = "", ""
+	if err := a.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if body != nil {
+		_, err = io.Copy(a.tw, body)
+	}
+	return err
+}
+
+func (a *tarArchive) Close() error {
+	if err := a.tw.Close(); err != nil {
+		return err
+	}
+	if a.gz != nil {
+		return a.gz.Close()
+	}
+	return nil
+}
+
+type zipArchive struct {
+	zw *zip.Writer
+}
+
+func (a *zipArchive) add(name string, info fs.FileInfo, link string, body io.Reader) error {
+	hdr, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	if info.Mode().IsRegular() {
+		hdr.Method = zip.Deflate
+	}
+	w, err := a.zw.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+	switch {
+	case link != "":
+		_, err = io.WriteString(w, link)
+	case body != nil:
+		_, err = io.Copy(w, body)
+	}
+	return err
+}
+
+func (a *zipArchive) Close() error { return a.zw.Close() }
+
+func (s *Service) writeArchive(w io.Writer, root string, opts ArchiveOptions) (int, int64, error) {
+	st, err := os.Lstat(root)
+	if err != nil {
+		return 0, 0, err
+	}
+	buffered := bufio.NewWriter(w)
+	var archive archiveWriter
+	switch opts.Format {
+	case ArchiveZip:
+		archive = &zipArchive{zw: zip.NewWriter(buffered)}
+	case ArchiveTar:
+		archive = &tarArchive{tw: tar.NewWriter(buffered)}
+	default:
+		gz := gzip.NewWriter(buffered)
+		archive = &tarArchive{tw: tar.NewWriter(gz), gz: gz}
+	}
+
+	base := root
+	if !st.IsDir() {
+		base = filepath.Dir(root)
+	}
+	entries := 0
+	var total int64
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == base {
+			return nil
+		}
+		rel, err := filepath.Rel(base, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if s.denied(p) || (len(opts.Exclude) > 0 && matchFilter(opts.Exclude, rel)) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if len(opts.Include) > 0 && (d.IsDir() || !matchFilter(opts.Include, rel)) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		name, link := rel, ""
+		var body io.Reader
+		switch {
+		case info.IsDir():
+			name += "/"
+		case info.Mode()&fs.ModeSymlink != 0:
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		case info.Mode().IsRegular():
+			total += info.Size()
+			if opts.MaxBytes > 0 && total > opts.MaxBytes {
+				return fmt.Errorf("%w: more than %d bytes", ErrArchiveLimit, opts.MaxBytes)
+			}
+			f, err := s.open(p, os.O_RDONLY, 0)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			body = io.LimitReader(f, info.Size())
+		default:
+			return nil
+		}
+		entries++
+		if opts.MaxEntries > 0 && entries > opts.MaxEntries {
+			return fmt.Errorf("%w: more than %d entries", ErrArchiveLimit, opts.MaxEntries)
+		}
+		return archive.add(name, info, link, body)
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := archive.Close(); err != nil {
+		return 0, 0, err
+	}
+	return entries, total, buffered.Flush()
+}
+
+type archiveEntry struct {
+	name    string
+	mode    fs.FileMode
+	size    int64
+	link    string
+	modTime time.Time
+	open    func() (io.ReadCloser, error)
+}
+
+func DetectArchiveFormat(path string, sniff []byte) string {
+	switch {
+	case len(sniff) >= 2 && sniff[0] == 0x1f && sniff[1] == 0x8b:
+		return ArchiveTarGz
+	case len(sniff) >= 4 && string(sniff[:4]) == "PK\x03\x04":
+		return ArchiveZip
+	case len(sniff) >= 262 && string(sniff[257:262]) == "ustar":
+		return ArchiveTar
+	}
+	lower := strings.ToLower(path)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return ArchiveZip
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return ArchiveTarGz
+	}
+	return ArchiveTar
+}
+
+func (s *Service) Extract(archivePath, dest string, opts ExtractOptions) (*ExtractResult, error) {
+	f, err := s.open(archivePath, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if opts.Format == "" {
+		sniff := make([]byte, 512)
+		n, _ := io.ReadFull(f, sniff)
+		opts.Format = DetectArchiveFormat(archivePath, sniff[:n])
+	}
+	if !ValidArchiveFormat(opts.Format) {
+		return nil, fmt.Errorf("unsupported archive format %q", opts.Format)
+	}
+	if dst, err := os.Stat(dest); err == nil && !dst.IsDir() {
+		return nil, fmt.Errorf("%s: destination is not a directory", dest)
+	}
+
+	result := &ExtractResult{Path: dest, Format: opts.Format, Skipped: []string{}}
+	plan := func(e archiveEntry) error {
+		_, err := s.planExtractEntry(dest, e, opts, result)
+		return err
+	}
+	if err := walkArchive(f, st.Size(), opts.Format, plan); err != nil {
+		return nil, err
+	}
+
+	if err := s.mkdirAll(dest, 0755); err != nil {
+		return nil, err
+	}
+	*result = ExtractResult{Path: dest, Format: opts.Format, Skipped: []string{}}
+	extract := func(e archiveEntry) error {
+		target, err := s.planExtractEntry(dest, e, opts, result)
+		if err != nil || target == "" {
+			return err
+		}
+		return s.extractEntry(target, e, opts)
+	}
+	if err := walkArchive(f, st.Size(), opts.Format, extract); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func walkArchive(f *os.File, size int64, format string, visit func(archiveEntry) error) error {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if format == ArchiveZip {
+		zr, err := zip.NewReader(f, size)
+		if err != nil {
+			return err
+		}
+		for _, zf := range zr.File {
+			zf := zf
+			e := archiveEntry{name: zf.Name, mode: zf.Mode(), size: int64(zf.UncompressedSize64), modTime: zf.Modified, open: zf.Open}
+			if e.mode&fs.ModeSymlink != 0 {
+				rc, err := zf.Open()
+				if err != nil {
+					return err
+				}
+				target, err := io.ReadAll(io.LimitReader(rc, maxArchiveLinkTarget))
+				_ = rc.Close()
+				if err != nil {
+					return err
+				}
+				e.link = string(target)
+			}
+			if err := visit(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var r io.Reader = bufio.NewReader(f)
+	if format == ArchiveTarGz {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		e := archiveEntry{name: hdr.Name, mode: hdr.FileInfo().Mode(), size: hdr.Size, link: hdr.Linkname, modTime: hdr.ModTime}
+		e.open = func() (io.ReadCloser, error) { return io.NopCloser(tr), nil }
+		if hdr.Typeflag == tar.TypeLink {
+			e.mode = 0
+		}
+		if err := visit(e); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Service) planExtractEntry(dest string, e archiveEntry, opts ExtractOptions, result *ExtractResult) (string, error) {
+	name := path.Clean(strings.ReplaceAll(e.name, "\\", "/"))
+	if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+		return "", fmt.Errorf("archive entry %q escapes the destination", e.name)
+	}
+	if opts.StripComponents > 0 {
+		parts := strings.Split(name, "/")
+		if len(parts) <= opts.StripComponents {
+			return "", nil
+		}
+		name = path.Join(parts[opts.StripComponents:]...)
+	}
+	if name == "." {
+		return "", nil
+	}
+	target := filepath.Join(dest, filepath.FromSlash(name))
+	if s.denied(target) {
+		result.Skipped = append(result.Skipped, e.name)
+		return "", nil
+	}
+
+	switch {
+	case e.mode.IsDir():
+		result.Dirs++
+	case e.mode.IsRegular():
+		result.Files++
+		result.Bytes += e.size
+		if opts.MaxBytes > 0 && result.Bytes > opts.MaxBytes {
+			return "", fmt.Errorf("%w: more than %d bytes", ErrArchiveLimit, opts.MaxBytes)
+		}
+	case e.mode&fs.ModeSymlink != 0:
+		if err := checkExtractLink(dest, target, e, result.links); err != nil {
+			return "", err
+		}
+		if result.links == nil {
+			result.links = map[string]bool{}
+		}
+		result.links[target] = true
+		result.Symlinks++
+	default:
+		result.Skipped = append(result.Skipped, e.name)
+		return "", nil
+	}
+	if opts.MaxEntries > 0 && result.Files+result.Dirs+result.Symlinks > opts.MaxEntries {
+		return "", fmt.Errorf("%w: more than %d entries", ErrArchiveLimit, opts.MaxEntries)
+	}
+	if err := checkExtractParents(dest, target, result.links); err != nil {
+		return "", err
+	}
+	if existing, err := os.Lstat(target); err == nil {
+		switch {
+		case e.mode.IsDir() && existing.IsDir():
+		case !opts.Overwrite:
+			return "", fmt.Errorf("%s: %w", target, ErrDestinationExists)
+		case existing.IsDir():
+			return "", fmt.Errorf("%s: cannot replace a directory with a file", target)
+		}
+	}
+	return target, nil
+}
+
+func checkExtractLink(dest, target string, e archiveEntry, links map[string]bool) error {
+	link := filepath.FromSlash(e.link)
+	if filepath.IsAbs(link) {
+		return fmt.Errorf("archive symlink %q -> %q points outside the destination", e.name, e.link)
+	}
+	parts := strings.Split(link, string(filepath.Separator))
+	current := filepath.Dir(target)
+	for i, part := range parts {
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			current = filepath.Dir(current)
+		default:
+			current = filepath.Join(current, part)
+		}
+		if current != dest && !pathWithin(current, dest) {
+			return fmt.Errorf("archive symlink %q -> %q points outside the destination", e.name, e.link)
+		}
+		if i == len(parts)-1 {
+			break
+		}
+		if links[current] {
+			return fmt.Errorf("archive symlink %q -> %q goes through another symlink", e.name, e.link)
+		}
+		if st, err := os.Lstat(current); err == nil && st.Mode()&fs.ModeSymlink != 0 {
+			return fmt.Errorf("archive symlink %q -> %q goes through another symlink", e.name, e.link)
+		}
+	}
+	return nil
+}
+
+func checkExtractParents(dest, target string, links map[string]bool) error {
+	rel, err := filepath.Rel(dest, filepath.Dir(target))
+	if err != nil || rel == "." {
+		return err
+	}
+	current := dest
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		current = filepath.Join(current, part)
+		if links[current] {
+			return fmt.Errorf("%s: refusing to extract through a symlink", current)
+		}
+		st, err := os.Lstat(current)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if st.Mode()&fs.ModeSymlink != 0 {
+			return fmt.Errorf("%s: refusing to extract through a symlink", current)
+		}
+		if !st.IsDir() {
+			return fmt.Errorf("%s: not a directory", current)
+		}
+	}
+	return nil
+}
+
+func (s *Service) extractEntry(target string, e archiveEntry, opts ExtractOptions) error {
+	if err := s.mkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	perm := e.mode.Perm()
+	switch {
+	case e.mode.IsDir():
+		if perm == 0 {
+			perm = 0755
+		}
+		if err := s.mkdirAll(target, perm|0700); err != nil {
+			return err
+		}
+	case e.mode&fs.ModeSymlink != 0:
+		if opts.Overwrite {
+			_ = s.remove(target)
+		}
+		return s.symlink(e.link, target)
+	default:
+		if perm == 0 {
+			perm = 0644
+		}
+		rc, err := e.open()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		flags := os.O_CREATE | os.O_WRONLY | os.O_EXCL
+		if opts.Overwrite {
+			if err := s.remove(target); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+		out, err := s.open(target, flags, perm)
+		if err != nil {
+			return err
+		}
+		n, err := io.Copy(out, io.LimitReader(rc, e.size+1))
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+		if n != e.size {
+			return fmt.Errorf("archive entry %q is %d bytes, header says %d", e.name, n, e.size)
+		}
+		if err := s.chmod(target, perm); err != nil {
+			return err
+		}
+	}
+	if !e.modTime.IsZero() {
+		_ = s.chtimes(target, e.modTime)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package fs
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+func (s *Service) openDir(path string) (*os.File, error) {
+	return s.open(path, os.O_RDONLY|syscall.O_DIRECTORY, 0)
+}
+
+func (s *Service) mkdirAll(path string, perm os.FileMode) error {
+	if st, err := os.Stat(path); err == nil {
+		if st.IsDir() {
+			return nil
+		}
+		return &os.PathError{Op: "mkdir", Path: path, Err: syscall.ENOTDIR}
+	}
+	if parent := filepath.Dir(path); parent != path {
+		if err := s.mkdirAll(parent, perm); err != nil {
+			return err
+		}
+	}
+	if err := s.mkdir(path, perm); err != nil && !errors.Is(err, fs.ErrExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *Service) removeAll(path string) error {
+	err := s.remove(path)
+	if err == nil || errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if !errors.Is(err, syscall.ENOTEMPTY) && !errors.Is(err, syscall.EEXIST) {
+		return err
+	}
+	d, err := s.openDir(path)
+	if err != nil {
+		return err
+	}
+	entries, err := d.ReadDir(-1)
+	_ = d.Close()
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := s.removeAll(filepath.Join(path, entry.Name())); err != nil {
+			return err
+		}
+	}
+	if err := s.remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *Service) syncDir(dir string) error {
+	d, err := s.openDir(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil && !errors.Is(err, syscall.EINVAL) {
+		return err
+	}
+	return nil
+}
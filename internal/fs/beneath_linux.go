@@ -0,0 +1,177 @@
+//go:build linux
+
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	atRemoveDir = 0x200
+	oPath       = 0x200000
+)
+
+func (s *Service) openParent(path string) (*os.File, string, error) {
+	d, err := s.openDir(filepath.Dir(path))
+	if err != nil {
+		return nil, "", err
+	}
+	return d, filepath.Base(path), nil
+}
+
+func (s *Service) rename(from, to string) error {
+	fromDir, fromName, err := s.openParent(from)
+	if err != nil {
+		return err
+	}
+	defer fromDir.Close()
+	toDir, toName, err := s.openParent(to)
+	if err != nil {
+		return err
+	}
+	defer toDir.Close()
+	if err := syscall.Renameat(int(fromDir.Fd()), fromName, int(toDir.Fd()), toName); err != nil {
+		return &os.LinkError{Op: "rename", Old: from, New: to, Err: err}
+	}
+	return nil
+}
+
+func (s *Service) link(from, to string) error {
+	fromDir, fromName, err := s.openParent(from)
+	if err != nil {
+		return err
+	}
+	defer fromDir.Close()
+	toDir, toName, err := s.openParent(to)
+	if err != nil {
+		return err
+	}
+	defer toDir.Close()
+	if err := linkat(int(fromDir.Fd()), fromName, int(toDir.Fd()), toName); err != nil {
+		return &os.LinkError{Op: "link", Old: from, New: to, Err: err}
+	}
+	return nil
+}
+
+func (s *Service) symlink(target, path string) error {
+	dir, name, err := s.openParent(path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	targetPtr, err := syscall.BytePtrFromString(target)
+	if err != nil {
+		return err
+	}
+	namePtr, err := syscall.BytePtrFromString(name)
+	if err != nil {
+		return err
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_SYMLINKAT, uintptr(unsafe.Pointer(targetPtr)), dir.Fd(), uintptr(unsafe.Pointer(namePtr)))
+	if errno != 0 {
+		return &os.LinkError{Op: "symlink", Old: target, New: path, Err: errno}
+	}
+	return nil
+}
+
+func (s *Service) mkdir(path string, perm os.FileMode) error {
+	dir, name, err := s.openParent(path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	if err := syscall.Mkdirat(int(dir.Fd()), name, uint32(perm.Perm())); err != nil {
+		return &os.PathError{Op: "mkdir", Path: path, Err: err}
+	}
+	return nil
+}
+
+func (s *Service) remove(path string) error {
+	dir, name, err := s.openParent(path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	e := syscall.Unlinkat(int(dir.Fd()), name)
+	if e == nil {
+		return nil
+	}
+	e1 := unlinkat(int(dir.Fd()), name, atRemoveDir)
+	if e1 == nil {
+		return nil
+	}
+	if e1 != syscall.ENOTDIR {
+		e = e1
+	}
+	return &os.PathError{Op: "remove", Path: path, Err: e}
+}
+
+func (s *Service) chmod(path string, mode os.FileMode) error {
+	return s.viaFD("chmod", path, func(p string) error { return syscall.Chmod(p, syscallMode(mode)) })
+}
+
+func (s *Service) chtimes(path string, mtime time.Time) error {
+	ts := syscall.NsecToTimespec(mtime.UnixNano())
+	return s.viaFD("chtimes", path, func(p string) error { return syscall.UtimesNano(p, []syscall.Timespec{ts, ts}) })
+}
+
+// viaFD applies a path-based call to the inode opened beneath the allowed
+// root, through its /proc/self/fd entry, so no path component is re-resolved.
+func (s *Service) viaFD(op, path string, fn func(string) error) error {
+	f, err := s.open(path, oPath, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := fn("/proc/self/fd/" + strconv.Itoa(int(f.Fd()))); err != nil {
+		return &os.PathError{Op: op, Path: path, Err: err}
+	}
+	return nil
+}
+
+func syscallMode(mode os.FileMode) uint32 {
+	v := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		v |= syscall.S_ISUID
+	}
+	if mode&os.ModeSetgid != 0 {
+		v |= syscall.S_ISGID
+	}
+	if mode&os.ModeSticky != 0 {
+		v |= syscall.S_ISVTX
+	}
+	return v
+}
+
+func linkat(oldDirfd int, oldName string, newDirfd int, newName string) error {
+	oldPtr, err := syscall.BytePtrFromString(oldName)
+	if err != nil {
+		return err
+	}
+	newPtr, err := syscall.BytePtrFromString(newName)
+	if err != nil {
+		return err
+	}
+	_, _, errno := syscall.Syscall6(syscall.SYS_LINKAT, uintptr(oldDirfd), uintptr(unsafe.Pointer(oldPtr)), uintptr(newDirfd), uintptr(unsafe.Pointer(newPtr)), 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func unlinkat(dirfd int, name string, flags int) error {
+	namePtr, err := syscall.BytePtrFromString(name)
+	if err != nil {
+		return err
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_UNLINKAT, uintptr(dirfd), uintptr(unsafe.Pointer(namePtr)), uintptr(flags))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+//go:build !linux
+
+package fs
+
+import (
+	"os"
+	"time"
+)
+
+func (s *Service) rename(from, to string) error {
+	return os.Rename(from, to)
+}
+
+func (s *Service) link(from, to string) error {
+	return os.Link(from, to)
+}
+
+func (s *Service) symlink(target, path string) error {
+	return os.Symlink(target, path)
+}
+
+func (s *Service) mkdir(path string, perm os.FileMode) error {
+	return os.Mkdir(path, perm)
+}
+
+func (s *Service) remove(path string) error {
+	return os.Remove(path)
+}
+
+func (s *Service) chmod(path string, mode os.FileMode) error {
+	return os.Chmod(path, mode)
+}
+
+func (s *Service) chtimes(path string, mtime time.Time) error {
+	return os.Chtimes(path, mtime, mtime)
+}
@@ -0,0 +1,166 @@
+package fs
+
+import (
+	"strings"
+)
+
+const (
+	maxClosestScanCost = 1_000_000
+	maxMatchLocations  = 50
+)
+
+type MatchLocation struct {
+	StartLine int `json:"start_line"`
+	EndLine   int `json:"end_line"`
+}
+
+type ClosestMatch struct {
+	StartLine  int      `json:"start_line"`
+	EndLine    int      `json:"end_line"`
+	Similarity float64  `json:"similarity"`
+	Lines      []string `json:"lines"`
+	Diff       string   `json:"diff"`
+}
+
+type MatchFailure struct {
+	Message    string          `json:"-"`
+	Reason     string          `json:"reason"`
+	Path       string          `json:"path,omitempty"`
+	HunkIndex  *int            `json:"hunk_index,omitempty"`
+	ChunkIndex *int            `json:"chunk_index,omitempty"`
+	EditIndex  *int            `json:"edit_index,omitempty"`
+	Expected   []string        `json:"expected,omitempty"`
+	Closest    *ClosestMatch   `json:"closest_match,omitempty"`
+	Matches    []MatchLocation `json:"matches,omitempty"`
+}
+
+func (e *MatchFailure) Error() string { return e.Message }
+
+func (e *MatchFailure) ErrorData() any { return e }
+
+func intPtr(v int) *int { return &v }
+
+func notFoundFailure(message string, lines, expected []string) *MatchFailure {
+	return &MatchFailure{
+		Message:  message,
+		Reason:   "not_found",
+		Expected: expected,
+		Closest:  closestMatch(lines, expected),
+	}
+}
+
+func ambiguousFailure(message string, matches []MatchLocation) *MatchFailure {
+	if len(matches) > maxMatchLocations {
+		matches = matches[:maxMatchLocations]
+	}
+	return &MatchFailure{Message: message, Reason: "ambiguous", Matches: matches}
+}
+
+func exactMatchLocations(text, needle string) []MatchLocation {
+	span := strings.Count(needle, "\n")
+	if strings.HasSuffix(needle, "\n") && span > 0 {
+		span--
+	}
+	locations := []MatchLocation{}
+	line, last := 1, 0
+	for offset := 0; ; {
+		idx := strings.Index(text[offset:], needle)
+		if idx < 0 {
+			break
+		}
+		idx += offset
+		line += strings.Count(text[last:idx], "\n")
+		last = idx
+		locations = append(locations, MatchLocation{StartLine: line, EndLine: line + span})
+		offset = idx + max(len(needle), 1)
+	}
+	return locations
+}
+
+func closestMatch(lines, expected []string) *ClosestMatch {
+	k := len(expected)
+	if k == 0 || len(lines) == 0 {
+		return nil
+	}
+	if k > len(lines) {
+		k = len(lines)
+	}
+	starts := candidateStarts(lines, expected, k)
+	best, bestScore := -1, 0.0
+	for _, start := range starts {
+		score := 0.0
+		for i := 0; i < k; i++ {
+			score += lineSimilarity(lines[start+i], expected[i])
+		}
+		score /= float64(len(expected))
+		if score > bestScore {
+			best, bestScore = start, score
+		}
+	}
+	if best < 0 {
+		return nil
+	}
+	actual := append([]string(nil), lines[best:best+k]...)
+	diff, _ := UnifiedDiff("expected", "file", strings.Join(expected, "\n")+"\n", strings.Join(actual, "\n")+"\n")
+	return &ClosestMatch{
+		StartLine:  best + 1,
+		EndLine:    best + k,
+		Similarity: float64(int(bestScore*1000+0.5)) / 1000,
+		Lines:      actual,
+		Diff:       diff,
+	}
+}
+
+func candidateStarts(lines, expected []string, k int) []int {
+	all := len(lines) - k + 1
+	if all*k <= maxClosestScanCost {
+		starts := make([]int, all)
+		for i := range starts {
+			starts[i] = i
+		}
+		return starts
+	}
+	offsets := map[string][]int{}
+	for i, line := range expected[:k] {
+		if key := strings.TrimSpace(line); key != "" {
+			offsets[key] = append(offsets[key], i)
+		}
+	}
+	seen := map[int]bool{}
+	starts := []int{}
+	for pos, line := range lines {
+		for _, off := range offsets[strings.TrimSpace(line)] {
+			start := pos - off
+			if start >= 0 && start < all && !seen[start] {
+				seen[start] = true
+				starts = append(starts, start)
+			}
+		}
+		if len(starts)*k > maxClosestScanCost {
+			break
+		}
+	}
+	return starts
+}
+
+func lineSimilarity(a, b string) float64 {
+	a, b = strings.TrimSpace(a), strings.TrimSpace(b)
+	if a == b {
+		return 1
+	}
+	if len(a) < 2 || len(b) < 2 {
+		return 0
+	}
+	bigrams := make(map[string]int, len(a))
+	for i := 0; i+1 < len(a); i++ {
+		bigrams[a[i:i+2]]++
+	}
+	common := 0
+	for i := 0; i+1 < len(b); i++ {
+		if bigrams[b[i:i+2]] > 0 {
+			bigrams[b[i:i+2]]--
+			common++
+		}
+	}
+	return 2 * float64(common) / float64(len(a)+len(b)-2)
+}
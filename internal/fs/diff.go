@@ -0,0 +1,486 @@
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const (
+	DefaultDiffContext = 3
+	maxDiffEdits       = 2000
+	noNewlineMarker    = `\ No newline at end of file`
+)
+
+var ErrDiffTooLarge = errors.New("file too large to diff")
+
+type DiffHunk struct {
+	OldStart int      `json:"old_start"`
+	OldLines int      `json:"old_lines"`
+	NewStart int      `json:"new_start"`
+	NewLines int      `json:"new_lines"`
+	Lines    []string `json:"lines"`
+}
+
+type DiffRange struct {
+	OldStart int `json:"old_start"`
+	OldLines int `json:"old_lines"`
+	NewStart int `json:"new_start"`
+	NewLines int `json:"new_lines"`
+}
+
+type diffOp struct {
+	kind byte
+	text string
+	old  int
+	new  int
+}
+
+func splitDiffLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func diffLines(a, b []string) []diffOp {
+	return diffLinesBy(a, b, nil)
+}
+
+func diffLinesBy(a, b []string, key func(string) string) []diffOp {
+	if key == nil {
+		return diffKeys(a, b)
+	}
+	ka, kb := make([]string, len(a)), make([]string, len(b))
+	for i, line := range a {
+		ka[i] = key(line)
+	}
+	for i, line := range b {
+		kb[i] = key(line)
+	}
+	ops := diffKeys(ka, kb)
+	for i := range ops {
+		if ops[i].kind == '+' {
+			ops[i].text = b[ops[i].new]
+		} else {
+			ops[i].text = a[ops[i].old]
+		}
+	}
+	return ops
+}
+
+func diffKeys(a, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	ops := make([]diffOp, 0, len(a)+len(b))
+	for i := 0; i < prefix; i++ {
+		ops = append(ops, diffOp{kind: ' ', text: a[i], old: i, new: i})
+	}
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	middle, ok := myersDiff(midA, midB)
+	if !ok {
+		middle = middle[:0]
+		for i, line := range midA {
+			middle = append(middle, diffOp{kind: '-', text: line, old: i, new: 0})
+		}
+		for i, line := range midB {
+			middle = append(middle, diffOp{kind: '+', text: line, old: len(midA), new: i})
+		}
+	}
+	for _, op := range middle {
+		op.old += prefix
+		op.new += prefix
+		ops = append(ops, op)
+	}
+	for i := 0; i < suffix; i++ {
+		ops = append(ops, diffOp{kind: ' ', text: a[len(a)-suffix+i], old: len(a) - suffix + i, new: len(b) - suffix + i})
+	}
+	return ops
+}
+
+func myersDiff(a, b []string) ([]diffOp, bool) {
+	n, m := len(a), len(b)
+	if n == 0 && m == 0 {
+		return nil, true
+	}
+	limit := n + m
+	if limit > maxDiffEdits {
+		limit = maxDiffEdits
+	}
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+	trace := make([][]int, 0, 16)
+	final := -1
+	for d := 0; d <= limit && final < 0; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				final = d
+				break
+			}
+		}
+	}
+	if final < 0 {
+		return nil, false
+	}
+
+	var ops []diffOp
+	x, y := n, m
+	for d := final; d > 0; d-- {
+		prev := trace[d]
+		at := func(k int) int { return prev[k+d] }
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			ops = append(ops, diffOp{kind: ' ', text: a[x], old: x, new: y})
+		}
+		if x == prevX {
+			y--
+			ops = append(ops, diffOp{kind: '+', text: b[y], old: x, new: y})
+		} else {
+			x--
+			ops = append(ops, diffOp{kind: '-', text: a[x], old: x, new: y})
+		}
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		ops = append(ops, diffOp{kind: ' ', text: a[x], old: x, new: y})
+	}
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops, true
+}
+
+func buildHunks(ops []diffOp, context int) []DiffHunk {
+	hunks := []DiffHunk{}
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for j := i; j < len(ops); j++ {
+			if ops[j].kind != ' ' {
+				end = j
+				continue
+			}
+			if j-end > 2*context {
+				break
+			}
+		}
+		stop := end + context + 1
+		if stop > len(ops) {
+			stop = len(ops)
+		}
+		hunk := DiffHunk{OldStart: ops[start].old + 1, NewStart: ops[start].new + 1}
+		for _, op := range ops[start:stop] {
+			switch op.kind {
+			case ' ':
+				hunk.OldLines++
+				hunk.NewLines++
+			case '-':
+				hunk.OldLines++
+			case '+':
+				hunk.NewLines++
+			}
+			hunk.Lines = append(hunk.Lines, string(op.kind)+strings.TrimSuffix(op.text, "\n"))
+			if !strings.HasSuffix(op.text, "\n") {
+				hunk.Lines = append(hunk.Lines, noNewlineMarker)
+			}
+		}
+		if hunk.OldLines == 0 {
+			hunk.OldStart--
+		}
+		if hunk.NewLines == 0 {
+			hunk.NewStart--
+		}
+		hunks = append(hunks, hunk)
+		i = stop
+	}
+	return hunks
+}
+
+func changedRanges(ops []diffOp) []DiffRange {
+	ranges := []DiffRange{}
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		r := DiffRange{OldStart: ops[i].old + 1, NewStart: ops[i].new + 1}
+		for ; i < len(ops) && ops[i].kind != ' '; i++ {
+			if ops[i].kind == '-' {
+				r.OldLines++
+			} else {
+				r.NewLines++
+			}
+		}
+		if r.OldLines == 0 {
+			r.OldStart--
+		}
+		if r.NewLines == 0 {
+			r.NewStart--
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges
+}
+
+func formatHunkRange(start, lines int) string {
+	if lines == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, lines)
+}
+
+func formatUnified(oldName, newName string, hunks []DiffHunk) string {
+	if len(hunks) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldName, newName)
+	for _, h := range hunks {
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n", formatHunkRange(h.OldStart, h.OldLines), formatHunkRange(h.NewStart, h.NewLines))
+		for _, line := range h.Lines {
+			b.WriteString(line)
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+type DiffOptions struct {
+	Context          int
+	IgnoreWhitespace bool
+	Word             bool
+	MaxBytes         int64
+}
+
+type DiffResult struct {
+	Diff      string
+	Hunks     []DiffHunk
+	Ranges    []DiffRange
+	Added     int
+	Removed   int
+	Identical bool
+}
+
+func ComputeDiff(oldName, newName, oldText, newText string, opts DiffOptions) DiffResult {
+	var key func(string) string
+	if opts.IgnoreWhitespace {
+		key = func(line string) string { return strings.Join(strings.Fields(line), " ") }
+	}
+	ops := diffLinesBy(splitDiffLines(oldText), splitDiffLines(newText), key)
+	result := DiffResult{Ranges: changedRanges(ops)}
+	for _, op := range ops {
+		switch op.kind {
+		case '+':
+			result.Added++
+		case '-':
+			result.Removed++
+		}
+	}
+	result.Identical = result.Added == 0 && result.Removed == 0
+	result.Hunks = buildHunks(ops, opts.Context)
+	if opts.Word {
+		for i := range result.Hunks {
+			result.Hunks[i].Lines = wordDiffLines(result.Hunks[i].Lines)
+		}
+	}
+	result.Diff = formatUnified(oldName, newName, result.Hunks)
+	return result
+}
+
+func UnifiedDiff(oldName, newName, oldText, newText string) (string, []DiffRange) {
+	result := ComputeDiff(oldName, newName, oldText, newText, DiffOptions{Context: DefaultDiffContext})
+	return result.Diff, result.Ranges
+}
+
+var wordTokenPattern = regexp.MustCompile(`\s+|\w+|[^\w\s]`)
+
+func wordDiffLines(lines []string) []string {
+	out := []string{}
+	var removed, added []string
+	flush := func() {
+		if len(removed) == 0 && len(added) == 0 {
+			return
+		}
+		oldTokens := wordTokenPattern.FindAllString(strings.Join(removed, "\n"), -1)
+		newTokens := wordTokenPattern.FindAllString(strings.Join(added, "\n"), -1)
+		var b strings.Builder
+		ops := diffLines(oldTokens, newTokens)
+		for i := 0; i < len(ops); {
+			kind := ops[i].kind
+			var run strings.Builder
+			for ; i < len(ops) && ops[i].kind == kind; i++ {
+				run.WriteString(ops[i].text)
+			}
+			switch kind {
+			case '-':
+				b.WriteString("[-" + run.String() + "-]")
+			case '+':
+				b.WriteString("{+" + run.String() + "+}")
+			default:
+				b.WriteString(run.String())
+			}
+		}
+		out = append(out, strings.Split(b.String(), "\n")...)
+		removed, added = nil, nil
+	}
+	for _, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "-"):
+			removed = append(removed, line[1:])
+		case strings.HasPrefix(line, "+"):
+			added = append(added, line[1:])
+		case line == noNewlineMarker:
+		default:
+			flush()
+			out = append(out, strings.TrimPrefix(line, " "))
+		}
+	}
+	flush()
+	return out
+}
+
+func (s *Service) DiffFiles(oldPath, newPath string, opts DiffOptions) (map[string]any, error) {
+	limit := s.diffLimit(opts.MaxBytes)
+	oldData, oldExists, err := s.readDiffSide(oldPath, limit)
+	if err != nil {
+		return nil, err
+	}
+	newData, newExists, err := s.readDiffSide(newPath, limit)
+	if err != nil {
+		return nil, err
+	}
+	if !oldExists && !newExists {
+		return nil, fmt.Errorf("%s: %w", oldPath, os.ErrNotExist)
+	}
+	return diffContents(diffName(oldPath, oldExists), diffName(newPath, newExists), oldData, newData, opts), nil
+}
+
+func (s *Service) DiffContent(path string, content []byte, opts DiffOptions) (map[string]any, error) {
+	limit := s.diffLimit(opts.MaxBytes)
+	if limit > 0 && int64(len(content)) > limit {
+		return nil, fmt.Errorf("%w: content is %d bytes (limit %d)", ErrDiffTooLarge, len(content), limit)
+	}
+	data, exists, err := s.readDiffSide(path, limit)
+	if err != nil {
+		return nil, err
+	}
+	return diffContents(diffName(path, exists), path, data, content, opts), nil
+}
+
+func (s *Service) diffLimit(requested int64) int64 {
+	if s.maxReadBytes > 0 && (requested <= 0 || requested > s.maxReadBytes) {
+		return s.maxReadBytes
+	}
+	return requested
+}
+
+func (s *Service) readDiffSide(path string, limit int64) ([]byte, bool, error) {
+	f, err := s.open(path, os.O_RDONLY, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return nil, false, err
+	}
+	if st.IsDir() {
+		return nil, false, fmt.Errorf("%s: path is a directory", path)
+	}
+	if limit > 0 && st.Size() > limit {
+		return nil, false, fmt.Errorf("%w: %s is %d bytes (limit %d)", ErrDiffTooLarge, path, st.Size(), limit)
+	}
+	data, err := io.ReadAll(f)
+	return data, true, err
+}
+
+func diffName(path string, exists bool) string {
+	if !exists {
+		return "/dev/null"
+	}
+	return path
+}
+
+func diffContents(oldName, newName string, oldData, newData []byte, opts DiffOptions) map[string]any {
+	format := "unified"
+	if opts.Word {
+		format = "word"
+	}
+	out := map[string]any{
+		"old_path": oldName,
+		"new_path": newName,
+		"format":   format,
+		"binary":   false,
+	}
+	_, oldText := DetectTextFormat(oldData, true)
+	_, newText := DetectTextFormat(newData, true)
+	if !oldText || !newText {
+		out["binary"] = true
+		out["identical"] = bytes.Equal(oldData, newData)
+		out["diff"] = ""
+		out["hunks"] = []DiffHunk{}
+		return out
+	}
+	before, oldFormat := DecodeText(oldData)
+	after, newFormat := DecodeText(newData)
+	result := ComputeDiff(oldName, newName, before, after, opts)
+	oldEnding, newEnding := oldFormat.LineEndingName(), newFormat.LineEndingName()
+	endingsDiffer := oldEnding != "" && newEnding != "" && oldEnding != newEnding
+	if endingsDiffer {
+		out["old_line_ending"] = oldEnding
+		out["new_line_ending"] = newEnding
+	}
+	out["line_endings_differ"] = endingsDiffer
+	out["identical"] = result.Identical && !endingsDiffer
+	out["diff"] = result.Diff
+	out["hunks"] = result.Hunks
+	out["added"] = result.Added
+	out["removed"] = result.Removed
+	return out
+}
@@ -0,0 +1,230 @@
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	MatchExact       = "exact"
+	MatchWhitespace  = "whitespace"
+	MatchIndentation = "indentation"
+	MatchFuzzy       = "fuzzy"
+)
+
+const msgAmbiguousEdit = "old_string matched multiple locations; set replace_all=true"
+
+var errEditNotFound = errors.New("old_string not found")
+
+type EditSpec struct {
+	OldString  string
+	NewString  string
+	ReplaceAll bool
+	Match      string
+}
+
+func ValidMatch(match string) bool {
+	switch match {
+	case "", MatchExact, MatchWhitespace, MatchIndentation, MatchFuzzy:
+		return true
+	}
+	return false
+}
+
+func applyEdit(text string, e EditSpec) (string, int, string, error) {
+	strategies := []string{e.Match}
+	switch e.Match {
+	case "":
+		strategies = []string{MatchExact}
+	case MatchFuzzy:
+		strategies = []string{MatchExact, MatchWhitespace, MatchIndentation}
+	}
+	for _, strategy := range strategies {
+		var next string
+		var n int
+		var err error
+		switch strategy {
+		case MatchExact:
+			next, n, err = replaceExact(text, e)
+		case MatchWhitespace:
+			next, n, err = replaceLines(text, e, func(a, b string) bool {
+				return strings.TrimRight(a, " \t") == strings.TrimRight(b, " \t")
+			}, false)
+		case MatchIndentation:
+			next, n, err = replaceLines(text, e, func(a, b string) bool {
+				return strings.TrimSpace(a) == strings.TrimSpace(b)
+			}, true)
+		default:
+			return "", 0, "", fmt.Errorf("unsupported match strategy %q", strategy)
+		}
+		if errors.Is(err, errEditNotFound) {
+			continue
+		}
+		return next, n, strategy, err
+	}
+	return "", 0, "", errEditNotFound
+}
+
+func replaceExact(text string, e EditSpec) (string, int, error) {
+	count := strings.Count(text, e.OldString)
+	switch {
+	case count == 0:
+		return "", 0, errEditNotFound
+	case e.ReplaceAll:
+		return strings.ReplaceAll(text, e.OldString, e.NewString), count, nil
+	case count > 1:
+		return "", 0, ambiguousFailure(msgAmbiguousEdit, exactMatchLocations(text, e.OldString))
+	}
+	return strings.Replace(text, e.OldString, e.NewString, 1), 1, nil
+}
+
+func splitEditLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.Split(s, "\n")
+	if len(lines) > 1 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func replaceLines(text string, e EditSpec, compare func(a, b string) bool, reindent bool) (string, int, error) {
+	if strings.TrimSpace(e.OldString) == "" {
+		return "", 0, errEditNotFound
+	}
+	lines := strings.Split(text, "\n")
+	pattern := splitEditLines(e.OldString)
+	replacement := splitEditLines(e.NewString)
+
+	matches := []int{}
+	for i := 0; i+len(pattern) <= len(lines); {
+		if sequenceMatches(lines, pattern, i, compare) {
+			matches = append(matches, i)
+			i += len(pattern)
+			continue
+		}
+		i++
+	}
+	switch {
+	case len(matches) == 0:
+		return "", 0, errEditNotFound
+	case len(matches) > 1 && !e.ReplaceAll:
+		locations := make([]MatchLocation, len(matches))
+		for i, m := range matches {
+			locations[i] = MatchLocation{StartLine: m + 1, EndLine: m + len(pattern)}
+		}
+		return "", 0, ambiguousFailure(msgAmbiguousEdit, locations)
+	}
+
+	out := make([]string, 0, len(lines))
+	prev := 0
+	for _, m := range matches {
+		out = append(out, lines[prev:m]...)
+		if reindent {
+			out = append(out, reindentLines(replacement, pattern, lines[m:m+len(pattern)])...)
+		} else {
+			out = append(out, replacement...)
+		}
+		prev = m + len(pattern)
+	}
+	out = append(out, lines[prev:]...)
+	return strings.Join(out, "\n"), len(matches), nil
+}
+
+func leadingWhitespace(s string) string {
+	return s[:len(s)-len(strings.TrimLeft(s, " \t"))]
+}
+
+func reindentLines(replacement, pattern, matched []string) []string {
+	from, to := "", ""
+	for i, line := range pattern {
+		if strings.TrimSpace(line) != "" {
+			from, to = leadingWhitespace(line), leadingWhitespace(matched[i])
+			break
+		}
+	}
+	if from == to {
+		return replacement
+	}
+	out := make([]string, len(replacement))
+	for i, line := range replacement {
+		if strings.TrimSpace(line) != "" && strings.HasPrefix(line, from) {
+			line = to + line[len(from):]
+		}
+		out[i] = line
+	}
+	return out
+}
+
+func editFailure(err error, text, oldString string) *MatchFailure {
+	var failure *MatchFailure
+	switch {
+	case errors.As(err, &failure):
+		return failure
+	case errors.Is(err, errEditNotFound):
+		return notFoundFailure(err.Error(), strings.Split(text, "\n"), splitEditLines(oldString))
+	}
+	return nil
+}
+
+func (s *Service) MultiEdit(path string, edits []EditSpec, pre Preconditions) (map[string]any, error) {
+	if len(edits) == 0 {
+		return nil, errors.New("edits must not be empty")
+	}
+	if _, err := checkMTime(path, pre.MTime); err != nil {
+		return nil, err
+	}
+	raw, err := s.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkContentSHA256(string(raw), true, pre.SHA256); err != nil {
+		return nil, err
+	}
+
+	original, format := DecodeText(raw)
+	text := original
+	applied := make([]map[string]any, 0, len(edits))
+	for i, e := range edits {
+		if e.OldString == "" {
+			return nil, fmt.Errorf("edit %d: old_string is required", i)
+		}
+		if format.normalized() {
+			e.OldString = NormalizeLineEndings(e.OldString)
+			e.NewString = NormalizeLineEndings(e.NewString)
+		}
+		if e.OldString == e.NewString {
+			return nil, fmt.Errorf("edit %d: old_string and new_string are identical", i)
+		}
+		next, n, used, err := applyEdit(text, e)
+		if err != nil {
+			failure := editFailure(err, text, e.OldString)
+			if failure == nil {
+				return nil, fmt.Errorf("edit %d: %w", i, err)
+			}
+			failure.Path, failure.EditIndex = path, intPtr(i)
+			failure.Message = fmt.Sprintf("edit %d: %s", i, failure.Message)
+			return nil, failure
+		}
+		applied = append(applied, map[string]any{"index": i, "replacements": n, "match": used})
+		text = next
+	}
+
+	encoded, err := format.Encode(text)
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.Write(path, encoded, WriteOptions{Mode: "replace", Atomic: true, Pre: Preconditions{MTime: pre.MTime}})
+	if err != nil {
+		return nil, err
+	}
+	diff := ComputeDiff(path, path, original, text, DiffOptions{Context: DefaultDiffContext})
+	result["edits"] = applied
+	result["diff"] = diff.Diff
+	result["hunks"] = diff.Hunks
+	result["ranges"] = diff.Ranges
+	addTextFormat(result, format)
+	return result, nil
+}
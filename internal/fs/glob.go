@@ -0,0 +1,243 @@
+package fs
+
+import (
+	"container/heap"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+type GlobOptions struct {
+	Cwd        string
+	Patterns   []string
+	Exclude    []string
+	Ignore     bool
+	Sort       string
+	MaxMatches int
+}
+
+type GlobResult struct {
+	Matches   []string `json:"matches"`
+	Truncated bool     `json:"truncated"`
+}
+
+func hasGlobMeta(segment string) bool {
+	return strings.ContainsAny(segment, "*?[{\\")
+}
+
+func GlobBase(pattern string) string {
+	segments := strings.Split(filepath.ToSlash(pattern), "/")
+	static := []string{}
+	for _, seg := range segments {
+		if hasGlobMeta(seg) {
+			break
+		}
+		static = append(static, seg)
+	}
+	if len(static) == len(segments) {
+		static = static[:len(static)-1]
+	}
+	base := strings.Join(static, "/")
+	if base == "" && strings.HasPrefix(pattern, "/") {
+		return "/"
+	}
+	return filepath.FromSlash(base)
+}
+
+func matchGlobPrefix(pattern, dir []string) bool {
+	for i, seg := range dir {
+		if i >= len(pattern) {
+			return false
+		}
+		if pattern[i] == "**" {
+			return true
+		}
+		if ok, err := filepath.Match(pattern[i], seg); err != nil || !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Service) Glob(walkRoots []string, opts GlobOptions) (*GlobResult, error) {
+	patterns := []string{}
+	for _, p := range opts.Patterns {
+		for _, expanded := range ExpandBraces(filepath.ToSlash(p)) {
+			patterns = append(patterns, expanded)
+		}
+	}
+	if len(patterns) == 0 {
+		return nil, errors.New("pattern is required")
+	}
+	split := make([][]string, len(patterns))
+	for i, p := range patterns {
+		split[i] = strings.Split(p, "/")
+	}
+	excluded := func(p string) bool {
+		if len(opts.Exclude) == 0 {
+			return false
+		}
+		rel, err := filepath.Rel(opts.Cwd, p)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			rel = p
+		}
+		return matchFilter(opts.Exclude, filepath.ToSlash(rel))
+	}
+
+	hits := &globHits{max: opts.MaxMatches}
+	switch opts.Sort {
+	case "", "path":
+		hits.better = func(a, b globHit) bool { return a.path < b.path }
+	case "mtime":
+		hits.byMtime = true
+		hits.better = func(a, b globHit) bool {
+			if a.mtime.Equal(b.mtime) {
+				return a.path < b.path
+			}
+			return a.mtime.After(b.mtime)
+		}
+	default:
+		return nil, errors.New("sort must be path or mtime")
+	}
+	for _, root := range walkRoots {
+		var ignores *ignoreNode
+		if opts.Ignore {
+			ignores = s.ignoreChain(root)
+		}
+		ignoreNodes := map[string]*ignoreNode{}
+		err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if p == root {
+					if errors.Is(err, os.ErrNotExist) {
+						return filepath.SkipDir
+					}
+					return err
+				}
+				return nil
+			}
+			node := ignores
+			if opts.Ignore {
+				if parent, ok := ignoreNodes[filepath.Dir(p)]; ok {
+					node = parent
+				}
+				if p != root && node.ignored(p, d.IsDir()) {
+					if d.IsDir() {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				if d.IsDir() {
+					if d.Name() == ".git" && p != root {
+						return filepath.SkipDir
+					}
+					if p != root {
+						ignoreNodes[p] = loadIgnoreNode(node, p)
+					} else {
+						ignoreNodes[p] = node
+					}
+				}
+			}
+			if p != root && (s.denied(p) || excluded(p)) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			segs := strings.Split(filepath.ToSlash(p), "/")
+			descend, matched := false, false
+			for _, pattern := range split {
+				if matchSegments(pattern, segs) {
+					matched = true
+				}
+				if d.IsDir() && matchGlobPrefix(pattern, segs) {
+					descend = true
+				}
+			}
+			if hits.beyond(p) {
+				if matched || (d.IsDir() && descend) {
+					hits.truncated = true
+				}
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if matched {
+				hits.add(p, d)
+			}
+			if d.IsDir() && !descend && p != root {
+				return filepath.SkipDir
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &GlobResult{Matches: hits.sorted(), Truncated: hits.truncated}, nil
+}
+
+type globHit struct {
+	path  string
+	mtime time.Time
+}
+
+type globHits struct {
+	max       int
+	byMtime   bool
+	better    func(a, b globHit) bool
+	hits      []globHit
+	truncated bool
+}
+
+func (h *globHits) Len() int           { return len(h.hits) }
+func (h *globHits) Less(i, j int) bool { return h.better(h.hits[j], h.hits[i]) }
+func (h *globHits) Swap(i, j int)      { h.hits[i], h.hits[j] = h.hits[j], h.hits[i] }
+func (h *globHits) Push(x any)         { h.hits = append(h.hits, x.(globHit)) }
+func (h *globHits) Pop() any {
+	last := h.hits[len(h.hits)-1]
+	h.hits = h.hits[:len(h.hits)-1]
+	return last
+}
+
+func (h *globHits) full() bool {
+	return h.max > 0 && len(h.hits) >= h.max
+}
+
+// beyond reports whether p, and so everything below it, sorts after the
+// worst kept match when sorting by path.
+func (h *globHits) beyond(p string) bool {
+	return !h.byMtime && h.full() && p > h.hits[0].path
+}
+
+func (h *globHits) add(p string, d fs.DirEntry) {
+	hit := globHit{path: p}
+	if h.byMtime {
+		if info, err := d.Info(); err == nil {
+			hit.mtime = info.ModTime()
+		}
+	}
+	if !h.full() {
+		heap.Push(h, hit)
+		return
+	}
+	h.truncated = true
+	if h.better(hit, h.hits[0]) {
+		h.hits[0] = hit
+		heap.Fix(h, 0)
+	}
+}
+
+func (h *globHits) sorted() []string {
+	sort.Slice(h.hits, func(i, j int) bool { return h.better(h.hits[i], h.hits[j]) })
+	out := make([]string, len(h.hits))
+	for i, hit := range h.hits {
+		out[i] = hit.path
+	}
+	return out
+}
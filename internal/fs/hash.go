@@ -0,0 +1,237 @@
+package fs
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math/bits"
+	"os"
+)
+
+const (
+	xxPrime1 uint64 = 11400714785074694791
+	xxPrime2 uint64 = 14029467366897019727
+	xxPrime3 uint64 = 1609587929392839161
+	xxPrime4 uint64 = 9650029242287828579
+	xxPrime5 uint64 = 2870177450012600261
+)
+
+type conflictError string
+
+func (e conflictError) Error() string { return string(e) }
+
+func (e conflictError) Is(target error) bool { return target == ErrConflict }
+
+var ErrHashConflict error = conflictError("expected sha256 does not match")
+
+type Preconditions struct {
+	MTime  int64
+	SHA256 string
+}
+
+type HashResult struct {
+	Path     string `json:"path"`
+	Size     int64  `json:"size"`
+	Offset   int64  `json:"offset"`
+	Length   int64  `json:"length"`
+	MTime    int64  `json:"mtime"`
+	SHA256   string `json:"sha256,omitempty"`
+	XXHash64 string `json:"xxhash64,omitempty"`
+}
+
+type xxh64 struct {
+	v1, v2, v3, v4 uint64
+	total          uint64
+	buf            [32]byte
+	n              int
+}
+
+func NewXXHash64() hash.Hash64 {
+	d := &xxh64{}
+	d.Reset()
+	return d
+}
+
+func (d *xxh64) Reset() {
+	p1, p2 := xxPrime1, xxPrime2
+	d.v1 = p1 + p2
+	d.v2 = p2
+	d.v3 = 0
+	d.v4 = -p1
+	d.total = 0
+	d.n = 0
+}
+
+func (d *xxh64) Size() int      { return 8 }
+func (d *xxh64) BlockSize() int { return 32 }
+
+func xxRound(acc, input uint64) uint64 {
+	acc += input * xxPrime2
+	acc = bits.RotateLeft64(acc, 31)
+	return acc * xxPrime1
+}
+
+func xxMergeRound(acc, val uint64) uint64 {
+	acc ^= xxRound(0, val)
+	return acc*xxPrime1 + xxPrime4
+}
+
+func (d *xxh64) Write(p []byte) (int, error) {
+	n := len(p)
+	d.total += uint64(n)
+	if d.n+len(p) < 32 {
+		d.n += copy(d.buf[d.n:], p)
+		return n, nil
+	}
+	if d.n > 0 {
+		c := copy(d.buf[d.n:], p)
+		d.block(d.buf[:])
+		p = p[c:]
+		d.n = 0
+	}
+	for len(p) >= 32 {
+		d.block(p[:32])
+		p = p[32:]
+	}
+	d.n = copy(d.buf[:], p)
+	return n, nil
+}
+
+func (d *xxh64) block(b []byte) {
+	d.v1 = xxRound(d.v1, binary.LittleEndian.Uint64(b[0:]))
+	d.v2 = xxRound(d.v2, binary.LittleEndian.Uint64(b[8:]))
+	d.v3 = xxRound(d.v3, binary.LittleEndian.Uint64(b[16:]))
+	d.v4 = xxRound(d.v4, binary.LittleEndian.Uint64(b[24:]))
+}
+
+func (d *xxh64) Sum64() uint64 {
+	var h uint64
+	if d.total >= 32 {
+		h = bits.RotateLeft64(d.v1, 1) + bits.RotateLeft64(d.v2, 7) + bits.RotateLeft64(d.v3, 12) + bits.RotateLeft64(d.v4, 18)
+		h = xxMergeRound(h, d.v1)
+		h = xxMergeRound(h, d.v2)
+		h = xxMergeRound(h, d.v3)
+		h = xxMergeRound(h, d.v4)
+	} else {
+		h = xxPrime5
+	}
+	h += d.total
+	b := d.buf[:d.n]
+	for ; len(b) >= 8; b = b[8:] {
+		h ^= xxRound(0, binary.LittleEndian.Uint64(b))
+		h = bits.RotateLeft64(h, 27)*xxPrime1 + xxPrime4
+	}
+	if len(b) >= 4 {
+		h ^= uint64(binary.LittleEndian.Uint32(b)) * xxPrime1
+		h = bits.RotateLeft64(h, 23)*xxPrime2 + xxPrime3
+		b = b[4:]
+	}
+	for _, c := range b {
+		h ^= uint64(c) * xxPrime5
+		h = bits.RotateLeft64(h, 11) * xxPrime1
+	}
+	h ^= h >> 33
+	h *= xxPrime2
+	h ^= h >> 29
+	h *= xxPrime3
+	h ^= h >> 32
+	return h
+}
+
+func (d *xxh64) Sum(b []byte) []byte {
+	return binary.BigEndian.AppendUint64(b, d.Sum64())
+}
+
+func (s *Service) Hash(path string, algorithms []string, offset, length int64) (*HashResult, error) {
+	if len(algorithms) == 0 {
+		algorithms = []string{"sha256"}
+	}
+	var sha, xx hash.Hash
+	writers := []io.Writer{}
+	for _, alg := range algorithms {
+		switch alg {
+		case "sha256":
+			sha = sha256.New()
+			writers = append(writers, sha)
+		case "xxhash64", "xxhash":
+			xx = NewXXHash64()
+			writers = append(writers, xx)
+		default:
+			return nil, fmt.Errorf("unsupported hash algorithm %q", alg)
+		}
+	}
+	f, err := s.open(path, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if st.IsDir() {
+		return nil, errors.New("path is a directory")
+	}
+	if offset < 0 || offset > st.Size() {
+		return nil, fmt.Errorf("offset %d is outside file size %d", offset, st.Size())
+	}
+	size := st.Size() - offset
+	if length > 0 && length < size {
+		size = length
+	}
+	n, err := io.Copy(io.MultiWriter(writers...), io.NewSectionReader(f, offset, size))
+	if err != nil {
+		return nil, err
+	}
+	result := &HashResult{Path: path, Size: st.Size(), Offset: offset, Length: n, MTime: st.ModTime().UnixMilli()}
+	if sha != nil {
+		result.SHA256 = hex.EncodeToString(sha.Sum(nil))
+	}
+	if xx != nil {
+		result.XXHash64 = hex.EncodeToString(xx.Sum(nil))
+	}
+	return result, nil
+}
+
+func (s *Service) SHA256(path string) (string, error) {
+	result, err := s.Hash(path, []string{"sha256"}, 0, 0)
+	if err != nil {
+		return "", err
+	}
+	return result.SHA256, nil
+}
+
+func (s *Service) CheckSHA256(path, expected string) error {
+	if expected == "" {
+		return nil
+	}
+	sum, err := s.SHA256(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: file does not exist", ErrHashConflict)
+	}
+	if err != nil {
+		return err
+	}
+	if sum != expected {
+		return fmt.Errorf("%w: current sha256 is %s", ErrHashConflict, sum)
+	}
+	return nil
+}
+
+func checkContentSHA256(content string, exists bool, expected string) error {
+	if expected == "" {
+		return nil
+	}
+	if !exists {
+		return fmt.Errorf("%w: file does not exist", ErrHashConflict)
+	}
+	sum := sha256.Sum256([]byte(content))
+	if actual := hex.EncodeToString(sum[:]); actual != expected {
+		return fmt.Errorf("%w: current sha256 is %s", ErrHashConflict, actual)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package fs
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var ignoreFileNames = []string{".gitignore", ".ignore"}
+
+type ignoreRule struct {
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+type ignoreNode struct {
+	parent *ignoreNode
+	dir    string
+	rules  []ignoreRule
+}
+
+func loadIgnoreNode(parent *ignoreNode, dir string) *ignoreNode {
+	rules := []ignoreRule{}
+	for _, name := range ignoreFileNames {
+		rules = append(rules, readIgnoreFile(filepath.Join(dir, name))...)
+	}
+	if len(rules) == 0 {
+		return parent
+	}
+	return &ignoreNode{parent: parent, dir: dir, rules: rules}
+}
+
+func loadIgnoreChain(root, boundary string) *ignoreNode {
+	dirs := []string{root}
+	for dir := root; dir != boundary; {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			dirs = dirs[:1]
+			break
+		}
+		dir = parent
+		dirs = append(dirs, dir)
+	}
+	var node *ignoreNode
+	for i := len(dirs) - 1; i >= 0; i-- {
+		node = loadIgnoreNode(node, dirs[i])
+	}
+	return node
+}
+
+func readIgnoreFile(p string) []ignoreRule {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	rules := []ignoreRule{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := ignoreRule{}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			rule.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		rule.pattern = line
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+func (n *ignoreNode) ignored(absPath string, isDir bool) bool {
+	for node := n; node != nil; node = node.parent {
+		rel, err := filepath.Rel(node.dir, absPath)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		for i := len(node.rules) - 1; i >= 0; i-- {
+			rule := node.rules[i]
+			if rule.dirOnly && !isDir {
+				continue
+			}
+			var matched bool
+			if rule.anchored {
+				matched = MatchGlob(rule.pattern, rel)
+			} else {
+				matched = MatchGlob(rule.pattern, path.Base(rel))
+			}
+			if matched {
+				return !rule.negate
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,589 @@
+package fs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultJournalEntries = 100
+	defaultJournalBytes   = 64 << 20
+)
+
+var (
+	ErrJournalDisabled    = errors.New("fs journal is disabled")
+	ErrCheckpointNotFound = errors.New("checkpoint not found")
+	errJournalTooLarge    = errors.New("content exceeds journal budget")
+)
+
+type JournalOptions struct {
+	Enabled    bool
+	MaxEntries int
+	MaxBytes   int64
+}
+
+type journalNode struct {
+	rel    string
+	mode   fs.FileMode
+	data   []byte
+	target string
+}
+
+type journalPath struct {
+	path  string
+	nodes []journalNode
+	after string
+}
+
+type JournalRecord struct {
+	paths    []journalPath
+	size     int64
+	complete bool
+}
+
+type journalEntry struct {
+	seq    int64
+	method string
+	time   time.Time
+	rec    *JournalRecord
+}
+
+type journalCheckpoint struct {
+	name string
+	seq  int64
+	time time.Time
+}
+
+type sessionJournal struct {
+	entries     []*journalEntry
+	checkpoints []journalCheckpoint
+	lastSeq     int64
+	dropped     int64
+	size        int64
+}
+
+type JournalConflict struct {
+	Conflicts []JournalConflictPath `json:"conflicts"`
+}
+
+type JournalConflictPath struct {
+	Path string `json:"path"`
+	Seq  int64  `json:"seq"`
+}
+
+func (e *JournalConflict) Error() string {
+	return fmt.Sprintf("%d journaled path(s) changed outside rexd; set force=true to undo anyway", len(e.Conflicts))
+}
+
+func (e *JournalConflict) Unwrap() error { return ErrConflict }
+
+func (e *JournalConflict) ErrorData() any { return e }
+
+type UndoOptions struct {
+	Checkpoint string
+	Steps      int
+	Force      bool
+	// Check vets every path the undo would write before anything is
+	// restored, so entries recorded under a root that has since become
+	// read-only, denied or unreachable are refused.
+	Check func(path string) error
+}
+
+type UndoneEntry struct {
+	Seq    int64  `json:"seq"`
+	Method string `json:"method"`
+}
+
+type UndoResult struct {
+	Undone     []UndoneEntry         `json:"undone"`
+	Paths      []string              `json:"paths"`
+	Checkpoint string                `json:"checkpoint,omitempty"`
+	Forced     []JournalConflictPath `json:"forced,omitempty"`
+}
+
+func (r *UndoResult) AffectedPaths() []string { return r.Paths }
+
+type JournalManager struct {
+	mu       sync.Mutex
+	fs       *Service
+	opts     JournalOptions
+	sessions map[string]*sessionJournal
+}
+
+func NewJournalManager(fs *Service, opts JournalOptions) *JournalManager {
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = defaultJournalEntries
+	}
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = defaultJournalBytes
+	}
+	return &JournalManager{fs: fs, opts: opts, sessions: map[string]*sessionJournal{}}
+}
+
+func (m *JournalManager) Capture(paths ...string) *JournalRecord {
+	if !m.opts.Enabled {
+		return nil
+	}
+	rec := &JournalRecord{complete: true}
+	for _, path := range journalRoots(paths) {
+		jp := journalPath{path: path}
+		if rec.complete {
+			nodes, size, err := m.snapshot(path, m.opts.MaxBytes-rec.size)
+			if err != nil {
+				rec.complete = false
+				for i := range rec.paths {
+					rec.paths[i].nodes = nil
+				}
+				rec.size = 0
+			} else {
+				jp.nodes = nodes
+				rec.size += size
+			}
+		}
+		rec.paths = append(rec.paths, jp)
+	}
+	return rec
+}
+
+func journalRoots(paths []string) []string {
+	candidates := make([]string, 0, len(paths))
+	for _, path := range paths {
+		path = filepath.Clean(path)
+		for {
+			parent := filepath.Dir(path)
+			if parent == path {
+				break
+			}
+			if _, err := os.Lstat(path); !errors.Is(err, os.ErrNotExist) {
+				break
+			}
+			if _, err := os.Lstat(parent); !errors.Is(err, os.ErrNotExist) {
+				break
+			}
+			path = parent
+		}
+		candidates = append(candidates, path)
+	}
+	sort.Strings(candidates)
+	roots := []string{}
+	for _, path := range candidates {
+		covered := false
+		for _, root := range roots {
+			if path == root || pathWithin(path, root) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			roots = append(roots, path)
+		}
+	}
+	return roots
+}
+
+func pathWithin(path, root string) bool {
+	return strings.HasPrefix(path, strings.TrimSuffix(root, string(filepath.Separator))+string(filepath.Separator))
+}
+
+func (m *JournalManager) snapshot(root string, budget int64) ([]journalNode, int64, error) {
+	if _, err := os.Lstat(root); errors.Is(err, os.ErrNotExist) {
+		return nil, 0, nil
+	}
+	var nodes []journalNode
+	var size int64
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		node := journalNode{rel: rel, mode: info.Mode()}
+		switch {
+		case info.Mode().IsRegular():
+			if size+info.Size() > budget {
+				return errJournalTooLarge
+			}
+			if node.data, err = m.fs.ReadFile(path); err != nil {
+				return err
+			}
+			size += int64(len(node.data))
+		case info.Mode()&fs.ModeSymlink != 0:
+			if node.target, err = os.Readlink(path); err != nil {
+				return err
+			}
+		case !info.IsDir():
+			return nil
+		}
+		nodes = append(nodes, node)
+		return nil
+	})
+	return nodes, size, err
+}
+
+func fingerprint(root string) string {
+	if _, err := os.Lstat(root); errors.Is(err, os.ErrNotExist) {
+		return ""
+	}
+	h := sha256.New()
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		fmt.Fprintf(h, "%s\x00%v\x00", rel, info.Mode())
+		if info.Mode().IsRegular() {
+			fmt.Fprintf(h, "%d\x00%d\x00", info.Size(), info.ModTime().UnixNano())
+		}
+		return nil
+	})
+	if err != nil {
+		return "error:" + err.Error()
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (m *JournalManager) Record(sessionID, method string, rec *JournalRecord) {
+	if rec == nil {
+		return
+	}
+	for i := range rec.paths {
+		rec.paths[i].after = fingerprint(rec.paths[i].path)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j := m.sessions[sessionID]
+	if j == nil {
+		j = &sessionJournal{}
+		m.sessions[sessionID] = j
+	}
+	j.lastSeq++
+	j.entries = append(j.entries, &journalEntry{seq: j.lastSeq, method: method, time: time.Now().UTC(), rec: rec})
+	j.size += rec.size
+	for len(j.entries) > 0 && (len(j.entries) > m.opts.MaxEntries || j.size > m.opts.MaxBytes) {
+		j.size -= j.entries[0].rec.size
+		j.dropped = j.entries[0].seq
+		j.entries = j.entries[1:]
+	}
+	kept := j.checkpoints[:0]
+	for _, cp := range j.checkpoints {
+		if cp.seq >= j.dropped {
+			kept = append(kept, cp)
+		}
+	}
+	j.checkpoints = kept
+}
+
+func (m *JournalManager) journal(sessionID string) (*sessionJournal, error) {
+	if !m.opts.Enabled {
+		return nil, ErrJournalDisabled
+	}
+	j := m.sessions[sessionID]
+	if j == nil {
+		j = &sessionJournal{}
+		m.sessions[sessionID] = j
+	}
+	return j, nil
+}
+
+func (m *JournalManager) Checkpoint(sessionID, name string) (map[string]any, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, err := m.journal(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		name = fmt.Sprintf("checkpoint-%d", len(j.checkpoints)+1)
+	}
+	cp := journalCheckpoint{name: name, seq: j.lastSeq, time: time.Now().UTC()}
+	kept := j.checkpoints[:0]
+	for _, existing := range j.checkpoints {
+		if existing.name != name {
+			kept = append(kept, existing)
+		}
+	}
+	j.checkpoints = append(kept, cp)
+	return map[string]any{"name": cp.name, "seq": cp.seq, "time": cp.time.UnixMilli()}, nil
+}
+
+func (m *JournalManager) History(sessionID string, limit int) (map[string]any, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, err := m.journal(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	entries := j.entries
+	if limit > 0 && len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	outEntries := make([]map[string]any, 0, len(entries))
+	for _, e := range entries {
+		paths := make([]string, 0, len(e.rec.paths))
+		for _, jp := range e.rec.paths {
+			paths = append(paths, jp.path)
+		}
+		outEntries = append(outEntries, map[string]any{
+			"seq":      e.seq,
+			"method":   e.method,
+			"time":     e.time.UnixMilli(),
+			"paths":    paths,
+			"bytes":    e.rec.size,
+			"undoable": e.rec.complete,
+		})
+	}
+	checkpoints := make([]map[string]any, 0, len(j.checkpoints))
+	for _, cp := range j.checkpoints {
+		checkpoints = append(checkpoints, map[string]any{"name": cp.name, "seq": cp.seq, "time": cp.time.UnixMilli()})
+	}
+	return map[string]any{
+		"entries":     outEntries,
+		"checkpoints": checkpoints,
+		"total":       len(j.entries),
+		"bytes":       j.size,
+	}, nil
+}
+
+func (m *JournalManager) Undo(sessionID string, opts UndoOptions) (*UndoResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, err := m.journal(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	count := opts.Steps
+	if opts.Checkpoint != "" {
+		var cp *journalCheckpoint
+		for i := range j.checkpoints {
+			if j.checkpoints[i].name == opts.Checkpoint {
+				cp = &j.checkpoints[i]
+			}
+		}
+		if cp == nil {
+			return nil, fmt.Errorf("%w: %s", ErrCheckpointNotFound, opts.Checkpoint)
+		}
+		count = 0
+		for _, e := range j.entries {
+			if e.seq > cp.seq {
+				count++
+			}
+		}
+	} else if count <= 0 {
+		count = 1
+	}
+	if count > len(j.entries) {
+		return nil, fmt.Errorf("cannot undo %d mutations; %d are journaled", count, len(j.entries))
+	}
+
+	undo := j.entries[len(j.entries)-count:]
+	result := &UndoResult{Undone: []UndoneEntry{}, Paths: []string{}, Checkpoint: opts.Checkpoint}
+	conflicts := []JournalConflictPath{}
+	for i, e := range undo {
+		if !e.rec.complete {
+			return nil, fmt.Errorf("mutation %d (%s) was too large to journal and cannot be undone", e.seq, e.method)
+		}
+		for _, jp := range e.rec.paths {
+			if touchedLater(undo[i+1:], jp.path) {
+				continue
+			}
+			if fingerprint(jp.path) != jp.after {
+				conflicts = append(conflicts, JournalConflictPath{Path: jp.path, Seq: e.seq})
+			}
+		}
+	}
+	if opts.Check != nil {
+		for _, e := range undo {
+			for _, jp := range e.rec.paths {
+				if err := checkJournalPath(jp, opts.Check); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	if len(conflicts) > 0 {
+		if !opts.Force {
+			return nil, &JournalConflict{Conflicts: conflicts}
+		}
+		result.Forced = conflicts
+	}
+
+	seen := map[string]bool{}
+	for i := len(undo) - 1; i >= 0; i-- {
+		e := undo[i]
+		for _, jp := range e.rec.paths {
+			if err := m.restore(jp); err != nil {
+				j.truncate(undo[i+1:])
+				j.refresh(result.Paths)
+				return nil, fmt.Errorf("undo of mutation %d (%s) failed at %s: %w", e.seq, e.method, jp.path, err)
+			}
+			if !seen[jp.path] {
+				seen[jp.path] = true
+				result.Paths = append(result.Paths, jp.path)
+			}
+		}
+		result.Undone = append(result.Undone, UndoneEntry{Seq: e.seq, Method: e.method})
+	}
+	j.truncate(undo)
+	j.refresh(result.Paths)
+	return result, nil
+}
+
+func checkJournalPath(jp journalPath, check func(string) error) error {
+	if err := check(jp.path); err != nil {
+		return err
+	}
+	for _, node := range jp.nodes {
+		if node.rel == "." {
+			continue
+		}
+		if err := check(filepath.Join(jp.path, node.rel)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (j *sessionJournal) refresh(restored []string) {
+	for _, e := range j.entries {
+		for i, jp := range e.rec.paths {
+			for _, path := range restored {
+				if jp.path == path || pathWithin(jp.path, path) || pathWithin(path, jp.path) {
+					e.rec.paths[i].after = fingerprint(jp.path)
+					break
+				}
+			}
+		}
+	}
+}
+
+func touchedLater(entries []*journalEntry, path string) bool {
+	for _, e := range entries {
+		for _, jp := range e.rec.paths {
+			if jp.path == path || pathWithin(jp.path, path) || pathWithin(path, jp.path) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (j *sessionJournal) truncate(undone []*journalEntry) {
+	if len(undone) == 0 {
+		return
+	}
+	for _, e := range undone {
+		j.size -= e.rec.size
+	}
+	j.entries = j.entries[:len(j.entries)-len(undone)]
+	tail := undone[0].seq - 1
+	kept := j.checkpoints[:0]
+	for _, cp := range j.checkpoints {
+		if cp.seq <= tail {
+			kept = append(kept, cp)
+		}
+	}
+	j.checkpoints = kept
+}
+
+func (m *JournalManager) restore(jp journalPath) error {
+	if len(jp.nodes) == 0 {
+		return m.fs.removeAll(jp.path)
+	}
+	if first := jp.nodes[0]; len(jp.nodes) == 1 && first.mode.IsRegular() {
+		if st, err := os.Lstat(jp.path); err == nil && st.Mode().IsRegular() {
+			if _, err := m.fs.Write(jp.path, first.data, WriteOptions{Mode: "replace", Atomic: true}); err != nil {
+				return err
+			}
+			return m.fs.chmod(jp.path, first.mode.Perm())
+		}
+	}
+	if err := m.fs.removeAll(jp.path); err != nil {
+		return err
+	}
+	if err := m.fs.mkdirAll(filepath.Dir(jp.path), 0755); err != nil {
+		return err
+	}
+	var dirs []journalNode
+	for _, node := range jp.nodes {
+		path := filepath.Join(jp.path, node.rel)
+		switch {
+		case node.mode.IsDir():
+			if err := m.fs.mkdir(path, 0700); err != nil {
+				return err
+			}
+			dirs = append(dirs, node)
+		case node.mode&fs.ModeSymlink != 0:
+			if err := m.fs.symlink(node.target, path); err != nil {
+				return err
+			}
+		default:
+			if err := m.fs.writeFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, node.data, 0600); err != nil {
+				return err
+			}
+			if err := m.fs.chmod(path, node.mode.Perm()); err != nil {
+				return err
+			}
+		}
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := m.fs.chmod(filepath.Join(jp.path, dirs[i].rel), dirs[i].mode.Perm()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *JournalManager) CloseSession(sessionID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, sessionID)
+}
+
+// Prune drops every journal entry that touched a path under root, for roots
+// such as worktrees that are going away.
+func (m *JournalManager) Prune(sessionID, root string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.sessions[sessionID]
+	if !ok {
+		return
+	}
+	kept := j.entries[:0]
+	for _, e := range j.entries {
+		if !journalsUnder(e, root) {
+			kept = append(kept, e)
+			continue
+		}
+		j.size -= e.rec.size
+	}
+	clear(j.entries[len(kept):])
+	j.entries = kept
+}
+
+func journalsUnder(e *journalEntry, root string) bool {
+	for _, jp := range e.rec.paths {
+		if jp.path == root || pathWithin(jp.path, root) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package fs
+
+import (
+	"path"
+	"strings"
+)
+
+func ExpandBraces(pattern string) []string {
+	start := -1
+	depth := 0
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '{':
+			if depth == 0 {
+				start = i
+			}
+			depth++
+		case '}':
+			if depth == 0 {
+				continue
+			}
+			depth--
+			if depth != 0 {
+				continue
+			}
+			alternatives := splitBraceAlternatives(pattern[start+1 : i])
+			if len(alternatives) < 2 {
+				start = -1
+				continue
+			}
+			out := []string{}
+			for _, alt := range alternatives {
+				out = append(out, ExpandBraces(pattern[:start]+alt+pattern[i+1:])...)
+			}
+			return out
+		}
+	}
+	return []string{pattern}
+}
+
+func splitBraceAlternatives(s string) []string {
+	parts := []string{}
+	depth := 0
+	last := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, s[last:i])
+				last = i + 1
+			}
+		}
+	}
+	return append(parts, s[last:])
+}
+
+func MatchGlob(pattern, name string) bool {
+	for _, p := range ExpandBraces(pattern) {
+		if matchSegments(strings.Split(p, "/"), strings.Split(name, "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			rest := pattern[1:]
+			for len(rest) > 0 && rest[0] == "**" {
+				rest = rest[1:]
+			}
+			if len(rest) == 0 {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(rest, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		ok, err := path.Match(pattern[0], name[0])
+		if err != nil || !ok {
+			return false
+		}
+		pattern = pattern[1:]
+		name = name[1:]
+	}
+	return len(name) == 0
+}
+
+func matchFilter(patterns []string, rel string) bool {
+	for _, p := range patterns {
+		if strings.Contains(strings.TrimPrefix(p, "**/"), "/") {
+			if MatchGlob(p, rel) {
+				return true
+			}
+			continue
+		}
+		if MatchGlob(strings.TrimPrefix(p, "**/"), path.Base(rel)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,370 @@
+package fs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+const defaultRemoveMaxEntries = 10000
+
+var ErrDestinationExists = errors.New("destination already exists; set overwrite=true")
+
+type MoveResult struct {
+	From        string `json:"from"`
+	To          string `json:"to"`
+	Overwritten bool   `json:"overwritten"`
+	MTime       int64  `json:"mtime"`
+}
+
+type CopyResult struct {
+	From        string `json:"from"`
+	To          string `json:"to"`
+	Files       int    `json:"files"`
+	Dirs        int    `json:"dirs"`
+	Bytes       int64  `json:"bytes"`
+	Overwritten bool   `json:"overwritten"`
+}
+
+type RemoveResult struct {
+	Path    string `json:"path"`
+	Removed int    `json:"removed"`
+}
+
+type MkdirResult struct {
+	Path    string `json:"path"`
+	Created bool   `json:"created"`
+	MTime   int64  `json:"mtime"`
+}
+
+func (r *MoveResult) AffectedPaths() []string   { return []string{r.From, r.To} }
+func (r *CopyResult) AffectedPaths() []string   { return []string{r.From, r.To} }
+func (r *RemoveResult) AffectedPaths() []string { return []string{r.Path} }
+func (r *MkdirResult) AffectedPaths() []string  { return []string{r.Path} }
+
+func checkDistinct(from, to string) error {
+	if from == to {
+		return errors.New("source and destination are the same path")
+	}
+	return nil
+}
+
+func checkMTime(path string, expectedMTime int64) (fs.FileInfo, error) {
+	st, err := os.Lstat(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) && expectedMTime > 0 {
+			return nil, ErrConflict
+		}
+		return nil, err
+	}
+	if expectedMTime > 0 && st.ModTime().UnixMilli() != expectedMTime {
+		return nil, ErrConflict
+	}
+	return st, nil
+}
+
+func (s *Service) prepareDestination(to string, overwrite, mkdirParents bool, expectedMTime int64) (bool, error) {
+	if mkdirParents {
+		if err := s.mkdirAll(filepath.Dir(to), 0755); err != nil {
+			return false, err
+		}
+	}
+	st, err := os.Lstat(to)
+	if errors.Is(err, os.ErrNotExist) {
+		if expectedMTime > 0 {
+			return false, ErrConflict
+		}
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !overwrite {
+		return false, ErrDestinationExists
+	}
+	if expectedMTime > 0 && st.ModTime().UnixMilli() != expectedMTime {
+		return false, ErrConflict
+	}
+	return true, nil
+}
+
+func isWithin(root, p string) bool {
+	return p == root || strings.HasPrefix(p, strings.TrimSuffix(root, string(filepath.Separator))+string(filepath.Separator))
+}
+
+func (s *Service) Move(from, to string, overwrite, mkdirParents bool, expectedMTime, expectedDestMTime int64) (*MoveResult, error) {
+	if err := checkDistinct(from, to); err != nil {
+		return nil, err
+	}
+	st, err := checkMTime(from, expectedMTime)
+	if err != nil {
+		return nil, err
+	}
+	if st.IsDir() && isWithin(from, to) {
+		return nil, errors.New("cannot move a directory into itself")
+	}
+	existed, err := s.prepareDestination(to, overwrite, mkdirParents, expectedDestMTime)
+	if err != nil {
+		return nil, err
+	}
+	aside := ""
+	if existed {
+		dst, err := os.Lstat(to)
+		if err != nil {
+			return nil, err
+		}
+		if dst.IsDir() || st.IsDir() {
+			if aside, err = asidePath(to); err != nil {
+				return nil, err
+			}
+			if err := s.rename(to, aside); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := s.moveEntry(from, to); err != nil {
+		if aside != "" {
+			_ = s.removeAll(to)
+			_ = s.rename(aside, to)
+		}
+		return nil, err
+	}
+	if aside != "" {
+		_ = s.removeAll(aside)
+	}
+	after, err := os.Lstat(to)
+	if err != nil {
+		return nil, err
+	}
+	return &MoveResult{From: from, To: to, Overwritten: existed, MTime: after.ModTime().UnixMilli()}, nil
+}
+
+func (s *Service) moveEntry(from, to string) error {
+	err := s.rename(from, to)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	if _, err := s.copyTree(from, to, true); err != nil {
+		return err
+	}
+	return s.removeAll(from)
+}
+
+func asidePath(path string) (string, error) {
+	var suffix [6]byte
+	if _, err := rand.Read(suffix[:]); err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".rexd-"+hex.EncodeToString(suffix[:])+".old"), nil
+}
+
+func (s *Service) Copy(from, to string, recursive, overwrite, mkdirParents bool, expectedMTime, expectedDestMTime int64) (*CopyResult, error) {
+	if err := checkDistinct(from, to); err != nil {
+		return nil, err
+	}
+	st, err := checkMTime(from, expectedMTime)
+	if err != nil {
+		return nil, err
+	}
+	if st.IsDir() {
+		if !recursive {
+			return nil, errors.New("source is a directory; set recursive=true")
+		}
+		if isWithin(from, to) {
+			return nil, errors.New("cannot copy a directory into itself")
+		}
+	}
+	existed, err := s.prepareDestination(to, overwrite, mkdirParents, expectedDestMTime)
+	if err != nil {
+		return nil, err
+	}
+	if existed {
+		if dst, err := os.Lstat(to); err == nil && dst.IsDir() != st.IsDir() {
+			if err := s.removeAll(to); err != nil {
+				return nil, err
+			}
+		}
+	}
+	result, err := s.copyTree(from, to, overwrite)
+	if err != nil {
+		return nil, err
+	}
+	result.From = from
+	result.To = to
+	result.Overwritten = existed
+	return result, nil
+}
+
+func (s *Service) copyTree(from, to string, overwrite bool) (*CopyResult, error) {
+	result := &CopyResult{}
+	dirs := []string{}
+	dirInfo := map[string]fs.FileInfo{}
+	err := filepath.WalkDir(from, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p != from && s.denied(p) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(from, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(to, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			if err := s.mkdirAll(target, info.Mode().Perm()|0700); err != nil {
+				return err
+			}
+			dirs = append(dirs, target)
+			dirInfo[target] = info
+			result.Dirs++
+		case d.Type()&os.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			if overwrite {
+				_ = s.remove(target)
+			}
+			if err := s.symlink(link, target); err != nil {
+				return err
+			}
+			result.Files++
+		case d.Type().IsRegular():
+			n, err := s.copyFile(p, target, info)
+			if err != nil {
+				return err
+			}
+			result.Files++
+			result.Bytes += n
+		default:
+			return fmt.Errorf("cannot copy special file %s", p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		info := dirInfo[dirs[i]]
+		_ = s.chmod(dirs[i], info.Mode().Perm())
+		_ = s.chtimes(dirs[i], info.ModTime())
+	}
+	return result, nil
+}
+
+func (s *Service) copyFile(from, to string, info fs.FileInfo) (int64, error) {
+	src, err := s.open(from, os.O_RDONLY, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+	dst, err := s.open(to, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(dst, src)
+	if err != nil {
+		_ = dst.Close()
+		return n, err
+	}
+	if err := dst.Close(); err != nil {
+		return n, err
+	}
+	if err := s.chmod(to, info.Mode().Perm()); err != nil {
+		return n, err
+	}
+	return n, s.chtimes(to, info.ModTime())
+}
+
+func (s *Service) Remove(path string, recursive bool, maxEntries int, expectedMTime int64) (*RemoveResult, error) {
+	st, err := checkMTime(path, expectedMTime)
+	if err != nil {
+		return nil, err
+	}
+	if !st.IsDir() {
+		if err := s.remove(path); err != nil {
+			return nil, err
+		}
+		return &RemoveResult{Path: path, Removed: 1}, nil
+	}
+	if !recursive {
+		if err := s.remove(path); err != nil {
+			if errors.Is(err, syscall.ENOTEMPTY) || errors.Is(err, syscall.EEXIST) {
+				return nil, errors.New("directory is not empty; set recursive=true")
+			}
+			return nil, err
+		}
+		return &RemoveResult{Path: path, Removed: 1}, nil
+	}
+	if maxEntries <= 0 {
+		maxEntries = defaultRemoveMaxEntries
+	}
+	count := 0
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		count++
+		if count > maxEntries {
+			return fmt.Errorf("refusing to remove more than %d entries; raise max_entries", maxEntries)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.removeAll(path); err != nil {
+		return nil, err
+	}
+	return &RemoveResult{Path: path, Removed: count}, nil
+}
+
+func (s *Service) Mkdir(path string, parents bool, expectedMTime int64) (*MkdirResult, error) {
+	created := true
+	if st, err := os.Lstat(path); err == nil {
+		if !st.IsDir() {
+			return nil, errors.New("path exists and is not a directory")
+		}
+		if expectedMTime > 0 && st.ModTime().UnixMilli() != expectedMTime {
+			return nil, ErrConflict
+		}
+		if !parents {
+			return nil, errors.New("directory already exists; set parents=true to allow")
+		}
+		created = false
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	} else if expectedMTime > 0 {
+		return nil, ErrConflict
+	}
+	if created {
+		mkdir := s.mkdir
+		if parents {
+			mkdir = s.mkdirAll
+		}
+		if err := mkdir(path, 0755); err != nil {
+			return nil, err
+		}
+	}
+	st, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	return &MkdirResult{Path: path, Created: created, MTime: st.ModTime().UnixMilli()}, nil
+}
@@ -3,6 +3,7 @@ package fs
 import (
 	"errors"
 	"fmt"
+	"os"
 	"strings"
 )
 
@@ -16,14 +17,20 @@ type PatchChunk struct {
 	NewLines      []string
 	ChangeContext string
 	IsEndOfFile   bool
+	OldStart      int
+	HasRange      bool
+	OldNoEOL      bool
+	NewNoEOL      bool
 }
 
 type PatchHunk struct {
-	Type     string
-	Path     string
-	MovePath string
-	Contents string
-	Chunks   []PatchChunk
+	Type        string
+	Path        string
+	MovePath    string
+	Contents    string
+	Chunks      []PatchChunk
+	Mode        os.FileMode
+	ExplicitEOL bool
 }
 
 type patchReplacement struct {
@@ -200,13 +207,31 @@ func DerivePatchedContent(original string, chunks []PatchChunk) (string, error)
 		result = append(head, result[replacementEnd:]...)
 	}
 
-	if len(result) == 0 || result[len(result)-1] != "" {
+	if finalNewline(original, chunks) && (len(result) == 0 || result[len(result)-1] != "") {
 		result = append(result, "")
 	}
 
 	return strings.Join(result, "\n"), nil
 }
 
+func finalNewline(original string, chunks []PatchChunk) bool {
+	ranged := false
+	eol := original == "" || strings.HasSuffix(original, "\n") || strings.HasSuffix(original, "\r")
+	for _, chunk := range chunks {
+		if !chunk.HasRange {
+			continue
+		}
+		ranged = true
+		switch {
+		case chunk.NewNoEOL:
+			eol = false
+		case chunk.OldNoEOL:
+			eol = true
+		}
+	}
+	return !ranged || eol
+}
+
 func splitPatchLines(content string) []string {
 	normalized := strings.ReplaceAll(content, "\r\n", "\n")
 	normalized = strings.ReplaceAll(normalized, "\r", "\n")
@@ -221,15 +246,28 @@ func computePatchReplacements(originalLines []string, chunks []PatchChunk) ([]pa
 	replacements := make([]patchReplacement, 0, len(chunks))
 	lineIndex := 0
 
-	for _, chunk := range chunks {
+	for index, chunk := range chunks {
 		if chunk.ChangeContext != "" {
 			contextIndex := seekSequence(originalLines, []string{chunk.ChangeContext}, lineIndex, false)
 			if contextIndex == -1 {
-				return nil, fmt.Errorf("failed to find patch context %q", chunk.ChangeContext)
+				failure := notFoundFailure(fmt.Sprintf("failed to find patch context %q", chunk.ChangeContext), originalLines, []string{chunk.ChangeContext})
+				failure.ChunkIndex = intPtr(index)
+				return nil, failure
 			}
 			lineIndex = contextIndex + 1
 		}
 
+		if chunk.HasRange {
+			replacement, err := locateRangedChunk(originalLines, chunk, lineIndex)
+			if err != nil {
+				err.ChunkIndex = intPtr(index)
+				return nil, err
+			}
+			replacements = append(replacements, replacement)
+			lineIndex = replacement.Start + replacement.OldLen
+			continue
+		}
+
 		if len(chunk.OldLines) == 0 {
 			replacements = append(replacements, patchReplacement{
 				Start:   len(originalLines),
@@ -252,7 +290,9 @@ func computePatchReplacements(originalLines []string, chunks []PatchChunk) ([]pa
 		}
 
 		if found == -1 {
-			return nil, fmt.Errorf("failed to find expected patch lines")
+			failure := notFoundFailure("failed to find expected patch lines", originalLines, chunk.OldLines)
+			failure.ChunkIndex = intPtr(index)
+			return nil, failure
 		}
 
 		replacements = append(replacements, patchReplacement{
@@ -266,27 +306,27 @@ func computePatchReplacements(originalLines []string, chunks []PatchChunk) ([]pa
 	return replacements, nil
 }
 
+var lineComparators = []func(a, b string) bool{
+	func(a, b string) bool {
+		return a == b
+	},
+	func(a, b string) bool {
+		return strings.TrimRight(a, " \t") == strings.TrimRight(b, " \t")
+	},
+	func(a, b string) bool {
+		return strings.TrimSpace(a) == strings.TrimSpace(b)
+	},
+}
+
 func seekSequence(lines, pattern []string, startIndex int, endOfFile bool) int {
 	if len(pattern) == 0 {
 		return -1
 	}
 
-	if exact := tryMatch(lines, pattern, startIndex, endOfFile, func(a, b string) bool {
-		return a == b
-	}); exact != -1 {
-		return exact
-	}
-
-	if rstrip := tryMatch(lines, pattern, startIndex, endOfFile, func(a, b string) bool {
-		return strings.TrimRight(a, " \t") == strings.TrimRight(b, " \t")
-	}); rstrip != -1 {
-		return rstrip
-	}
-
-	if trimmed := tryMatch(lines, pattern, startIndex, endOfFile, func(a, b string) bool {
-		return strings.TrimSpace(a) == strings.TrimSpace(b)
-	}); trimmed != -1 {
-		return trimmed
+	for _, compare := range lineComparators {
+		if found := tryMatch(lines, pattern, startIndex, endOfFile, compare); found != -1 {
+			return found
+		}
 	}
 
 	return -1
@@ -0,0 +1,270 @@
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+type PatchMove struct {
+	From string
+	To   string
+}
+
+type PatchFileDiff struct {
+	Path   string
+	Status string
+	Diff   string
+	Hunks  []DiffHunk
+}
+
+type patchFile struct {
+	path   string
+	exists bool
+	data   []byte
+	orig   []byte
+	info   fs.FileInfo
+	perm   os.FileMode
+}
+
+type PatchPlan struct {
+	Added   []string
+	Updated []string
+	Deleted []string
+	Moved   []PatchMove
+	files   map[string]*patchFile
+	order   []string
+}
+
+func (p *PatchPlan) file(s *Service, path string) (*patchFile, error) {
+	if f, ok := p.files[path]; ok {
+		return f, nil
+	}
+	f := &patchFile{path: path}
+	st, err := os.Lstat(path)
+	switch {
+	case err == nil:
+		if st.IsDir() {
+			return nil, fmt.Errorf("%s: is a directory", path)
+		}
+		data, err := s.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		f.exists, f.info, f.data, f.orig = true, st, data, data
+	case !errors.Is(err, os.ErrNotExist):
+		return nil, err
+	}
+	p.files[path] = f
+	p.order = append(p.order, path)
+	return f, nil
+}
+
+func (s *Service) PlanPatch(hunks []PatchHunk, resolve func(string) (string, error)) (*PatchPlan, error) {
+	plan := &PatchPlan{
+		Added:   []string{},
+		Updated: []string{},
+		Deleted: []string{},
+		Moved:   []PatchMove{},
+		files:   map[string]*patchFile{},
+	}
+	for index, hunk := range hunks {
+		absPath, err := resolve(hunk.Path)
+		if err != nil {
+			return nil, err
+		}
+		f, err := plan.file(s, absPath)
+		if err != nil {
+			return nil, err
+		}
+
+		switch hunk.Type {
+		case "add":
+			if f.exists {
+				return nil, &fs.PathError{Op: "create", Path: absPath, Err: fs.ErrExist}
+			}
+			content := hunk.Contents
+			if !hunk.ExplicitEOL && content != "" && !strings.HasSuffix(content, "\n") {
+				content += "\n"
+			}
+			f.exists, f.data, f.perm = true, []byte(content), hunk.Mode
+			plan.Added = append(plan.Added, absPath)
+
+		case "delete":
+			if !f.exists {
+				return nil, &fs.PathError{Op: "delete", Path: absPath, Err: fs.ErrNotExist}
+			}
+			f.exists, f.data = false, nil
+			plan.Deleted = append(plan.Deleted, absPath)
+
+		case "update":
+			if !f.exists {
+				return nil, &fs.PathError{Op: "update", Path: absPath, Err: fs.ErrNotExist}
+			}
+			next := f.data
+			if len(hunk.Chunks) > 0 {
+				text, format := DecodeText(f.data)
+				if format.Mixed {
+					return nil, fmt.Errorf("%s: %w", hunk.Path, ErrMixedLineEndings)
+				}
+				patched, err := DerivePatchedContent(text, hunk.Chunks)
+				if err != nil {
+					var failure *MatchFailure
+					if errors.As(err, &failure) {
+						failure.Path, failure.HunkIndex = hunk.Path, intPtr(index)
+					}
+					return nil, fmt.Errorf("%s: %w", hunk.Path, err)
+				}
+				if next, err = format.Encode(patched); err != nil {
+					return nil, fmt.Errorf("%s: %w", hunk.Path, err)
+				}
+			}
+
+			if hunk.Mode != 0 {
+				f.perm = hunk.Mode
+			}
+			if hunk.MovePath == "" {
+				f.data = next
+				plan.Updated = append(plan.Updated, absPath)
+				continue
+			}
+			movePath, err := resolve(hunk.MovePath)
+			if err != nil {
+				return nil, err
+			}
+			if movePath == absPath {
+				f.data = next
+				plan.Updated = append(plan.Updated, absPath)
+				continue
+			}
+			dest, err := plan.file(s, movePath)
+			if err != nil {
+				return nil, err
+			}
+			dest.exists, dest.data, dest.perm = true, next, f.currentPerm()
+			f.exists, f.data, f.perm = false, nil, 0
+			plan.Moved = append(plan.Moved, PatchMove{From: absPath, To: movePath})
+
+		default:
+			return nil, fmt.Errorf("unsupported patch hunk type %q", hunk.Type)
+		}
+	}
+	return plan, nil
+}
+
+func (f *patchFile) currentPerm() os.FileMode {
+	if f.perm == 0 && f.info != nil {
+		return f.info.Mode().Perm()
+	}
+	return f.perm
+}
+
+func (f *patchFile) changed() bool {
+	if f.exists != (f.info != nil) {
+		return true
+	}
+	if f.exists && f.perm != 0 && f.perm != f.info.Mode().Perm() {
+		return true
+	}
+	return f.exists && string(f.data) != string(f.orig)
+}
+
+func (p *PatchPlan) Paths() []string {
+	return append([]string(nil), p.order...)
+}
+
+func (p *PatchPlan) Diffs(opts DiffOptions) []PatchFileDiff {
+	diffs := []PatchFileDiff{}
+	for _, path := range p.order {
+		f := p.files[path]
+		if !f.changed() {
+			continue
+		}
+		oldName, newName, status := path, path, "modified"
+		switch {
+		case f.info == nil:
+			oldName, status = "/dev/null", "added"
+		case !f.exists:
+			newName, status = "/dev/null", "deleted"
+		}
+		before, _ := DecodeText(f.orig)
+		after, _ := DecodeText(f.data)
+		diff := ComputeDiff(oldName, newName, before, after, opts)
+		diffs = append(diffs, PatchFileDiff{Path: path, Status: status, Diff: diff.Diff, Hunks: diff.Hunks})
+	}
+	return diffs
+}
+
+func (s *Service) CommitPatch(plan *PatchPlan) error {
+	var writes, removes []*patchFile
+	for _, path := range plan.order {
+		f := plan.files[path]
+		if !f.changed() {
+			continue
+		}
+		if f.exists {
+			writes = append(writes, f)
+		} else {
+			removes = append(removes, f)
+		}
+	}
+
+	done := make([]*patchFile, 0, len(writes)+len(removes))
+	fail := func(err error) error {
+		if rbErr := s.rollbackPatch(done); rbErr != nil {
+			return fmt.Errorf("%w; rollback failed: %v", err, rbErr)
+		}
+		return err
+	}
+	for _, f := range writes {
+		opts := WriteOptions{Mode: "replace", MkdirParents: true, Atomic: true, Perm: f.perm}
+		if f.info == nil {
+			opts.Mode = "create"
+		} else {
+			opts.Pre.MTime = f.info.ModTime().UnixMilli()
+		}
+		if _, err := s.Write(f.path, f.data, opts); err != nil {
+			return fail(withPath(f.path, err))
+		}
+		done = append(done, f)
+	}
+	for _, f := range removes {
+		if _, err := checkMTime(f.path, f.info.ModTime().UnixMilli()); err != nil {
+			return fail(withPath(f.path, err))
+		}
+		if err := s.remove(f.path); err != nil {
+			return fail(err)
+		}
+		done = append(done, f)
+	}
+	return nil
+}
+
+func withPath(path string, err error) error {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return err
+	}
+	return fmt.Errorf("%s: %w", path, err)
+}
+
+func (s *Service) rollbackPatch(done []*patchFile) error {
+	var errs []error
+	for i := len(done) - 1; i >= 0; i-- {
+		f := done[i]
+		if f.info == nil {
+			if err := s.remove(f.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		opts := WriteOptions{Mode: "replace", MkdirParents: true, Atomic: true}
+		opts.Perm = f.info.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+		if _, err := s.Write(f.path, f.orig, opts); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
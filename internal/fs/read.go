@@ -0,0 +1,235 @@
+package fs
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+const mimeSniffBytes = 512
+
+var ErrBinaryFile = errors.New("file appears to be binary")
+
+type ReadOptions struct {
+	Encoding      string
+	Offset        int64
+	Length        int64
+	StartLine     int
+	MaxLines      int
+	LineNumbers   bool
+	MaxLineLength int
+	OnBinary      string
+}
+
+func (o ReadOptions) lineMode() bool {
+	return o.StartLine > 0 || o.MaxLines > 0 || o.LineNumbers || o.MaxLineLength > 0
+}
+
+func DetectMIME(path string, sniff []byte) string {
+	if len(sniff) > mimeSniffBytes {
+		sniff = sniff[:mimeSniffBytes]
+	}
+	detected := http.DetectContentType(sniff)
+	if strings.HasPrefix(detected, "text/plain") || detected == "application/octet-stream" {
+		if byExt := mime.TypeByExtension(filepath.Ext(path)); byExt != "" {
+			return byExt
+		}
+	}
+	return detected
+}
+
+func textReader(f *os.File, format TextFormat) (io.Reader, error) {
+	skip := int64(0)
+	if format.BOM {
+		switch format.Encoding {
+		case TextUTF8:
+			skip = int64(len(bomUTF8))
+		case TextUTF16LE, TextUTF16BE:
+			skip = 2
+		}
+	}
+	if _, err := f.Seek(skip, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if format.Encoding == TextUTF8 {
+		return f, nil
+	}
+	return &decodingReader{src: f, encoding: format.Encoding, chunk: make([]byte, 32*1024)}, nil
+}
+
+type decodingReader struct {
+	src      io.Reader
+	encoding string
+	chunk    []byte
+	pending  []byte
+	out      []byte
+	err      error
+}
+
+func (d *decodingReader) Read(p []byte) (int, error) {
+	for len(d.out) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		n, err := d.src.Read(d.chunk)
+		body := append(d.pending, d.chunk[:n]...)
+		d.pending = nil
+		if err == nil && (d.encoding == TextUTF16LE || d.encoding == TextUTF16BE) {
+			keep := len(body) % 2
+			if last := len(body) - keep - 2; last >= 0 && isHighSurrogate(body[last:last+2], d.encoding) {
+				keep += 2
+			}
+			d.pending = append([]byte(nil), body[len(body)-keep:]...)
+			body = body[:len(body)-keep]
+		}
+		d.out = []byte(decodeBody(body, d.encoding))
+		d.err = err
+	}
+	n := copy(p, d.out)
+	d.out = d.out[n:]
+	return n, nil
+}
+
+func isHighSurrogate(unit []byte, encoding string) bool {
+	hi := unit[0]
+	if encoding == TextUTF16LE {
+		hi = unit[1]
+	}
+	return hi >= 0xD8 && hi <= 0xDB
+}
+
+func addTextFormat(out map[string]any, format TextFormat) {
+	out["text_encoding"] = format.Name()
+	if ending := format.LineEndingName(); ending != "" {
+		out["line_ending"] = ending
+	}
+}
+
+func countLines(text string) int {
+	total := strings.Count(text, "\n")
+	if text != "" && !strings.HasSuffix(text, "\n") {
+		total++
+	}
+	return total
+}
+
+func (s *Service) readLines(r io.Reader, opts ReadOptions) (map[string]any, error) {
+	start := opts.StartLine
+	if start <= 0 {
+		start = 1
+	}
+	keep := -1
+	if opts.MaxLineLength > 0 {
+		keep = opts.MaxLineLength + 1
+	}
+	if s.maxReadBytes > 0 && (keep < 0 || int64(keep) > s.maxReadBytes+1) {
+		keep = int(s.maxReadBytes) + 1
+	}
+	reader := bufio.NewReaderSize(r, 64*1024)
+	var out strings.Builder
+	lineNo := 0
+	returned := 0
+	cut := 0
+	truncated := false
+	for {
+		skip := lineNo+1 < start || truncated
+		full := !skip && opts.MaxLines > 0 && returned >= opts.MaxLines
+		lineKeep := keep
+		if skip || full {
+			lineKeep = 0
+		}
+		raw, ending, err := readLine(reader, lineKeep)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		lineNo++
+		if skip {
+			continue
+		}
+		if full {
+			truncated = true
+			continue
+		}
+		text := string(raw)
+		if opts.MaxLineLength > 0 && len(text) > opts.MaxLineLength {
+			text = text[:runeCut(text, opts.MaxLineLength)] + "…"
+			cut++
+		}
+		if !utf8.ValidString(text) {
+			text = strings.ToValidUTF8(text, "�")
+		}
+		prefix := ""
+		if opts.LineNumbers {
+			prefix = fmt.Sprintf("%6d\t", lineNo)
+		}
+		entry := prefix + text + ending
+		if s.maxReadBytes > 0 && int64(out.Len()+len(entry)) > s.maxReadBytes {
+			truncated = true
+			if returned > 0 {
+				continue
+			}
+			if room := int(s.maxReadBytes) - len(prefix); room < len(text) {
+				text = text[:runeCut(text, max(room, 0))]
+			}
+			entry = prefix + text
+			cut++
+		}
+		out.WriteString(entry)
+		returned++
+	}
+	result := map[string]any{
+		"encoding":    "utf8",
+		"content":     out.String(),
+		"start_line":  start,
+		"end_line":    start + returned - 1,
+		"lines":       returned,
+		"total_lines": lineNo,
+		"truncated":   truncated,
+		"binary":      false,
+	}
+	if returned == 0 {
+		result["end_line"] = start - 1
+	}
+	if cut > 0 {
+		result["lines_truncated"] = cut
+	}
+	return result, nil
+}
+
+func readLine(r *bufio.Reader, keep int) ([]byte, string, error) {
+	var line []byte
+	read := false
+	for {
+		chunk, err := r.ReadSlice('\n')
+		read = read || len(chunk) > 0
+		ending := ""
+		if err == nil {
+			chunk, ending = chunk[:len(chunk)-1], "\n"
+		}
+		room := len(chunk)
+		if keep >= 0 {
+			room = min(room, max(keep-len(line), 0))
+		}
+		line = append(line, chunk[:room]...)
+		switch {
+		case errors.Is(err, bufio.ErrBufferFull):
+			continue
+		case err == nil:
+			return line, ending, nil
+		case errors.Is(err, io.EOF) && read:
+			return line, "", nil
+		default:
+			return nil, "", err
+		}
+	}
+}
@@ -0,0 +1,363 @@
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode"
+)
+
+const (
+	defaultSearchMaxMatches   = 1000
+	defaultSearchMaxBytes     = 1 << 20
+	defaultSearchMaxFileBytes = 8 << 20
+	searchMaxLineBytes        = 2000
+	binarySniffBytes          = 8000
+)
+
+type SearchOptions struct {
+	Pattern       string
+	Literal       bool
+	IgnoreCase    bool
+	SmartCase     bool
+	Include       []string
+	Exclude       []string
+	NoIgnore      bool
+	Hidden        bool
+	ContextBefore int
+	ContextAfter  int
+	MaxMatches    int
+	MaxBytes      int
+	MaxFileBytes  int64
+}
+
+type SearchSubmatch struct {
+	Column int    `json:"column"`
+	Match  string `json:"match"`
+}
+
+type SearchMatch struct {
+	Path          string           `json:"path"`
+	Line          int              `json:"line"`
+	Column        int              `json:"column"`
+	Match         string           `json:"match"`
+	Text          string           `json:"text"`
+	Submatches    []SearchSubmatch `json:"submatches,omitempty"`
+	ContextBefore []string         `json:"context_before,omitempty"`
+	ContextAfter  []string         `json:"context_after,omitempty"`
+}
+
+type SearchResult struct {
+	Root           string        `json:"root"`
+	Matches        []SearchMatch `json:"matches"`
+	FilesSearched  int64         `json:"files_searched"`
+	FilesMatched   int64         `json:"files_matched"`
+	BinarySkipped  int64         `json:"binary_skipped"`
+	LargeSkipped   int64         `json:"large_skipped"`
+	Truncated      bool          `json:"truncated"`
+	TruncateReason string        `json:"truncate_reason,omitempty"`
+}
+
+type searchState struct {
+	opts     SearchOptions
+	re       *regexp.Regexp
+	root     string
+	deny     DenyFunc
+	open     OpenFunc
+	jobs     chan string
+	mu       sync.Mutex
+	files    map[string][]SearchMatch
+	matches  atomic.Int64
+	bytes    atomic.Int64
+	stopped  atomic.Bool
+	reason   atomic.Value
+	searched atomic.Int64
+	matched  atomic.Int64
+	binary   atomic.Int64
+	large    atomic.Int64
+}
+
+func CompileSearchPattern(opts SearchOptions) (*regexp.Regexp, error) {
+	if opts.Pattern == "" {
+		return nil, errors.New("pattern is required")
+	}
+	expr := opts.Pattern
+	if opts.Literal {
+		expr = regexp.QuoteMeta(expr)
+	}
+	ignoreCase := opts.IgnoreCase
+	if opts.SmartCase && !ignoreCase {
+		ignoreCase = !strings.ContainsFunc(opts.Pattern, unicode.IsUpper)
+	}
+	if ignoreCase {
+		expr = "(?i)" + expr
+	}
+	return regexp.Compile(expr)
+}
+
+func (s *Service) Search(root string, opts SearchOptions) (*SearchResult, error) {
+	re, err := CompileSearchPattern(opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.MaxMatches <= 0 {
+		opts.MaxMatches = defaultSearchMaxMatches
+	}
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = defaultSearchMaxBytes
+	}
+	if opts.MaxFileBytes <= 0 {
+		opts.MaxFileBytes = defaultSearchMaxFileBytes
+	}
+	st, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	workers := runtime.GOMAXPROCS(0)
+	state := &searchState{
+		opts:  opts,
+		re:    re,
+		root:  root,
+		deny:  s.deny,
+		open:  s.open,
+		jobs:  make(chan string, workers),
+		files: map[string][]SearchMatch{},
+	}
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range state.jobs {
+				state.searchFile(p)
+			}
+		}()
+	}
+	if st.IsDir() {
+		var ignores *ignoreNode
+		if !opts.NoIgnore {
+			ignores = s.ignoreChain(root)
+		}
+		state.walkDir(root, ignores)
+	} else {
+		state.jobs <- root
+	}
+	close(state.jobs)
+	wg.Wait()
+
+	paths := make([]string, 0, len(state.files))
+	for p := range state.files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	result := &SearchResult{
+		Root:          root,
+		Matches:       []SearchMatch{},
+		FilesSearched: state.searched.Load(),
+		FilesMatched:  state.matched.Load(),
+		BinarySkipped: state.binary.Load(),
+		LargeSkipped:  state.large.Load(),
+	}
+	for _, p := range paths {
+		result.Matches = append(result.Matches, state.files[p]...)
+	}
+	if len(result.Matches) > opts.MaxMatches {
+		result.Matches = result.Matches[:opts.MaxMatches]
+	}
+	if state.stopped.Load() {
+		result.Truncated = true
+		result.TruncateReason, _ = state.reason.Load().(string)
+	}
+	return result, nil
+}
+
+func (st *searchState) stop(reason string) {
+	if st.stopped.CompareAndSwap(false, true) {
+		st.reason.Store(reason)
+	}
+}
+
+func (st *searchState) walkDir(dir string, ignores *ignoreNode) {
+	if st.stopped.Load() {
+		return
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	if !st.opts.NoIgnore && dir != st.root {
+		ignores = loadIgnoreNode(ignores, dir)
+	}
+	for _, entry := range entries {
+		if st.stopped.Load() {
+			return
+		}
+		name := entry.Name()
+		full := filepath.Join(dir, name)
+		if !st.opts.Hidden && strings.HasPrefix(name, ".") {
+			continue
+		}
+		if entry.Type()&os.ModeSymlink != 0 {
+			continue
+		}
+		if st.deny != nil && st.deny(full) {
+			continue
+		}
+		if entry.IsDir() {
+			if name == ".git" && !st.opts.NoIgnore {
+				continue
+			}
+			if ignores != nil && ignores.ignored(full, true) {
+				continue
+			}
+			if len(st.opts.Exclude) > 0 && matchFilter(st.opts.Exclude, st.rel(full)) {
+				continue
+			}
+			st.walkDir(full, ignores)
+			continue
+		}
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		if ignores != nil && ignores.ignored(full, false) {
+			continue
+		}
+		rel := st.rel(full)
+		if len(st.opts.Include) > 0 && !matchFilter(st.opts.Include, rel) {
+			continue
+		}
+		if len(st.opts.Exclude) > 0 && matchFilter(st.opts.Exclude, rel) {
+			continue
+		}
+		st.jobs <- full
+	}
+}
+
+func (st *searchState) rel(p string) string {
+	rel, err := filepath.Rel(st.root, p)
+	if err != nil {
+		return filepath.ToSlash(p)
+	}
+	return filepath.ToSlash(rel)
+}
+
+func (st *searchState) searchFile(p string) {
+	if st.stopped.Load() {
+		return
+	}
+	f, err := st.open(p, os.O_RDONLY, 0)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return
+	}
+	if info.Size() > st.opts.MaxFileBytes {
+		st.large.Add(1)
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(f, st.opts.MaxFileBytes))
+	if err != nil {
+		return
+	}
+	if IsBinary(data) {
+		st.binary.Add(1)
+		return
+	}
+	st.searched.Add(1)
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	found := []SearchMatch{}
+	for i, line := range lines {
+		locs := st.re.FindAllStringIndex(strings.TrimSuffix(line, "\r"), -1)
+		if len(locs) == 0 {
+			continue
+		}
+		if st.matches.Add(1) > int64(st.opts.MaxMatches) {
+			st.stop("max_matches")
+			break
+		}
+		m := SearchMatch{
+			Path:   p,
+			Line:   i + 1,
+			Column: locs[0][0] + 1,
+			Match:  line[locs[0][0]:locs[0][1]],
+			Text:   truncateLine(strings.TrimSuffix(line, "\r")),
+		}
+		if len(locs) > 1 {
+			for _, loc := range locs {
+				m.Submatches = append(m.Submatches, SearchSubmatch{Column: loc[0] + 1, Match: line[loc[0]:loc[1]]})
+			}
+		}
+		if st.opts.ContextBefore > 0 {
+			from := max(0, i-st.opts.ContextBefore)
+			m.ContextBefore = truncateLines(lines[from:i])
+		}
+		if st.opts.ContextAfter > 0 {
+			to := min(len(lines), i+1+st.opts.ContextAfter)
+			m.ContextAfter = truncateLines(lines[i+1 : to])
+		}
+		size := int64(len(m.Text) + len(m.Match))
+		for _, c := range m.ContextBefore {
+			size += int64(len(c))
+		}
+		for _, c := range m.ContextAfter {
+			size += int64(len(c))
+		}
+		if st.bytes.Add(size) > int64(st.opts.MaxBytes) {
+			st.stop("max_bytes")
+			break
+		}
+		found = append(found, m)
+	}
+	if len(found) == 0 {
+		return
+	}
+	st.matched.Add(1)
+	st.mu.Lock()
+	st.files[p] = found
+	st.mu.Unlock()
+}
+
+func truncateLine(line string) string {
+	if len(line) <= searchMaxLineBytes {
+		return line
+	}
+	return line[:runeCut(line, searchMaxLineBytes)]
+}
+
+func truncateLines(lines []string) []string {
+	out := make([]string, len(lines))
+	for i, l := range lines {
+		out[i] = truncateLine(strings.TrimSuffix(l, "\r"))
+	}
+	return out
+}
+
+func runeCut(s string, n int) int {
+	for n > 0 && n < len(s) && !isRuneStart(s[n]) {
+		n--
+	}
+	return n
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+func IsBinary(data []byte) bool {
+	sniff := data
+	if len(sniff) > binarySniffBytes {
+		sniff = sniff[:binarySniffBytes]
+	}
+	return bytes.IndexByte(sniff, 0) >= 0
+}
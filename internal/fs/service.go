@@ -1,28 +1,148 @@
 package fs
 
 import (
+	"crypto/rand"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
-	"strings"
+	"strconv"
+	"syscall"
 	"time"
 )
 
 var ErrConflict = errors.New("expected mtime does not match")
 
+type OpenFunc func(path string, flag int, perm os.FileMode) (*os.File, error)
+
+type DenyFunc func(path string) bool
+
+type RootFunc func(path string) (string, bool)
+
 type Service struct {
 	maxReadBytes int64
+	open         OpenFunc
+	deny         DenyFunc
+	root         RootFunc
+}
+
+func NewService(maxReadBytes int64, open OpenFunc, deny DenyFunc, root RootFunc) *Service {
+	if open == nil {
+		open = os.OpenFile
+	}
+	return &Service{maxReadBytes: maxReadBytes, open: open, deny: deny, root: root}
 }
 
-func NewService(maxReadBytes int64) *Service {
-	return &Service{maxReadBytes: maxReadBytes}
+func (s *Service) denied(path string) bool {
+	return s.deny != nil && s.deny(path)
 }
 
-func (s *Service) Read(path, encoding string, offset, length int64) (map[string]any, error) {
-	f, err := os.Open(path)
+func (s *Service) ignoreChain(root string) *ignoreNode {
+	boundary := root
+	if s.root != nil {
+		if r, ok := s.root(root); ok {
+			boundary = r
+		}
+	}
+	return loadIgnoreChain(root, boundary)
+}
+
+func (s *Service) ReadFile(path string) ([]byte, error) {
+	f, err := s.open(path, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+func (s *Service) ReadText(path string) ([]byte, string, TextFormat, error) {
+	data, err := s.ReadFile(path)
+	if err != nil {
+		return nil, "", TextFormat{}, err
+	}
+	text, format := DecodeText(data)
+	return data, text, format, nil
+}
+
+func (s *Service) replaceAtomic(path string, data []byte, opts WriteOptions, previous fs.FileInfo) error {
+	dir := filepath.Dir(path)
+	var suffix [6]byte
+	if _, err := rand.Read(suffix[:]); err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, "."+filepath.Base(path)+".rexd-"+hex.EncodeToString(suffix[:])+".tmp")
+	createPerm := os.FileMode(0600)
+	if previous == nil && opts.Perm == 0 {
+		createPerm = 0644
+	}
+	f, err := s.open(tmp, os.O_CREATE|os.O_EXCL|os.O_WRONLY, createPerm)
+	if err != nil {
+		return err
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = s.remove(tmp)
+		}
+	}()
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	perm := opts.Perm
+	if previous != nil {
+		if perm == 0 {
+			perm = previous.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+		}
+		if st, ok := previous.Sys().(*syscall.Stat_t); ok {
+			_ = f.Chown(int(st.Uid), int(st.Gid))
+		}
+		copyXattrs(path, tmp)
+	}
+	if perm != 0 {
+		if err := f.Chmod(perm); err != nil {
+			_ = f.Close()
+			return err
+		}
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if opts.Mode == "create" {
+		if err := s.link(tmp, path); err != nil {
+			return err
+		}
+		_ = s.remove(tmp)
+	} else if err := s.rename(tmp, path); err != nil {
+		return err
+	}
+	committed = true
+	return s.syncDir(dir)
+}
+
+func (s *Service) writeFile(path string, flag int, data []byte, perm os.FileMode) error {
+	f, err := s.open(path, flag, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (s *Service) Read(path string, opts ReadOptions) (map[string]any, error) {
+	f, err := s.open(path, os.O_RDONLY, 0)
 	if err != nil {
 		return nil, err
 	}
@@ -31,14 +151,47 @@ func (s *Service) Read(path, encoding string, offset, length int64) (map[string]
 	if err != nil {
 		return nil, err
 	}
-	if offset > 0 {
-		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+	if st.IsDir() {
+		return nil, errors.New("path is a directory")
+	}
+	sniff := make([]byte, binarySniffBytes)
+	sn, err := io.ReadFull(f, sniff)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+	sniff = sniff[:sn]
+	format, isText := DetectTextFormat(sniff, int64(sn) >= st.Size())
+	binary := !isText
+	mimeType := DetectMIME(path, sniff)
+	if binary && opts.Encoding != "base64" && opts.OnBinary == "error" {
+		return nil, fmt.Errorf("%w (%s)", ErrBinaryFile, mimeType)
+	}
+	if opts.lineMode() {
+		if binary {
+			return nil, fmt.Errorf("%w (%s); line-oriented reads need a text file", ErrBinaryFile, mimeType)
+		}
+		r, err := textReader(f, format)
+		if err != nil {
+			return nil, err
+		}
+		result, err := s.readLines(r, opts)
+		if err != nil {
 			return nil, err
 		}
+		result["path"] = path
+		result["size"] = st.Size()
+		result["mtime"] = st.ModTime().UnixMilli()
+		result["mime"] = mimeType
+		addTextFormat(result, format)
+		return result, nil
+	}
+
+	if _, err := f.Seek(opts.Offset, io.SeekStart); err != nil {
+		return nil, err
 	}
 	limit := s.maxReadBytes
-	if length > 0 && (limit <= 0 || length < limit) {
-		limit = length
+	if opts.Length > 0 && (limit <= 0 || opts.Length < limit) {
+		limit = opts.Length
 	}
 	if limit <= 0 {
 		limit = st.Size()
@@ -49,37 +202,115 @@ func (s *Service) Read(path, encoding string, offset, length int64) (map[string]
 		return nil, err
 	}
 	buf = buf[:n]
-	content := string(buf)
+	encoding := opts.Encoding
+	if binary {
+		encoding = "base64"
+	}
+	content := ""
 	if encoding == "base64" {
 		content = base64.StdEncoding.EncodeToString(buf)
 	} else {
 		encoding = "utf8"
+		content = format.decode(buf)
 	}
-	return map[string]any{
+	out := map[string]any{
 		"path":      path,
 		"size":      st.Size(),
 		"mtime":     st.ModTime().UnixMilli(),
 		"encoding":  encoding,
 		"content":   content,
-		"truncated": int64(n) < st.Size()-offset,
-	}, nil
+		"truncated": int64(n) < st.Size()-opts.Offset,
+		"binary":    binary,
+		"mime":      mimeType,
+	}
+	if !binary {
+		if opts.Offset == 0 && int64(n) >= st.Size() {
+			out["total_lines"] = countLines(content)
+		}
+		addTextFormat(out, format)
+	}
+	return out, nil
+}
+
+type WriteOptions struct {
+	Mode         string
+	MkdirParents bool
+	Atomic       bool
+	Perm         os.FileMode
+	Pre          Preconditions
+	TextEncoding string
+	LineEnding   string
+}
+
+func ParsePerm(perm string) (os.FileMode, error) {
+	if perm == "" {
+		return 0, nil
+	}
+	v, err := strconv.ParseUint(perm, 8, 32)
+	if err != nil || v > 0o7777 {
+		return 0, fmt.Errorf("invalid perm %q; expected octal such as 0644", perm)
+	}
+	return os.FileMode(v&0o777) | unixModeBits(v), nil
+}
+
+func unixModeBits(v uint64) os.FileMode {
+	var mode os.FileMode
+	if v&0o4000 != 0 {
+		mode |= os.ModeSetuid
+	}
+	if v&0o2000 != 0 {
+		mode |= os.ModeSetgid
+	}
+	if v&0o1000 != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode
 }
 
-func (s *Service) Write(path string, data []byte, mode string, mkdirParents bool, atomic bool, expectedMTime int64) (map[string]any, error) {
-	if mkdirParents {
-		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+func FormatPerm(mode os.FileMode) string {
+	v := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		v |= 0o4000
+	}
+	if mode&os.ModeSetgid != 0 {
+		v |= 0o2000
+	}
+	if mode&os.ModeSticky != 0 {
+		v |= 0o1000
+	}
+	return fmt.Sprintf("%04o", v)
+}
+
+func (s *Service) Write(path string, data []byte, opts WriteOptions) (map[string]any, error) {
+	if opts.MkdirParents {
+		if err := s.mkdirAll(filepath.Dir(path), 0755); err != nil {
 			return nil, err
 		}
 	}
-	existed := false
+	var previous fs.FileInfo
 	if st, err := os.Stat(path); err == nil {
-		existed = true
-		if expectedMTime > 0 && st.ModTime().UnixMilli() != expectedMTime {
+		previous = st
+		if opts.Pre.MTime > 0 && st.ModTime().UnixMilli() != opts.Pre.MTime {
 			return nil, ErrConflict
 		}
 	}
+	existed := previous != nil
+	if err := s.CheckSHA256(path, opts.Pre.SHA256); err != nil {
+		return nil, err
+	}
+	if opts.Mode == "create" && existed {
+		return nil, &fs.PathError{Op: "create", Path: path, Err: fs.ErrExist}
+	}
+	var format *TextFormat
+	if opts.TextEncoding != "" || opts.LineEnding != "" {
+		encoded, f, err := s.encodeText(path, data, opts, previous)
+		if err != nil {
+			return nil, err
+		}
+		data, format = encoded, &f
+	}
 	flags := os.O_CREATE | os.O_WRONLY
-	switch mode {
+	switch opts.Mode {
 	case "append":
 		flags |= os.O_APPEND
 	case "create":
@@ -87,38 +318,80 @@ func (s *Service) Write(path string, data []byte, mode string, mkdirParents bool
 	default:
 		flags |= os.O_TRUNC
 	}
-	if atomic && mode != "append" {
-		tmp := path + ".rexd.tmp"
-		if err := os.WriteFile(tmp, data, 0644); err != nil {
-			return nil, err
-		}
-		if err := os.Rename(tmp, path); err != nil {
+	if opts.Atomic && opts.Mode != "append" {
+		if err := s.replaceAtomic(path, data, opts, previous); err != nil {
 			return nil, err
 		}
 	} else {
-		f, err := os.OpenFile(path, flags, 0644)
-		if err != nil {
-			return nil, err
+		perm := opts.Perm
+		if perm == 0 {
+			perm = 0644
 		}
-		if _, err := f.Write(data); err != nil {
-			_ = f.Close()
+		if err := s.writeFile(path, flags, data, perm); err != nil {
 			return nil, err
 		}
-		_ = f.Close()
+		if opts.Perm != 0 && existed {
+			if err := s.chmod(path, opts.Perm); err != nil {
+				return nil, err
+			}
+		}
 	}
 	st, err := os.Stat(path)
 	if err != nil {
 		return nil, err
 	}
-	return map[string]any{
+	out := map[string]any{
 		"path":          path,
 		"bytes_written": len(data),
 		"mtime":         st.ModTime().UnixMilli(),
 		"created":       !existed,
-	}, nil
+	}
+	if format != nil {
+		addTextFormat(out, *format)
+	}
+	return out, nil
+}
+
+func (s *Service) encodeText(path string, data []byte, opts WriteOptions, previous fs.FileInfo) ([]byte, TextFormat, error) {
+	format := TextFormat{Encoding: TextUTF8}
+	if previous != nil && (opts.TextEncoding == TextPreserve || opts.LineEnding == TextPreserve) {
+		current, ok, err := s.detectFileFormat(path)
+		if err != nil {
+			return nil, format, err
+		}
+		if ok && opts.TextEncoding == TextPreserve {
+			format.Encoding, format.BOM = current.Encoding, current.BOM
+		}
+		if ok && opts.LineEnding == TextPreserve {
+			format.LineEnding, format.Mixed = current.LineEnding, current.Mixed
+		}
+	}
+	if opts.TextEncoding != "" && opts.TextEncoding != TextPreserve {
+		parsed, err := ParseTextEncoding(opts.TextEncoding)
+		if err != nil {
+			return nil, format, err
+		}
+		format.Encoding, format.BOM = parsed.Encoding, parsed.BOM
+	}
+	if opts.LineEnding != "" && opts.LineEnding != TextPreserve {
+		if !ValidLineEnding(opts.LineEnding) {
+			return nil, format, fmt.Errorf("unsupported line_ending %q", opts.LineEnding)
+		}
+		format.LineEnding = opts.LineEnding
+	}
+	text := string(data)
+	if format.LineEnding != "" && !format.Mixed {
+		text = NormalizeLineEndings(text)
+	}
+	encoding := format
+	if opts.Mode == "append" && previous != nil && previous.Size() > 0 {
+		encoding.BOM = false
+	}
+	out, err := encoding.Encode(text)
+	return out, format, err
 }
 
-func (s *Service) Edit(path, oldString, newString string, replaceAll bool, expectedMTime int64) (map[string]any, error) {
+func (s *Service) Edit(path, oldString, newString string, replaceAll bool, pre Preconditions) (map[string]any, error) {
 	if oldString == newString {
 		return nil, errors.New("old_string and new_string are identical")
 	}
@@ -127,10 +400,10 @@ func (s *Service) Edit(path, oldString, newString string, replaceAll bool, expec
 	existed := false
 	if st, err := os.Stat(path); err == nil {
 		existed = true
-		if expectedMTime > 0 && st.ModTime().UnixMilli() != expectedMTime {
+		if pre.MTime > 0 && st.ModTime().UnixMilli() != pre.MTime {
 			return nil, ErrConflict
 		}
-		data, err := os.ReadFile(path)
+		data, err := s.ReadFile(path)
 		if err != nil {
 			return nil, err
 		}
@@ -139,42 +412,47 @@ func (s *Service) Edit(path, oldString, newString string, replaceAll bool, expec
 		return nil, err
 	}
 
-	if !existed && expectedMTime > 0 {
+	if !existed && pre.MTime > 0 {
 		return nil, ErrConflict
 	}
+	if err := checkContentSHA256(current, existed, pre.SHA256); err != nil {
+		return nil, err
+	}
 
 	if !existed && oldString != "" {
 		return nil, errors.New("file does not exist; old_string cannot be matched")
 	}
 
-	next := ""
-	replacements := 0
-	if oldString == "" {
-		next = newString
-		replacements = 1
-	} else if replaceAll {
-		replacements = strings.Count(current, oldString)
-		if replacements == 0 {
-			return nil, errors.New("old_string not found")
-		}
-		next = strings.ReplaceAll(current, oldString, newString)
-	} else {
-		first := strings.Index(current, oldString)
-		if first == -1 {
-			return nil, errors.New("old_string not found")
-		}
-		if strings.Index(current[first+len(oldString):], oldString) != -1 {
-			return nil, errors.New("old_string matched multiple locations; set replace_all=true")
+	current, format := DecodeText([]byte(current))
+	if format.normalized() {
+		oldString = NormalizeLineEndings(oldString)
+		newString = NormalizeLineEndings(newString)
+	}
+
+	next := newString
+	replacements := 1
+	if oldString != "" {
+		var err error
+		next, replacements, err = replaceExact(current, EditSpec{OldString: oldString, NewString: newString, ReplaceAll: replaceAll})
+		if err != nil {
+			if failure := editFailure(err, current, oldString); failure != nil {
+				failure.Path = path
+				return nil, failure
+			}
+			return nil, err
 		}
-		next = strings.Replace(current, oldString, newString, 1)
-		replacements = 1
 	}
 
-	result, err := s.Write(path, []byte(next), "replace", true, true, expectedMTime)
+	encoded, err := format.Encode(next)
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.Write(path, encoded, WriteOptions{Mode: "replace", MkdirParents: true, Atomic: true, Pre: Preconditions{MTime: pre.MTime}})
 	if err != nil {
 		return nil, err
 	}
 	result["replacements"] = replacements
+	addTextFormat(result, format)
 	return result, nil
 }
 
@@ -198,13 +476,17 @@ func (s *Service) List(path string, recursive bool, maxEntries int) (map[string]
 		case d.Type().IsRegular():
 			kind = "file"
 		}
-		entries = append(entries, map[string]any{
+		entry := map[string]any{
 			"name":  d.Name(),
 			"path":  fullPath,
 			"type":  kind,
 			"size":  sz,
 			"mtime": mt,
-		})
+		}
+		if info != nil {
+			addOwnership(entry, info)
+		}
+		entries = append(entries, entry)
 	}
 	if recursive {
 		err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
@@ -214,6 +496,12 @@ func (s *Service) List(path string, recursive bool, maxEntries int) (map[string]
 			if p == path {
 				return nil
 			}
+			if s.denied(p) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
 			info, _ := d.Info()
 			appendEntry(p, d, info)
 			if maxEntries > 0 && len(entries) >= maxEntries {
@@ -230,8 +518,12 @@ func (s *Service) List(path string, recursive bool, maxEntries int) (map[string]
 			return nil, err
 		}
 		for _, d := range ds {
+			full := filepath.Join(path, d.Name())
+			if s.denied(full) {
+				continue
+			}
 			info, _ := d.Info()
-			appendEntry(filepath.Join(path, d.Name()), d, info)
+			appendEntry(full, d, info)
 			if maxEntries > 0 && len(entries) >= maxEntries {
 				break
 			}
@@ -240,17 +532,6 @@ func (s *Service) List(path string, recursive bool, maxEntries int) (map[string]
 	return map[string]any{"path": path, "entries": entries}, nil
 }
 
-func (s *Service) Glob(pattern string, maxMatches int) ([]string, error) {
-	matches, err := filepath.Glob(pattern)
-	if err != nil {
-		return nil, err
-	}
-	if maxMatches > 0 && len(matches) > maxMatches {
-		matches = matches[:maxMatches]
-	}
-	return matches, nil
-}
-
 func (s *Service) Stat(path string) (map[string]any, error) {
 	st, err := os.Lstat(path)
 	if err != nil {
@@ -276,6 +557,7 @@ func (s *Service) Stat(path string) (map[string]any, error) {
 		"mtime":  st.ModTime().UnixMilli(),
 		"mode":   st.Mode().String(),
 	}
+	addOwnership(out, st)
 	if kind == "symlink" {
 		if target, err := os.Readlink(path); err == nil {
 			out["symlink_target"] = target
@@ -284,6 +566,33 @@ func (s *Service) Stat(path string) (map[string]any, error) {
 	return out, nil
 }
 
+func addOwnership(out map[string]any, info fs.FileInfo) {
+	out["perm"] = FormatPerm(info.Mode())
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		out["uid"] = st.Uid
+		out["gid"] = st.Gid
+		out["inode"] = st.Ino
+	}
+}
+
+func (s *Service) Chmod(path string, perm os.FileMode, expectedMTime int64) (map[string]any, error) {
+	if _, err := checkMTime(path, expectedMTime); err != nil {
+		return nil, err
+	}
+	if err := s.chmod(path, perm); err != nil {
+		return nil, err
+	}
+	st, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{
+		"path":  path,
+		"perm":  FormatPerm(st.Mode()),
+		"mtime": st.ModTime().UnixMilli(),
+	}, nil
+}
+
 func DecodeContent(content, encoding string) ([]byte, error) {
 	if encoding == "base64" {
 		return base64.StdEncoding.DecodeString(content)
@@ -0,0 +1,299 @@
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+const (
+	TextUTF8    = "utf8"
+	TextUTF8BOM = "utf8-bom"
+	TextUTF16LE = "utf16le"
+	TextUTF16BE = "utf16be"
+	TextLatin1  = "latin1"
+
+	LineLF    = "lf"
+	LineCRLF  = "crlf"
+	LineCR    = "cr"
+	LineMixed = "mixed"
+
+	TextPreserve = "preserve"
+)
+
+var ErrMixedLineEndings = errors.New("file has mixed line endings; patches would rewrite them, use fs.edit instead")
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+type TextFormat struct {
+	Encoding   string
+	BOM        bool
+	LineEnding string
+	Mixed      bool
+}
+
+func (f TextFormat) Name() string {
+	if f.Encoding == TextUTF8 && f.BOM {
+		return TextUTF8BOM
+	}
+	if f.Encoding == "" {
+		return TextUTF8
+	}
+	return f.Encoding
+}
+
+func (f TextFormat) normalized() bool {
+	return f.LineEnding == LineCRLF && !f.Mixed
+}
+
+func (f TextFormat) LineEndingName() string {
+	if f.Mixed {
+		return LineMixed
+	}
+	return f.LineEnding
+}
+
+func ParseTextEncoding(name string) (TextFormat, error) {
+	switch strings.ToLower(name) {
+	case TextUTF8, "utf-8":
+		return TextFormat{Encoding: TextUTF8}, nil
+	case TextUTF8BOM, "utf-8-bom":
+		return TextFormat{Encoding: TextUTF8, BOM: true}, nil
+	case TextUTF16LE, "utf-16le":
+		return TextFormat{Encoding: TextUTF16LE, BOM: true}, nil
+	case TextUTF16BE, "utf-16be":
+		return TextFormat{Encoding: TextUTF16BE, BOM: true}, nil
+	case TextLatin1, "latin-1", "iso-8859-1":
+		return TextFormat{Encoding: TextLatin1}, nil
+	}
+	return TextFormat{}, fmt.Errorf("unsupported text_encoding %q", name)
+}
+
+func ValidLineEnding(name string) bool {
+	switch name {
+	case "", TextPreserve, LineLF, LineCRLF, LineCR:
+		return true
+	}
+	return false
+}
+
+func DetectTextFormat(data []byte, complete bool) (TextFormat, bool) {
+	var f TextFormat
+	body := data
+	switch {
+	case bytes.HasPrefix(data, bomUTF8):
+		f = TextFormat{Encoding: TextUTF8, BOM: true}
+		body = data[len(bomUTF8):]
+	case bytes.HasPrefix(data, bomUTF16LE):
+		f = TextFormat{Encoding: TextUTF16LE, BOM: true}
+		body = data[len(bomUTF16LE):]
+	case bytes.HasPrefix(data, bomUTF16BE):
+		f = TextFormat{Encoding: TextUTF16BE, BOM: true}
+		body = data[len(bomUTF16BE):]
+	case bytes.IndexByte(data, 0) >= 0:
+		enc, ok := guessUTF16(data)
+		if !ok {
+			return TextFormat{}, false
+		}
+		f = TextFormat{Encoding: enc}
+	case validUTF8Sample(data, complete):
+		f = TextFormat{Encoding: TextUTF8}
+	default:
+		f = TextFormat{Encoding: TextLatin1}
+	}
+	text := decodeBody(body, f.Encoding)
+	f.LineEnding, f.Mixed = detectLineEnding(text)
+	return f, true
+}
+
+func guessUTF16(data []byte) (string, bool) {
+	n := len(data) &^ 1
+	if n < 2 {
+		return "", false
+	}
+	evenZeros, oddZeros := 0, 0
+	for i := 0; i < n; i += 2 {
+		if data[i] == 0 {
+			evenZeros++
+		}
+		if data[i+1] == 0 {
+			oddZeros++
+		}
+	}
+	units := n / 2
+	switch {
+	case oddZeros*10 >= units*6 && evenZeros*10 < units:
+		return TextUTF16LE, true
+	case evenZeros*10 >= units*6 && oddZeros*10 < units:
+		return TextUTF16BE, true
+	}
+	return "", false
+}
+
+func validUTF8Sample(data []byte, complete bool) bool {
+	if utf8.Valid(data) {
+		return true
+	}
+	if complete {
+		return false
+	}
+	for cut := 1; cut < utf8.UTFMax && cut <= len(data); cut++ {
+		if utf8.Valid(data[:len(data)-cut]) {
+			return true
+		}
+	}
+	return false
+}
+
+func detectLineEnding(text string) (string, bool) {
+	lf, crlf, cr := 0, 0, 0
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '\n':
+			lf++
+		case '\r':
+			if i+1 < len(text) && text[i+1] == '\n' {
+				crlf++
+				i++
+			} else {
+				cr++
+			}
+		}
+	}
+	kinds := 0
+	for _, c := range []int{lf, crlf, cr} {
+		if c > 0 {
+			kinds++
+		}
+	}
+	switch {
+	case kinds == 0:
+		return "", false
+	case crlf >= lf && crlf >= cr:
+		return LineCRLF, kinds > 1
+	case lf >= cr:
+		return LineLF, kinds > 1
+	default:
+		return LineCR, kinds > 1
+	}
+}
+
+func decodeBody(body []byte, encoding string) string {
+	switch encoding {
+	case TextUTF16LE, TextUTF16BE:
+		units := make([]uint16, len(body)/2)
+		for i := range units {
+			if encoding == TextUTF16LE {
+				units[i] = uint16(body[2*i]) | uint16(body[2*i+1])<<8
+			} else {
+				units[i] = uint16(body[2*i])<<8 | uint16(body[2*i+1])
+			}
+		}
+		return string(utf16.Decode(units))
+	case TextLatin1:
+		runes := make([]rune, len(body))
+		for i, b := range body {
+			runes[i] = rune(b)
+		}
+		return string(runes)
+	}
+	return string(body)
+}
+
+func (f TextFormat) decode(data []byte) string {
+	if f.BOM {
+		switch f.Encoding {
+		case TextUTF8:
+			data = bytes.TrimPrefix(data, bomUTF8)
+		case TextUTF16LE:
+			data = bytes.TrimPrefix(data, bomUTF16LE)
+		case TextUTF16BE:
+			data = bytes.TrimPrefix(data, bomUTF16BE)
+		}
+	}
+	return decodeBody(data, f.Encoding)
+}
+
+func DecodeText(data []byte) (string, TextFormat) {
+	f, ok := DetectTextFormat(data, true)
+	if !ok {
+		return string(data), TextFormat{Encoding: TextUTF8}
+	}
+	text := f.decode(data)
+	if f.normalized() {
+		text = NormalizeLineEndings(text)
+	}
+	return text, f
+}
+
+func NormalizeLineEndings(text string) string {
+	return strings.ReplaceAll(text, "\r\n", "\n")
+}
+
+func (f TextFormat) Encode(text string) ([]byte, error) {
+	if !f.Mixed {
+		switch f.LineEnding {
+		case LineCRLF:
+			text = strings.ReplaceAll(text, "\n", "\r\n")
+		case LineCR:
+			text = strings.ReplaceAll(text, "\n", "\r")
+		}
+	}
+	var out []byte
+	switch f.Encoding {
+	case TextUTF16LE, TextUTF16BE:
+		units := utf16.Encode([]rune(text))
+		if f.BOM {
+			units = append([]uint16{0xFEFF}, units...)
+		}
+		out = make([]byte, 0, 2*len(units))
+		for _, u := range units {
+			if f.Encoding == TextUTF16LE {
+				out = append(out, byte(u), byte(u>>8))
+			} else {
+				out = append(out, byte(u>>8), byte(u))
+			}
+		}
+		return out, nil
+	case TextLatin1:
+		out = make([]byte, 0, len(text))
+		for i, r := range text {
+			if r > 0xFF {
+				return nil, fmt.Errorf("character %q at byte %d cannot be encoded as latin1", r, i)
+			}
+			out = append(out, byte(r))
+		}
+		return out, nil
+	}
+	if f.BOM {
+		out = append(out, bomUTF8...)
+	}
+	return append(out, text...), nil
+}
+
+func (s *Service) detectFileFormat(path string) (TextFormat, bool, error) {
+	f, err := s.open(path, os.O_RDONLY, 0)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return TextFormat{}, false, nil
+		}
+		return TextFormat{}, false, err
+	}
+	defer f.Close()
+	sniff := make([]byte, binarySniffBytes)
+	n, _ := f.Read(sniff)
+	st, err := f.Stat()
+	if err != nil {
+		return TextFormat{}, false, err
+	}
+	format, ok := DetectTextFormat(sniff[:n], int64(n) >= st.Size())
+	return format, ok, nil
+}
@@ -0,0 +1,501 @@
+package fs
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/samiralibabic/rexd/internal/events"
+)
+
+const (
+	maxUploadChunkBytes      = 4 << 20
+	defaultDownloadChunkSize = 256 << 10
+	maxDownloadChunkSize     = 4 << 20
+	defaultDownloadWindow    = 8
+	maxDownloadWindow        = 64
+	defaultDownloadIdle      = time.Minute
+)
+
+var (
+	ErrUploadNotFound   = errors.New("upload not found")
+	ErrDownloadNotFound = errors.New("download not found")
+	ErrChecksumMismatch = errors.New("sha256 does not match uploaded content")
+)
+
+type UploadOptions struct {
+	Size          int64
+	Overwrite     bool
+	MkdirParents  bool
+	ExpectedMTime int64
+}
+
+type DownloadOptions struct {
+	Offset    int64
+	Length    int64
+	ChunkSize int
+	Window    int
+}
+
+type Upload struct {
+	ID        string
+	SessionID string
+	Path      string
+	opts      UploadOptions
+	tmp       string
+	file      *os.File
+	mu        sync.Mutex
+	received  int64
+}
+
+type UploadStatus struct {
+	UploadID string `json:"upload_id"`
+	Path     string `json:"path"`
+	Received int64  `json:"received"`
+	Size     int64  `json:"size,omitempty"`
+}
+
+type UploadResult struct {
+	Path    string `json:"path"`
+	Size    int64  `json:"size"`
+	SHA256  string `json:"sha256"`
+	MTime   int64  `json:"mtime"`
+	Created bool   `json:"created"`
+}
+
+func (r *UploadResult) AffectedPaths() []string { return []string{r.Path} }
+
+type Download struct {
+	ID        string
+	SessionID string
+	Path      string
+	Size      int64
+	opts      DownloadOptions
+	mu        sync.Mutex
+	acked     int64
+	finalSeq  int64
+	ackCh     chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type TransferManager struct {
+	mu        sync.Mutex
+	bus       *events.Bus
+	fs        *Service
+	idle      time.Duration
+	uploads   map[string]*Upload
+	downloads map[string]*Download
+}
+
+func NewTransferManager(bus *events.Bus, fs *Service, idle time.Duration) *TransferManager {
+	if idle <= 0 {
+		idle = defaultDownloadIdle
+	}
+	return &TransferManager{
+		bus:       bus,
+		fs:        fs,
+		idle:      idle,
+		uploads:   map[string]*Upload{},
+		downloads: map[string]*Download{},
+	}
+}
+
+func (m *TransferManager) BeginUpload(sessionID, path string, opts UploadOptions) (*UploadStatus, error) {
+	if opts.MkdirParents {
+		if err := m.fs.mkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := uploadTarget(path, opts); err != nil {
+		return nil, err
+	}
+	id := fmt.Sprintf("up_%d", time.Now().UnixNano())
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+"."+id+".rexd.tmp")
+	f, err := m.fs.open(tmp, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	up := &Upload{ID: id, SessionID: sessionID, Path: path, opts: opts, tmp: tmp, file: f}
+	m.mu.Lock()
+	m.uploads[id] = up
+	m.mu.Unlock()
+	return up.status(), nil
+}
+
+func uploadTarget(path string, opts UploadOptions) (fs.FileInfo, error) {
+	st, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		if opts.ExpectedMTime > 0 {
+			return nil, ErrConflict
+		}
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if st.IsDir() {
+		return nil, errors.New("path is a directory")
+	}
+	if !opts.Overwrite {
+		return nil, ErrDestinationExists
+	}
+	if opts.ExpectedMTime > 0 && st.ModTime().UnixMilli() != opts.ExpectedMTime {
+		return nil, ErrConflict
+	}
+	return st, nil
+}
+
+func (m *TransferManager) upload(id, sessionID string) (*Upload, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	up, ok := m.uploads[id]
+	if !ok || up.SessionID != sessionID {
+		return nil, ErrUploadNotFound
+	}
+	return up, nil
+}
+
+func (up *Upload) status() *UploadStatus {
+	return &UploadStatus{UploadID: up.ID, Path: up.Path, Received: up.received, Size: up.opts.Size}
+}
+
+func (m *TransferManager) UploadStatus(id, sessionID string) (*UploadStatus, error) {
+	up, err := m.upload(id, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	up.mu.Lock()
+	defer up.mu.Unlock()
+	return up.status(), nil
+}
+
+func (m *TransferManager) UploadChunk(id, sessionID string, offset int64, data string) (*UploadStatus, error) {
+	up, err := m.upload(id, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	chunk, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(chunk) > maxUploadChunkBytes {
+		return nil, fmt.Errorf("chunk exceeds %d bytes", maxUploadChunkBytes)
+	}
+	up.mu.Lock()
+	defer up.mu.Unlock()
+	if offset < 0 || offset > up.received {
+		return nil, fmt.Errorf("offset %d is beyond received bytes %d", offset, up.received)
+	}
+	if up.opts.Size > 0 && offset+int64(len(chunk)) > up.opts.Size {
+		return nil, fmt.Errorf("chunk ends past declared size %d", up.opts.Size)
+	}
+	if _, err := up.file.WriteAt(chunk, offset); err != nil {
+		return nil, err
+	}
+	if end := offset + int64(len(chunk)); end > up.received {
+		up.received = end
+	}
+	return up.status(), nil
+}
+
+func (m *TransferManager) CommitUpload(id, sessionID, expectedSHA256 string) (*UploadResult, error) {
+	up, err := m.upload(id, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	up.mu.Lock()
+	defer up.mu.Unlock()
+	if up.opts.Size > 0 && up.received != up.opts.Size {
+		return nil, fmt.Errorf("received %d of %d bytes", up.received, up.opts.Size)
+	}
+	if err := up.file.Truncate(up.received); err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(up.file, 0, up.received)); err != nil {
+		return nil, err
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+	if expectedSHA256 != "" && expectedSHA256 != sum {
+		return nil, fmt.Errorf("%w: got %s", ErrChecksumMismatch, sum)
+	}
+	previous, err := uploadTarget(up.Path, up.opts)
+	if err != nil {
+		return nil, err
+	}
+	perm := os.FileMode(0644)
+	if previous != nil {
+		perm = previous.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+		if st, ok := previous.Sys().(*syscall.Stat_t); ok {
+			_ = up.file.Chown(int(st.Uid), int(st.Gid))
+		}
+		copyXattrs(up.Path, up.tmp)
+	}
+	if err := up.file.Chmod(perm); err != nil {
+		return nil, err
+	}
+	if err := up.file.Sync(); err != nil {
+		return nil, err
+	}
+	if err := up.file.Close(); err != nil {
+		return nil, err
+	}
+	if err := m.fs.rename(up.tmp, up.Path); err != nil {
+		return nil, err
+	}
+	if err := m.fs.syncDir(filepath.Dir(up.Path)); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	delete(m.uploads, id)
+	m.mu.Unlock()
+	st, err := os.Stat(up.Path)
+	if err != nil {
+		return nil, err
+	}
+	return &UploadResult{Path: up.Path, Size: up.received, SHA256: sum, MTime: st.ModTime().UnixMilli(), Created: previous == nil}, nil
+}
+
+func (m *TransferManager) AbortUpload(id, sessionID string) error {
+	up, err := m.upload(id, sessionID)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	delete(m.uploads, id)
+	m.mu.Unlock()
+	up.abort(m.fs)
+	return nil
+}
+
+func (up *Upload) abort(fs *Service) {
+	up.mu.Lock()
+	defer up.mu.Unlock()
+	_ = up.file.Close()
+	_ = fs.remove(up.tmp)
+}
+
+func (m *TransferManager) StartDownload(sessionID, path string, opts DownloadOptions) (*Download, error) {
+	f, err := m.fs.open(path, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if st.IsDir() {
+		_ = f.Close()
+		return nil, errors.New("path is a directory")
+	}
+	if opts.Offset < 0 || opts.Offset > st.Size() {
+		_ = f.Close()
+		return nil, fmt.Errorf("offset %d is outside file size %d", opts.Offset, st.Size())
+	}
+	size := st.Size() - opts.Offset
+	if opts.Length > 0 && opts.Length < size {
+		size = opts.Length
+	}
+	return m.startStream(sessionID, path, f, size, opts), nil
+}
+
+func (m *TransferManager) startStream(sessionID, path string, f *os.File, size int64, opts DownloadOptions) *Download {
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = defaultDownloadChunkSize
+	}
+	if opts.ChunkSize > maxDownloadChunkSize {
+		opts.ChunkSize = maxDownloadChunkSize
+	}
+	if opts.Window <= 0 {
+		opts.Window = defaultDownloadWindow
+	}
+	if opts.Window > maxDownloadWindow {
+		opts.Window = maxDownloadWindow
+	}
+	dl := &Download{
+		ID:        fmt.Sprintf("dl_%d", time.Now().UnixNano()),
+		SessionID: sessionID,
+		Path:      path,
+		Size:      size,
+		opts:      opts,
+		ackCh:     make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+	m.mu.Lock()
+	m.downloads[dl.ID] = dl
+	m.mu.Unlock()
+	go m.stream(dl, f)
+	return dl
+}
+
+func (m *TransferManager) stream(dl *Download, f *os.File) {
+	defer f.Close()
+	retain := false
+	defer func() {
+		if !retain {
+			m.forgetDownload(dl.ID)
+		}
+	}()
+	h := sha256.New()
+	reader := io.NewSectionReader(f, dl.opts.Offset, dl.Size)
+	buf := make([]byte, dl.opts.ChunkSize)
+	offset := dl.opts.Offset
+	for seq := int64(1); ; seq++ {
+		for {
+			dl.mu.Lock()
+			inFlight := seq - 1 - dl.acked
+			dl.mu.Unlock()
+			if inFlight < int64(dl.opts.Window) {
+				break
+			}
+			select {
+			case <-dl.ackCh:
+			case <-dl.done:
+				return
+			case <-time.After(m.idle):
+				m.failDownload(dl, seq, fmt.Sprintf("no fs.download.ack within %s", m.idle))
+				return
+			}
+		}
+		n, err := io.ReadFull(reader, buf)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			m.failDownload(dl, seq, err.Error())
+			return
+		}
+		h.Write(buf[:n])
+		eof := offset+int64(n) >= dl.opts.Offset+dl.Size
+		params := map[string]any{
+			"session_id":  dl.SessionID,
+			"download_id": dl.ID,
+			"seq":         seq,
+			"offset":      offset,
+			"encoding":    "base64",
+			"data":        base64.StdEncoding.EncodeToString(buf[:n]),
+			"eof":         eof,
+		}
+		if eof {
+			params["sha256"] = hex.EncodeToString(h.Sum(nil))
+		}
+		select {
+		case <-dl.done:
+			return
+		default:
+		}
+		if eof {
+			dl.mu.Lock()
+			dl.finalSeq = seq
+			retain = dl.acked < seq
+			dl.mu.Unlock()
+		}
+		if !m.bus.PublishWait(dl.SessionID, "fs.data", params, dl.done, m.idle) {
+			retain = false
+			select {
+			case <-dl.done:
+			default:
+				m.failDownload(dl, seq, "event queue full; chunk was not delivered")
+			}
+			return
+		}
+		offset += int64(n)
+		if eof {
+			if retain {
+				time.AfterFunc(m.idle, func() { m.forgetDownload(dl.ID) })
+			}
+			return
+		}
+	}
+}
+
+func (m *TransferManager) failDownload(dl *Download, seq int64, reason string) {
+	m.bus.Publish(dl.SessionID, "fs.data", map[string]any{
+		"session_id":  dl.SessionID,
+		"download_id": dl.ID,
+		"seq":         seq,
+		"error":       reason,
+		"eof":         true,
+	})
+}
+
+func (m *TransferManager) download(id, sessionID string) (*Download, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	dl, ok := m.downloads[id]
+	if !ok || dl.SessionID != sessionID {
+		return nil, ErrDownloadNotFound
+	}
+	return dl, nil
+}
+
+func (m *TransferManager) AckDownload(id, sessionID string, seq int64) error {
+	dl, err := m.download(id, sessionID)
+	if err != nil {
+		return err
+	}
+	dl.mu.Lock()
+	if seq > dl.acked {
+		dl.acked = seq
+	}
+	complete := dl.finalSeq > 0 && dl.acked >= dl.finalSeq
+	dl.mu.Unlock()
+	if complete {
+		m.forgetDownload(id)
+		return nil
+	}
+	select {
+	case dl.ackCh <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (m *TransferManager) forgetDownload(id string) {
+	m.mu.Lock()
+	delete(m.downloads, id)
+	m.mu.Unlock()
+}
+
+func (m *TransferManager) CancelDownload(id, sessionID string) error {
+	dl, err := m.download(id, sessionID)
+	if err != nil {
+		return err
+	}
+	dl.cancel()
+	m.forgetDownload(id)
+	return nil
+}
+
+func (dl *Download) cancel() {
+	dl.closeOnce.Do(func() { close(dl.done) })
+}
+
+func (m *TransferManager) CloseSession(sessionID string) {
+	m.mu.Lock()
+	uploads := []*Upload{}
+	for id, up := range m.uploads {
+		if up.SessionID == sessionID {
+			uploads = append(uploads, up)
+			delete(m.uploads, id)
+		}
+	}
+	for id, dl := range m.downloads {
+		if dl.SessionID == sessionID {
+			dl.cancel()
+			delete(m.downloads, id)
+		}
+	}
+	m.mu.Unlock()
+	for _, up := range uploads {
+		up.abort(m.fs)
+	}
+}
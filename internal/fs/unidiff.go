@@ -0,0 +1,406 @@
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	PatchFormatAuto    = "auto"
+	PatchFormatRexd    = "rexd"
+	PatchFormatUnified = "unified"
+	PatchFormatGit     = "git"
+
+	maxPatchFuzz = 2
+)
+
+var hunkHeaderPattern = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+func DetectPatchFormat(text string) string {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		switch {
+		case strings.TrimSpace(line) == patchBeginMarker:
+			return PatchFormatRexd
+		case strings.HasPrefix(line, "diff --git "):
+			return PatchFormatGit
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			return PatchFormatUnified
+		}
+	}
+	return PatchFormatRexd
+}
+
+func ParsePatchFormat(text, format string) ([]PatchHunk, string, error) {
+	if format == "" || format == PatchFormatAuto {
+		format = DetectPatchFormat(text)
+	}
+	var hunks []PatchHunk
+	var err error
+	switch format {
+	case PatchFormatRexd:
+		hunks, err = ParsePatch(text)
+	case PatchFormatUnified, PatchFormatGit:
+		hunks, err = parseUnifiedDiff(text)
+	default:
+		return nil, "", fmt.Errorf("unsupported patch format %q", format)
+	}
+	return hunks, format, err
+}
+
+type fileDiff struct {
+	git        bool
+	oldPath    string
+	newPath    string
+	headerOld  string
+	headerNew  string
+	renameFrom string
+	renameTo   string
+	newFile    bool
+	deleted    bool
+	newMode    os.FileMode
+	chunks     []PatchChunk
+	sawPaths   bool
+}
+
+func parseUnifiedDiff(text string) ([]PatchHunk, error) {
+	normalized := strings.ReplaceAll(text, "\r\n", "\n")
+	lines := strings.Split(normalized, "\n")
+
+	hunks := make([]PatchHunk, 0)
+	var cur *fileDiff
+	flush := func() error {
+		if cur == nil {
+			return nil
+		}
+		hunk, err := cur.hunk()
+		if err != nil {
+			return err
+		}
+		hunks = append(hunks, hunk)
+		cur = nil
+		return nil
+	}
+
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			cur = &fileDiff{git: true}
+			cur.headerOld, cur.headerNew = splitGitHeader(strings.TrimPrefix(line, "diff --git "))
+			i++
+
+		case cur != nil && cur.git && len(cur.chunks) == 0 && !cur.sawPaths && isGitExtendedHeader(line):
+			if err := cur.extendedHeader(line); err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			i++
+
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			if cur == nil || cur.sawPaths || len(cur.chunks) > 0 {
+				if err := flush(); err != nil {
+					return nil, err
+				}
+				cur = &fileDiff{}
+			}
+			cur.oldPath = parseDiffPath(line[4:])
+			cur.newPath = parseDiffPath(lines[i+1][4:])
+			cur.sawPaths = true
+			i += 2
+
+		case strings.HasPrefix(line, "@@ "):
+			if cur == nil {
+				return nil, fmt.Errorf("invalid patch: hunk without file header at line %d", i+1)
+			}
+			chunk, next, err := parseUnifiedHunk(lines, i)
+			if err != nil {
+				return nil, err
+			}
+			cur.chunks = append(cur.chunks, chunk)
+			i = next
+
+		default:
+			i++
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	if len(hunks) == 0 {
+		return nil, errors.New("patch does not contain any file diffs")
+	}
+	return hunks, nil
+}
+
+func parseUnifiedHunk(lines []string, i int) (PatchChunk, int, error) {
+	m := hunkHeaderPattern.FindStringSubmatch(lines[i])
+	if m == nil {
+		return PatchChunk{}, 0, fmt.Errorf("invalid hunk header at line %d: %q", i+1, lines[i])
+	}
+	oldStart, _ := strconv.Atoi(m[1])
+	oldCount, newCount := 1, 1
+	if m[2] != "" {
+		oldCount, _ = strconv.Atoi(m[2])
+	}
+	if m[4] != "" {
+		newCount, _ = strconv.Atoi(m[4])
+	}
+	chunk := PatchChunk{OldStart: oldStart, HasRange: true, OldLines: []string{}, NewLines: []string{}}
+	header := i + 1
+	i++
+	var last byte
+	for oldCount > 0 || newCount > 0 || (i < len(lines) && strings.HasPrefix(lines[i], `\`)) {
+		if i >= len(lines) {
+			return PatchChunk{}, 0, fmt.Errorf("hunk at line %d is truncated", header-1)
+		}
+		line := lines[i]
+		kind := byte(' ')
+		content := ""
+		if line != "" {
+			kind, content = line[0], line[1:]
+		}
+		switch kind {
+		case ' ':
+			chunk.OldLines = append(chunk.OldLines, content)
+			chunk.NewLines = append(chunk.NewLines, content)
+			oldCount--
+			newCount--
+		case '-':
+			chunk.OldLines = append(chunk.OldLines, content)
+			oldCount--
+		case '+':
+			chunk.NewLines = append(chunk.NewLines, content)
+			newCount--
+		case '\\':
+			switch last {
+			case '-':
+				chunk.OldNoEOL = true
+			case '+':
+				chunk.NewNoEOL = true
+			default:
+				chunk.OldNoEOL, chunk.NewNoEOL = true, true
+			}
+		default:
+			return PatchChunk{}, 0, fmt.Errorf("unexpected line %d in hunk: %q", i+1, line)
+		}
+		if oldCount < 0 || newCount < 0 {
+			return PatchChunk{}, 0, fmt.Errorf("hunk at line %d has more lines than its header declares", header-1)
+		}
+		last = kind
+		i++
+	}
+	return chunk, i, nil
+}
+
+func isGitExtendedHeader(line string) bool {
+	for _, prefix := range []string{
+		"old mode ", "new mode ", "new file mode ", "deleted file mode ",
+		"rename from ", "rename to ", "copy from ", "copy to ",
+		"similarity index ", "dissimilarity index ", "index ",
+		"Binary files ", "GIT binary patch",
+	} {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *fileDiff) extendedHeader(line string) error {
+	switch {
+	case strings.HasPrefix(line, "new file mode "):
+		d.newFile = true
+		return d.setMode(strings.TrimPrefix(line, "new file mode "))
+	case strings.HasPrefix(line, "deleted file mode "):
+		d.deleted = true
+	case strings.HasPrefix(line, "new mode "):
+		return d.setMode(strings.TrimPrefix(line, "new mode "))
+	case strings.HasPrefix(line, "rename from "):
+		d.renameFrom = unquoteDiffPath(strings.TrimPrefix(line, "rename from "))
+	case strings.HasPrefix(line, "rename to "):
+		d.renameTo = unquoteDiffPath(strings.TrimPrefix(line, "rename to "))
+	case strings.HasPrefix(line, "copy from "), strings.HasPrefix(line, "copy to "):
+		return errors.New("copy patches are not supported")
+	case strings.HasPrefix(line, "Binary files "), strings.HasPrefix(line, "GIT binary patch"):
+		return errors.New("binary patches are not supported")
+	}
+	return nil
+}
+
+func (d *fileDiff) setMode(mode string) error {
+	v, err := strconv.ParseUint(strings.TrimSpace(mode), 8, 32)
+	if err != nil {
+		return fmt.Errorf("invalid file mode %q", mode)
+	}
+	if kind := v &^ 0o7777; kind != 0o100000 {
+		return fmt.Errorf("unsupported file mode %o; only regular files can be patched", v)
+	}
+	d.newMode = os.FileMode(v & 0o777)
+	return nil
+}
+
+func (d *fileDiff) hunk() (PatchHunk, error) {
+	oldPath, newPath := d.oldPath, d.newPath
+	if !d.sawPaths {
+		oldPath, newPath = d.headerOld, d.headerNew
+	}
+	if d.git || ((oldPath == "" || strings.HasPrefix(oldPath, "a/")) && (newPath == "" || strings.HasPrefix(newPath, "b/"))) {
+		oldPath = strings.TrimPrefix(oldPath, "a/")
+		newPath = strings.TrimPrefix(newPath, "b/")
+	}
+	if d.renameFrom != "" {
+		oldPath = d.renameFrom
+	}
+	if d.renameTo != "" {
+		newPath = d.renameTo
+	}
+
+	switch {
+	case d.deleted || (d.sawPaths && newPath == ""):
+		if oldPath == "" {
+			return PatchHunk{}, errors.New("invalid patch: deleted file without a path")
+		}
+		return PatchHunk{Type: "delete", Path: oldPath}, nil
+
+	case d.newFile || (d.sawPaths && oldPath == ""):
+		if newPath == "" {
+			return PatchHunk{}, errors.New("invalid patch: new file without a path")
+		}
+		var b strings.Builder
+		noEOL := false
+		for _, chunk := range d.chunks {
+			for _, line := range chunk.NewLines {
+				b.WriteString(line)
+				b.WriteByte('\n')
+			}
+			noEOL = chunk.NewNoEOL
+		}
+		contents := b.String()
+		if noEOL {
+			contents = strings.TrimSuffix(contents, "\n")
+		}
+		return PatchHunk{Type: "add", Path: newPath, Contents: contents, Mode: d.newMode, ExplicitEOL: true}, nil
+	}
+
+	if oldPath == "" {
+		return PatchHunk{}, errors.New("invalid patch: file diff without a path")
+	}
+	if !d.git {
+		return PatchHunk{Type: "update", Path: newPath, Chunks: d.chunks}, nil
+	}
+	hunk := PatchHunk{Type: "update", Path: oldPath, Chunks: d.chunks, Mode: d.newMode}
+	if newPath != "" && newPath != oldPath {
+		hunk.MovePath = newPath
+	}
+	return hunk, nil
+}
+
+func splitGitHeader(header string) (string, string) {
+	if strings.HasPrefix(header, `"`) {
+		if end := strings.Index(header[1:], `" `); end >= 0 {
+			return unquoteDiffPath(header[:end+2]), unquoteDiffPath(header[end+3:])
+		}
+	}
+	if idx := strings.LastIndex(header, " b/"); idx >= 0 {
+		return header[:idx], header[idx+1:]
+	}
+	if old, new, ok := strings.Cut(header, " "); ok {
+		return old, new
+	}
+	return header, header
+}
+
+func parseDiffPath(field string) string {
+	if tab := strings.IndexByte(field, '\t'); tab >= 0 {
+		field = field[:tab]
+	}
+	field = unquoteDiffPath(strings.TrimRight(field, " "))
+	if field == "/dev/null" {
+		return ""
+	}
+	return field
+}
+
+func unquoteDiffPath(path string) string {
+	if strings.HasPrefix(path, `"`) {
+		if unquoted, err := strconv.Unquote(path); err == nil {
+			return unquoted
+		}
+	}
+	return path
+}
+
+func contextEdges(oldLines, newLines []string) (int, int) {
+	limit := min(len(oldLines), len(newLines))
+	lead := 0
+	for lead < limit && oldLines[lead] == newLines[lead] {
+		lead++
+	}
+	trail := 0
+	for trail < limit-lead && oldLines[len(oldLines)-1-trail] == newLines[len(newLines)-1-trail] {
+		trail++
+	}
+	return lead, trail
+}
+
+func locateRangedChunk(lines []string, chunk PatchChunk, lineIndex int) (patchReplacement, *MatchFailure) {
+	if len(chunk.OldLines) == 0 {
+		start := max(chunk.OldStart, lineIndex)
+		return patchReplacement{Start: min(start, len(lines)), NewLine: chunk.NewLines}, nil
+	}
+	hint := max(chunk.OldStart-1, 0)
+	lead, trail := contextEdges(chunk.OldLines, chunk.NewLines)
+	for fuzz := 0; fuzz <= maxPatchFuzz; fuzz++ {
+		dropLead, dropTrail := min(fuzz, lead), min(fuzz, trail)
+		if fuzz > 0 && dropLead < fuzz && dropTrail < fuzz {
+			break
+		}
+		pattern := chunk.OldLines[dropLead : len(chunk.OldLines)-dropTrail]
+		if len(pattern) == 0 {
+			break
+		}
+		if found := seekNear(lines, pattern, lineIndex, hint+dropLead); found >= 0 {
+			return patchReplacement{
+				Start:   found,
+				OldLen:  len(pattern),
+				NewLine: chunk.NewLines[dropLead : len(chunk.NewLines)-dropTrail],
+			}, nil
+		}
+	}
+	return patchReplacement{}, notFoundFailure(fmt.Sprintf("failed to find expected patch lines near line %d", chunk.OldStart), lines, chunk.OldLines)
+}
+
+func seekNear(lines, pattern []string, from, hint int) int {
+	for _, compare := range lineComparators {
+		best := -1
+		for i := from; i+len(pattern) <= len(lines); i++ {
+			if !sequenceMatches(lines, pattern, i, compare) {
+				continue
+			}
+			if best == -1 || abs(i-hint) < abs(best-hint) {
+				best = i
+			}
+			if i >= hint {
+				break
+			}
+		}
+		if best >= 0 {
+			return best
+		}
+	}
+	return -1
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,252 @@
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samiralibabic/rexd/internal/events"
+)
+
+const (
+	defaultWatchDebounce = 100 * time.Millisecond
+	maxWatchDelayFactor  = 10
+)
+
+var ErrWatchNotFound = errors.New("watch not found")
+
+type WatchOptions struct {
+	Recursive bool
+	Include   []string
+	Exclude   []string
+	Debounce  time.Duration
+}
+
+type WatchChange struct {
+	Type    string `json:"type"`
+	Path    string `json:"path"`
+	OldPath string `json:"old_path,omitempty"`
+	IsDir   bool   `json:"is_dir,omitempty"`
+	MTime   *int64 `json:"mtime,omitempty"`
+}
+
+type watchBackend interface {
+	Close() error
+}
+
+type Watch struct {
+	ID        string
+	SessionID string
+	Root      string
+	opts      WatchOptions
+	bus       *events.Bus
+	deny      DenyFunc
+	dir       string
+	fileOnly  bool
+	backend   watchBackend
+
+	mu      sync.Mutex
+	pending []WatchChange
+	index   map[string]int
+	first   time.Time
+	timer   *time.Timer
+	closed  bool
+}
+
+type WatchManager struct {
+	mu      sync.Mutex
+	bus     *events.Bus
+	deny    DenyFunc
+	watches map[string]*Watch
+}
+
+func NewWatchManager(bus *events.Bus, deny DenyFunc) *WatchManager {
+	return &WatchManager{bus: bus, deny: deny, watches: map[string]*Watch{}}
+}
+
+func (m *WatchManager) Watch(sessionID, root string, opts WatchOptions) (*Watch, error) {
+	st, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Debounce <= 0 {
+		opts.Debounce = defaultWatchDebounce
+	}
+	w := &Watch{
+		ID:        fmt.Sprintf("watch_%d", time.Now().UnixNano()),
+		SessionID: sessionID,
+		Root:      root,
+		opts:      opts,
+		bus:       m.bus,
+		deny:      m.deny,
+		dir:       root,
+		index:     map[string]int{},
+	}
+	if !st.IsDir() {
+		w.dir = filepath.Dir(root)
+		w.fileOnly = true
+		w.opts.Recursive = false
+	}
+	backend, err := startWatchBackend(w)
+	if err != nil {
+		return nil, err
+	}
+	w.backend = backend
+	m.mu.Lock()
+	m.watches[w.ID] = w
+	m.mu.Unlock()
+	return w, nil
+}
+
+func (m *WatchManager) Unwatch(id, sessionID string) error {
+	m.mu.Lock()
+	w, ok := m.watches[id]
+	if !ok || w.SessionID != sessionID {
+		m.mu.Unlock()
+		return ErrWatchNotFound
+	}
+	delete(m.watches, id)
+	m.mu.Unlock()
+	return w.close()
+}
+
+func (m *WatchManager) CloseSession(sessionID string) {
+	m.mu.Lock()
+	closing := []*Watch{}
+	for id, w := range m.watches {
+		if w.SessionID == sessionID {
+			closing = append(closing, w)
+			delete(m.watches, id)
+		}
+	}
+	m.mu.Unlock()
+	for _, w := range closing {
+		_ = w.close()
+	}
+}
+
+func (w *Watch) close() error {
+	w.mu.Lock()
+	w.closed = true
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	w.mu.Unlock()
+	return w.backend.Close()
+}
+
+func (w *Watch) rel(p string) string {
+	rel, err := filepath.Rel(w.dir, p)
+	if err != nil {
+		return filepath.ToSlash(p)
+	}
+	return filepath.ToSlash(rel)
+}
+
+func (w *Watch) denied(p string) bool {
+	return w.deny != nil && w.deny(p)
+}
+
+func (w *Watch) skipDir(p string) bool {
+	if p == w.dir {
+		return false
+	}
+	if !w.opts.Recursive || w.denied(p) {
+		return true
+	}
+	return len(w.opts.Exclude) > 0 && matchFilter(w.opts.Exclude, w.rel(p))
+}
+
+func (w *Watch) accept(p string) bool {
+	if w.fileOnly {
+		return p == w.Root
+	}
+	rel := w.rel(p)
+	if strings.HasPrefix(rel, "../") || rel == ".." || w.denied(p) {
+		return false
+	}
+	if len(w.opts.Exclude) > 0 && matchFilter(w.opts.Exclude, rel) {
+		return false
+	}
+	if dir := filepath.Dir(p); dir != w.dir && w.skipDir(dir) {
+		return false
+	}
+	return len(w.opts.Include) == 0 || matchFilter(w.opts.Include, rel)
+}
+
+func (w *Watch) record(kind, p, oldPath string, isDir bool) {
+	if !w.accept(p) && (oldPath == "" || !w.accept(oldPath)) {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return
+	}
+	if i, ok := w.index[p]; ok {
+		prev := &w.pending[i]
+		switch {
+		case prev.Type == kind && kind != "renamed":
+			return
+		case kind == "modified" && (prev.Type == "created" || prev.Type == "renamed"):
+			return
+		case kind == "deleted" && prev.Type == "created":
+			prev.Type = ""
+			delete(w.index, p)
+		case kind == "created" && prev.Type == "deleted":
+			prev.Type = "modified"
+		default:
+			prev.Type = kind
+			prev.OldPath = oldPath
+		}
+	} else {
+		w.index[p] = len(w.pending)
+		w.pending = append(w.pending, WatchChange{Type: kind, Path: p, OldPath: oldPath, IsDir: isDir})
+	}
+	now := time.Now()
+	if w.timer == nil {
+		w.first = now
+		w.timer = time.AfterFunc(w.opts.Debounce, w.flush)
+	} else if now.Sub(w.first) < w.opts.Debounce*maxWatchDelayFactor {
+		w.timer.Reset(w.opts.Debounce)
+	}
+}
+
+func (w *Watch) flush() {
+	w.mu.Lock()
+	pending := w.pending
+	w.pending = nil
+	w.index = map[string]int{}
+	w.timer = nil
+	closed := w.closed
+	w.mu.Unlock()
+	if closed {
+		return
+	}
+	changes := []WatchChange{}
+	for _, c := range pending {
+		if c.Type == "" {
+			continue
+		}
+		if c.Type != "deleted" {
+			if st, err := os.Lstat(c.Path); err == nil {
+				mtime := st.ModTime().UnixMilli()
+				c.MTime = &mtime
+			}
+		}
+		changes = append(changes, c)
+	}
+	if len(changes) == 0 {
+		return
+	}
+	w.bus.Publish(w.SessionID, "fs.changed", map[string]any{
+		"session_id": w.SessionID,
+		"watch_id":   w.ID,
+		"root":       w.Root,
+		"changes":    changes,
+	})
+}
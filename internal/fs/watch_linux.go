@@ -0,0 +1,195 @@
+//go:build linux
+
+package fs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+const inotifyMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MODIFY | syscall.IN_ATTRIB |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_ONLYDIR | syscall.IN_DONT_FOLLOW | syscall.IN_EXCL_UNLINK
+
+type inotifyBackend struct {
+	w    *Watch
+	fd   int
+	file *os.File
+	mu   sync.Mutex
+	dirs map[int]string
+	wds  map[string]int
+}
+
+type inotifyMove struct {
+	path  string
+	isDir bool
+}
+
+func startWatchBackend(w *Watch) (watchBackend, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	b := &inotifyBackend{
+		w:    w,
+		fd:   fd,
+		file: os.NewFile(uintptr(fd), "inotify"),
+		dirs: map[int]string{},
+		wds:  map[string]int{},
+	}
+	if err := b.add(w.dir); err != nil {
+		_ = b.file.Close()
+		return nil, err
+	}
+	if w.opts.Recursive {
+		b.addTree(w.dir, false)
+	}
+	go b.loop()
+	return b, nil
+}
+
+func (b *inotifyBackend) Close() error {
+	return b.file.Close()
+}
+
+func (b *inotifyBackend) add(dir string) error {
+	wd, err := syscall.InotifyAddWatch(b.fd, dir, inotifyMask)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	b.dirs[wd] = dir
+	b.wds[dir] = wd
+	b.mu.Unlock()
+	return nil
+}
+
+func (b *inotifyBackend) addTree(root string, emit bool) {
+	_ = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if p == root {
+			if root != b.w.dir {
+				_ = b.add(p)
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if b.w.skipDir(p) {
+				return filepath.SkipDir
+			}
+			if err := b.add(p); err != nil {
+				return filepath.SkipDir
+			}
+		}
+		if emit {
+			b.w.record("created", p, "", d.IsDir())
+		}
+		return nil
+	})
+}
+
+func (b *inotifyBackend) removeTree(root string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for dir, wd := range b.wds {
+		if dir == root || strings.HasPrefix(dir, root+string(filepath.Separator)) {
+			_, _ = syscall.InotifyRmWatch(b.fd, uint32(wd))
+			delete(b.wds, dir)
+			delete(b.dirs, wd)
+		}
+	}
+}
+
+func (b *inotifyBackend) renameTree(from, to string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for dir, wd := range b.wds {
+		if dir == from || strings.HasPrefix(dir, from+string(filepath.Separator)) {
+			next := to + strings.TrimPrefix(dir, from)
+			delete(b.wds, dir)
+			b.wds[next] = wd
+			b.dirs[wd] = next
+		}
+	}
+}
+
+func (b *inotifyBackend) loop() {
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := b.file.Read(buf)
+		if err != nil {
+			return
+		}
+		moves := map[uint32]inotifyMove{}
+		for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+			wd := int(int32(binary.NativeEndian.Uint32(buf[off:])))
+			mask := binary.NativeEndian.Uint32(buf[off+4:])
+			cookie := binary.NativeEndian.Uint32(buf[off+8:])
+			nameLen := int(binary.NativeEndian.Uint32(buf[off+12:]))
+			start := off + syscall.SizeofInotifyEvent
+			name := string(bytes.TrimRight(buf[start:start+nameLen], "\x00"))
+			off = start + nameLen
+			b.handle(wd, mask, cookie, name, moves)
+		}
+		for _, mv := range moves {
+			if mv.isDir {
+				b.removeTree(mv.path)
+			}
+			b.w.record("deleted", mv.path, "", mv.isDir)
+		}
+	}
+}
+
+func (b *inotifyBackend) handle(wd int, mask, cookie uint32, name string, moves map[uint32]inotifyMove) {
+	b.mu.Lock()
+	dir, ok := b.dirs[wd]
+	if ok && mask&syscall.IN_IGNORED != 0 {
+		delete(b.dirs, wd)
+		delete(b.wds, dir)
+	}
+	b.mu.Unlock()
+	if !ok || name == "" {
+		return
+	}
+	p := filepath.Join(dir, name)
+	isDir := mask&syscall.IN_ISDIR != 0
+	switch {
+	case mask&syscall.IN_CREATE != 0:
+		b.w.record("created", p, "", isDir)
+		if isDir && !b.w.skipDir(p) {
+			b.addTree(p, true)
+		}
+	case mask&syscall.IN_MOVED_FROM != 0:
+		moves[cookie] = inotifyMove{path: p, isDir: isDir}
+	case mask&syscall.IN_MOVED_TO != 0:
+		if from, ok := moves[cookie]; ok {
+			delete(moves, cookie)
+			if isDir {
+				if b.w.skipDir(p) {
+					b.removeTree(from.path)
+				} else {
+					b.renameTree(from.path, p)
+				}
+			}
+			b.w.record("renamed", p, from.path, isDir)
+			return
+		}
+		b.w.record("created", p, "", isDir)
+		if isDir && !b.w.skipDir(p) {
+			b.addTree(p, true)
+		}
+	case mask&syscall.IN_DELETE != 0:
+		b.w.record("deleted", p, "", isDir)
+	case mask&(syscall.IN_MODIFY|syscall.IN_ATTRIB) != 0:
+		if !isDir {
+			b.w.record("modified", p, "", false)
+		}
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package fs
+
+import "errors"
+
+func startWatchBackend(w *Watch) (watchBackend, error) {
+	return nil, errors.New("fs.watch is only supported on linux")
+}
@@ -0,0 +1,36 @@
+//go:build linux
+
+package fs
+
+import (
+	"bytes"
+	"syscall"
+)
+
+func copyXattrs(from, to string) {
+	size, err := syscall.Listxattr(from, nil)
+	if err != nil || size <= 0 {
+		return
+	}
+	names := make([]byte, size)
+	size, err = syscall.Listxattr(from, names)
+	if err != nil {
+		return
+	}
+	for _, name := range bytes.Split(names[:size], []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+		attr := string(name)
+		n, err := syscall.Getxattr(from, attr, nil)
+		if err != nil {
+			continue
+		}
+		value := make([]byte, n)
+		n, err = syscall.Getxattr(from, attr, value)
+		if err != nil {
+			continue
+		}
+		_ = syscall.Setxattr(to, attr, value[:n], 0)
+	}
+}
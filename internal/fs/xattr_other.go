@@ -0,0 +1,5 @@
+//go:build !linux
+
+package fs
+
+func copyXattrs(from, to string) {}
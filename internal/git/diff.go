@@ -0,0 +1,208 @@
+package git
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+type DiffHunk struct {
+	OldStart int      `json:"old_start"`
+	OldLines int      `json:"old_lines"`
+	NewStart int      `json:"new_start"`
+	NewLines int      `json:"new_lines"`
+	Header   string   `json:"header,omitempty"`
+	Lines    []string `json:"lines"`
+}
+
+type DiffFile struct {
+	Path    string     `json:"path"`
+	OldPath string     `json:"old_path,omitempty"`
+	Status  string     `json:"status"`
+	OldMode string     `json:"old_mode,omitempty"`
+	NewMode string     `json:"new_mode,omitempty"`
+	Binary  bool       `json:"binary"`
+	Added   int        `json:"added"`
+	Removed int        `json:"removed"`
+	Hunks   []DiffHunk `json:"hunks"`
+}
+
+type DiffOptions struct {
+	Staged  bool
+	Base    string
+	Target  string
+	Context int
+	Limits
+}
+
+type DiffResult struct {
+	Root      string     `json:"root"`
+	Files     []DiffFile `json:"files"`
+	Added     int        `json:"added"`
+	Removed   int        `json:"removed"`
+	Truncated bool       `json:"truncated"`
+}
+
+func (s *Service) Diff(ctx context.Context, repo Repo, opts DiffOptions) (*DiffResult, error) {
+	for _, rev := range []string{opts.Base, opts.Target} {
+		if err := ValidRev(rev); err != nil {
+			return nil, err
+		}
+	}
+	args := []string{"diff", "--no-color", "--no-ext-diff", "--no-textconv", "-M", "--src-prefix=a/", "--dst-prefix=b/", "-U" + strconv.Itoa(opts.Context)}
+	if opts.Staged {
+		args = append(args, "--cached")
+	}
+	if opts.Base != "" {
+		args = append(args, opts.Base)
+	}
+	if opts.Target != "" {
+		args = append(args, opts.Target)
+	}
+	out, truncated, err := s.run(ctx, repo.Root, opts.MaxBytes, append(args, pathspecs(repo)...)...)
+	if err != nil {
+		return nil, err
+	}
+	files := parseDiff(string(out))
+	if truncated && len(files) > 0 {
+		files = files[:len(files)-1]
+	}
+	result := &DiffResult{Root: repo.Root, Files: []DiffFile{}, Truncated: truncated}
+	for _, f := range files {
+		if s.denied(repo, f.Path) || (f.OldPath != "" && s.denied(repo, f.OldPath)) {
+			continue
+		}
+		if opts.MaxEntries > 0 && len(result.Files) >= opts.MaxEntries {
+			result.Truncated = true
+			break
+		}
+		result.Files = append(result.Files, f)
+		result.Added += f.Added
+		result.Removed += f.Removed
+	}
+	return result, nil
+}
+
+func parseDiff(text string) []DiffFile {
+	files := []DiffFile{}
+	var cur *DiffFile
+	var hunk *DiffHunk
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(line, "diff --git ") {
+			files = append(files, DiffFile{Status: "modified", Hunks: []DiffHunk{}})
+			cur, hunk = &files[len(files)-1], nil
+			cur.OldPath, cur.Path = splitDiffHeader(line[len("diff --git "):])
+			continue
+		}
+		if cur == nil {
+			continue
+		}
+		if hunk != nil {
+			switch {
+			case strings.HasPrefix(line, "+"):
+				cur.Added++
+			case strings.HasPrefix(line, "-"):
+				cur.Removed++
+			case strings.HasPrefix(line, " "), strings.HasPrefix(line, `\`):
+			default:
+				hunk = nil
+			}
+			if hunk != nil {
+				hunk.Lines = append(hunk.Lines, line)
+				continue
+			}
+		}
+		switch {
+		case strings.HasPrefix(line, "@@ "):
+			h, ok := parseHunkHeader(line)
+			if !ok {
+				continue
+			}
+			cur.Hunks = append(cur.Hunks, h)
+			hunk = &cur.Hunks[len(cur.Hunks)-1]
+		case strings.HasPrefix(line, "--- "):
+			if p := strings.TrimPrefix(unquotePath(line[4:]), "a/"); line[4:] != "/dev/null" {
+				cur.OldPath = p
+			}
+		case strings.HasPrefix(line, "+++ "):
+			if p := strings.TrimPrefix(unquotePath(line[4:]), "b/"); line[4:] != "/dev/null" {
+				cur.Path = p
+			}
+		case strings.HasPrefix(line, "new file mode "):
+			cur.Status, cur.NewMode = "added", line[len("new file mode "):]
+		case strings.HasPrefix(line, "deleted file mode "):
+			cur.Status, cur.OldMode = "deleted", line[len("deleted file mode "):]
+		case strings.HasPrefix(line, "old mode "):
+			cur.OldMode = line[len("old mode "):]
+		case strings.HasPrefix(line, "new mode "):
+			cur.NewMode = line[len("new mode "):]
+		case strings.HasPrefix(line, "rename from "):
+			cur.Status, cur.OldPath = "renamed", unquotePath(line[len("rename from "):])
+		case strings.HasPrefix(line, "rename to "):
+			cur.Path = unquotePath(line[len("rename to "):])
+		case strings.HasPrefix(line, "copy from "):
+			cur.Status, cur.OldPath = "copied", unquotePath(line[len("copy from "):])
+		case strings.HasPrefix(line, "copy to "):
+			cur.Path = unquotePath(line[len("copy to "):])
+		case strings.HasPrefix(line, "Binary files "):
+			cur.Binary = true
+		}
+	}
+	for i := range files {
+		f := &files[i]
+		switch f.Status {
+		case "added":
+			f.OldPath = ""
+		case "deleted":
+			f.Path, f.OldPath = f.OldPath, ""
+		case "modified":
+			f.OldPath = ""
+		}
+	}
+	return files
+}
+
+func splitDiffHeader(rest string) (string, string) {
+	if strings.HasPrefix(rest, `"`) {
+		if end := strings.Index(rest[1:], `" `); end >= 0 {
+			a := unquotePath(rest[:end+2])
+			b := unquotePath(rest[end+3:])
+			return strings.TrimPrefix(a, "a/"), strings.TrimPrefix(b, "b/")
+		}
+	}
+	if n := len(rest); n%2 == 1 {
+		a, b := rest[:n/2], rest[n/2+1:]
+		if strings.TrimPrefix(a, "a/") == strings.TrimPrefix(b, "b/") {
+			return strings.TrimPrefix(a, "a/"), strings.TrimPrefix(b, "b/")
+		}
+	}
+	if i := strings.Index(rest, " b/"); i >= 0 {
+		return strings.TrimPrefix(rest[:i], "a/"), rest[i+3:]
+	}
+	return rest, rest
+}
+
+func parseHunkHeader(line string) (DiffHunk, bool) {
+	end := strings.Index(line[3:], " @@")
+	if end < 0 {
+		return DiffHunk{}, false
+	}
+	ranges := strings.Fields(line[3 : 3+end])
+	if len(ranges) != 2 {
+		return DiffHunk{}, false
+	}
+	h := DiffHunk{Header: strings.TrimSpace(line[3+end+3:]), Lines: []string{}}
+	h.OldStart, h.OldLines = parseRange(strings.TrimPrefix(ranges[0], "-"))
+	h.NewStart, h.NewLines = parseRange(strings.TrimPrefix(ranges[1], "+"))
+	return h, true
+}
+
+func parseRange(r string) (int, int) {
+	start, count, ok := strings.Cut(r, ",")
+	s, _ := strconv.Atoi(start)
+	if !ok {
+		return s, 1
+	}
+	n, _ := strconv.Atoi(count)
+	return s, n
+}
@@ -0,0 +1,182 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	ErrNotRepository = errors.New("not a git repository")
+	ErrUnavailable   = errors.New("git binary not found")
+	ErrTimeout       = errors.New("git command timed out")
+)
+
+type DenyFunc func(path string) bool
+
+type Service struct {
+	binary string
+	deny   DenyFunc
+}
+
+type Repo struct {
+	Root  string
+	Paths []string
+}
+
+type Limits struct {
+	MaxEntries int
+	MaxBytes   int64
+}
+
+func NewService(binary string, deny DenyFunc) *Service {
+	if binary == "" {
+		binary = "git"
+	}
+	return &Service{binary: binary, deny: deny}
+}
+
+func (s *Service) denied(repo Repo, rel string) bool {
+	return s.deny != nil && s.deny(filepath.Join(repo.Root, filepath.FromSlash(rel)))
+}
+
+func (s *Service) Root(ctx context.Context, dir string) (string, error) {
+	out, _, err := s.run(ctx, dir, 0, "rev-parse", "--is-inside-work-tree", "--show-cdup")
+	if err != nil {
+		return "", err
+	}
+	inside, cdup, _ := strings.Cut(string(out), "\n")
+	if strings.TrimSpace(inside) != "true" {
+		return "", ErrNotRepository
+	}
+	return filepath.Join(dir, strings.TrimSpace(cdup)), nil
+}
+
+func ValidRev(rev string) error {
+	if strings.HasPrefix(rev, "-") || strings.ContainsAny(rev, " \t\r\n\x00") {
+		return fmt.Errorf("invalid revision %q", rev)
+	}
+	return nil
+}
+
+func pathspecs(repo Repo) []string {
+	if len(repo.Paths) == 0 {
+		return nil
+	}
+	return append([]string{"--"}, repo.Paths...)
+}
+
+type limitWriter struct {
+	buf       bytes.Buffer
+	max       int64
+	truncated bool
+	cancel    context.CancelFunc
+}
+
+func (w *limitWriter) Write(p []byte) (int, error) {
+	if w.truncated {
+		return len(p), nil
+	}
+	if w.max > 0 && int64(w.buf.Len()+len(p)) > w.max {
+		w.buf.Write(p[:w.max-int64(w.buf.Len())])
+		w.truncated = true
+		if w.cancel != nil {
+			w.cancel()
+		}
+		return len(p), nil
+	}
+	return w.buf.Write(p)
+}
+
+func (s *Service) run(ctx context.Context, dir string, maxBytes int64, args ...string) ([]byte, bool, error) {
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	full := append([]string{
+		"--no-pager",
+		"-c", "core.quotepath=off",
+		"-c", "core.fsmonitor=false",
+		"-c", "color.ui=never",
+	}, args...)
+	cmd := exec.CommandContext(runCtx, s.binary, full...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_OPTIONAL_LOCKS=0",
+		"GIT_LITERAL_PATHSPECS=1",
+		"GIT_PAGER=cat",
+		"LC_ALL=C",
+	)
+	stdout := &limitWriter{max: maxBytes, cancel: cancel}
+	stderr := &limitWriter{max: 64 * 1024}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	err := cmd.Run()
+	if stdout.truncated {
+		return stdout.buf.Bytes(), true, nil
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, false, fmt.Errorf("%w: git %s", ErrTimeout, args[0])
+	}
+	if errors.Is(err, exec.ErrNotFound) {
+		return nil, false, ErrUnavailable
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		msg := strings.TrimSpace(stderr.buf.String())
+		if strings.Contains(msg, "not a git repository") {
+			return nil, false, ErrNotRepository
+		}
+		if msg == "" {
+			msg = exitErr.Error()
+		}
+		return nil, false, fmt.Errorf("git %s: %s", args[0], msg)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return stdout.buf.Bytes(), false, nil
+}
+
+func unquotePath(p string) string {
+	if len(p) < 2 || p[0] != '"' || p[len(p)-1] != '"' {
+		return p
+	}
+	var b strings.Builder
+	for i := 1; i < len(p)-1; i++ {
+		c := p[i]
+		if c != '\\' || i+1 >= len(p)-1 {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		switch p[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		case 'a':
+			b.WriteByte('\a')
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case 'v':
+			b.WriteByte('\v')
+		case '0', '1', '2', '3':
+			if i+2 < len(p)-1 {
+				b.WriteByte((p[i]-'0')<<6 | (p[i+1]-'0')<<3 | (p[i+2] - '0'))
+				i += 2
+			}
+		default:
+			b.WriteByte(p[i])
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,205 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Signature struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	Date  string `json:"date"`
+}
+
+type Commit struct {
+	OID       string    `json:"oid"`
+	Parents   []string  `json:"parents"`
+	Author    Signature `json:"author"`
+	Committer Signature `json:"committer"`
+	Subject   string    `json:"subject"`
+	Body      string    `json:"body,omitempty"`
+}
+
+type LogOptions struct {
+	Rev  string
+	Skip int
+	Limits
+}
+
+type LogResult struct {
+	Root      string   `json:"root"`
+	Commits   []Commit `json:"commits"`
+	Truncated bool     `json:"truncated"`
+}
+
+const logFormat = "--format=%x1e%H%x00%P%x00%an%x00%ae%x00%aI%x00%cn%x00%ce%x00%cI%x00%B"
+
+func (s *Service) Log(ctx context.Context, repo Repo, opts LogOptions) (*LogResult, error) {
+	if err := ValidRev(opts.Rev); err != nil {
+		return nil, err
+	}
+	args := []string{"log", "--no-color", logFormat}
+	if opts.MaxEntries > 0 {
+		args = append(args, "-n", strconv.Itoa(opts.MaxEntries+1))
+	}
+	if opts.Skip > 0 {
+		args = append(args, "--skip", strconv.Itoa(opts.Skip))
+	}
+	if opts.Rev != "" {
+		args = append(args, opts.Rev)
+	}
+	out, truncated, err := s.run(ctx, repo.Root, opts.MaxBytes, append(args, pathspecs(repo)...)...)
+	if err != nil {
+		return nil, err
+	}
+	records := strings.Split(string(out), "\x1e")[1:]
+	if truncated && len(records) > 0 {
+		records = records[:len(records)-1]
+	}
+	result := &LogResult{Root: repo.Root, Commits: []Commit{}, Truncated: truncated}
+	for _, rec := range records {
+		f := strings.SplitN(rec, "\x00", 9)
+		if len(f) < 9 {
+			continue
+		}
+		if opts.MaxEntries > 0 && len(result.Commits) >= opts.MaxEntries {
+			result.Truncated = true
+			break
+		}
+		subject, body, _ := strings.Cut(strings.TrimRight(f[8], "\n"), "\n")
+		result.Commits = append(result.Commits, Commit{
+			OID:       f[0],
+			Parents:   strings.Fields(f[1]),
+			Author:    Signature{Name: f[2], Email: f[3], Date: f[4]},
+			Committer: Signature{Name: f[5], Email: f[6], Date: f[7]},
+			Subject:   subject,
+			Body:      strings.TrimSpace(body),
+		})
+	}
+	return result, nil
+}
+
+type BlameLine struct {
+	Line        int    `json:"line"`
+	OrigLine    int    `json:"orig_line"`
+	OID         string `json:"oid"`
+	Author      string `json:"author"`
+	AuthorEmail string `json:"author_email"`
+	Date        string `json:"date"`
+	Summary     string `json:"summary"`
+	Text        string `json:"text"`
+}
+
+type BlameOptions struct {
+	Rev       string
+	StartLine int
+	EndLine   int
+	Limits
+}
+
+type BlameResult struct {
+	Root      string      `json:"root"`
+	Path      string      `json:"path"`
+	Lines     []BlameLine `json:"lines"`
+	Truncated bool        `json:"truncated"`
+}
+
+type blameCommit struct {
+	author, email, summary string
+	time                   int64
+	tz                     string
+}
+
+func (s *Service) Blame(ctx context.Context, repo Repo, opts BlameOptions) (*BlameResult, error) {
+	if len(repo.Paths) != 1 {
+		return nil, errors.New("blame requires exactly one path")
+	}
+	if err := ValidRev(opts.Rev); err != nil {
+		return nil, err
+	}
+	args := []string{"blame", "--porcelain"}
+	if opts.StartLine > 0 || opts.EndLine > 0 {
+		start, end := max(opts.StartLine, 1), ""
+		if opts.EndLine > 0 {
+			end = strconv.Itoa(opts.EndLine)
+		}
+		args = append(args, "-L", fmt.Sprintf("%d,%s", start, end))
+	}
+	if opts.Rev != "" {
+		args = append(args, opts.Rev)
+	}
+	out, truncated, err := s.run(ctx, repo.Root, opts.MaxBytes, append(args, pathspecs(repo)...)...)
+	if err != nil {
+		return nil, err
+	}
+	result := &BlameResult{Root: repo.Root, Path: repo.Paths[0], Lines: []BlameLine{}, Truncated: truncated}
+	commits := map[string]*blameCommit{}
+	var cur *BlameLine
+	lines := strings.Split(string(out), "\n")
+	if truncated && len(lines) > 0 {
+		lines = lines[:len(lines)-1]
+	}
+	for _, line := range lines {
+		if cur == nil {
+			f := strings.Fields(line)
+			if len(f) < 3 {
+				continue
+			}
+			cur = &BlameLine{OID: f[0]}
+			cur.OrigLine, _ = strconv.Atoi(f[1])
+			cur.Line, _ = strconv.Atoi(f[2])
+			if commits[f[0]] == nil {
+				commits[f[0]] = &blameCommit{}
+			}
+			continue
+		}
+		c := commits[cur.OID]
+		if text, ok := strings.CutPrefix(line, "\t"); ok {
+			if opts.MaxEntries > 0 && len(result.Lines) >= opts.MaxEntries {
+				result.Truncated = true
+				break
+			}
+			cur.Text, cur.Author, cur.AuthorEmail, cur.Summary = text, c.author, c.email, c.summary
+			if c.time > 0 {
+				cur.Date = time.Unix(c.time, 0).In(parseTZ(c.tz)).Format(time.RFC3339)
+			}
+			result.Lines = append(result.Lines, *cur)
+			cur = nil
+			continue
+		}
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "author":
+			c.author = value
+		case "author-mail":
+			c.email = strings.Trim(value, "<>")
+		case "author-time":
+			c.time, _ = strconv.ParseInt(value, 10, 64)
+		case "author-tz":
+			c.tz = value
+		case "summary":
+			c.summary = value
+		}
+	}
+	return result, nil
+}
+
+func parseTZ(tz string) *time.Location {
+	if len(tz) != 5 {
+		return time.UTC
+	}
+	h, err1 := strconv.Atoi(tz[1:3])
+	m, err2 := strconv.Atoi(tz[3:5])
+	if err1 != nil || err2 != nil {
+		return time.UTC
+	}
+	offset := (h*60 + m) * 60
+	if tz[0] == '-' {
+		offset = -offset
+	}
+	return time.FixedZone(tz, offset)
+}
@@ -0,0 +1,142 @@
+package git
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+type Branch struct {
+	Head     string `json:"head,omitempty"`
+	OID      string `json:"oid,omitempty"`
+	Detached bool   `json:"detached"`
+	Upstream string `json:"upstream,omitempty"`
+	Ahead    int    `json:"ahead"`
+	Behind   int    `json:"behind"`
+}
+
+type StatusEntry struct {
+	Path     string `json:"path"`
+	OrigPath string `json:"orig_path,omitempty"`
+	Kind     string `json:"kind"`
+	Index    string `json:"index,omitempty"`
+	Worktree string `json:"worktree,omitempty"`
+}
+
+type StatusOptions struct {
+	Untracked bool
+	Ignored   bool
+	Limits
+}
+
+type StatusResult struct {
+	Root      string        `json:"root"`
+	Branch    Branch        `json:"branch"`
+	Entries   []StatusEntry `json:"entries"`
+	Clean     bool          `json:"clean"`
+	Truncated bool          `json:"truncated"`
+}
+
+func (s *Service) Status(ctx context.Context, repo Repo, opts StatusOptions) (*StatusResult, error) {
+	args := []string{"status", "--porcelain=v2", "--branch", "-z"}
+	if opts.Untracked {
+		args = append(args, "--untracked-files=all")
+	} else {
+		args = append(args, "--untracked-files=no")
+	}
+	if opts.Ignored {
+		args = append(args, "--ignored=matching")
+	}
+	out, truncated, err := s.run(ctx, repo.Root, opts.MaxBytes, append(args, pathspecs(repo)...)...)
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Split(string(out), "\x00")
+	if len(fields) > 0 {
+		fields = fields[:len(fields)-1]
+	}
+	result := &StatusResult{Root: repo.Root, Entries: []StatusEntry{}, Truncated: truncated}
+	changed := 0
+	for i := 0; i < len(fields); i++ {
+		line := fields[i]
+		if strings.HasPrefix(line, "# ") {
+			parseBranchHeader(&result.Branch, line[2:])
+			continue
+		}
+		var entry StatusEntry
+		switch {
+		case strings.HasPrefix(line, "1 "):
+			f := strings.SplitN(line, " ", 9)
+			if len(f) < 9 {
+				continue
+			}
+			entry = StatusEntry{Path: f[8], Kind: "changed", Index: statusCode(f[1][0]), Worktree: statusCode(f[1][1])}
+		case strings.HasPrefix(line, "2 "):
+			f := strings.SplitN(line, " ", 10)
+			if len(f) < 10 || i+1 >= len(fields) {
+				result.Truncated = result.Truncated || i+1 >= len(fields)
+				continue
+			}
+			i++
+			kind := "renamed"
+			if strings.HasPrefix(f[8], "C") {
+				kind = "copied"
+			}
+			entry = StatusEntry{Path: f[9], OrigPath: fields[i], Kind: kind, Index: statusCode(f[1][0]), Worktree: statusCode(f[1][1])}
+		case strings.HasPrefix(line, "u "):
+			f := strings.SplitN(line, " ", 11)
+			if len(f) < 11 {
+				continue
+			}
+			entry = StatusEntry{Path: f[10], Kind: "unmerged", Index: statusCode(f[1][0]), Worktree: statusCode(f[1][1])}
+		case strings.HasPrefix(line, "? "):
+			entry = StatusEntry{Path: line[2:], Kind: "untracked"}
+		case strings.HasPrefix(line, "! "):
+			entry = StatusEntry{Path: line[2:], Kind: "ignored"}
+		default:
+			continue
+		}
+		if s.denied(repo, entry.Path) || (entry.OrigPath != "" && s.denied(repo, entry.OrigPath)) {
+			continue
+		}
+		if opts.MaxEntries > 0 && len(result.Entries) >= opts.MaxEntries {
+			result.Truncated = true
+			break
+		}
+		if entry.Kind != "ignored" {
+			changed++
+		}
+		result.Entries = append(result.Entries, entry)
+	}
+	result.Clean = changed == 0 && !result.Truncated
+	return result, nil
+}
+
+func parseBranchHeader(b *Branch, header string) {
+	key, value, _ := strings.Cut(header, " ")
+	switch key {
+	case "branch.oid":
+		if value != "(initial)" {
+			b.OID = value
+		}
+	case "branch.head":
+		if value == "(detached)" {
+			b.Detached = true
+		} else {
+			b.Head = value
+		}
+	case "branch.upstream":
+		b.Upstream = value
+	case "branch.ab":
+		ahead, behind, _ := strings.Cut(value, " ")
+		b.Ahead, _ = strconv.Atoi(strings.TrimPrefix(ahead, "+"))
+		b.Behind, _ = strconv.Atoi(strings.TrimPrefix(behind, "-"))
+	}
+}
+
+func statusCode(c byte) string {
+	if c == '.' {
+		return ""
+	}
+	return string(c)
+}
@@ -0,0 +1,225 @@
+package git
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrWorktreesDisabled = errors.New("worktrees are disabled: set workspace.worktree_root")
+	ErrWorktreeNotFound  = errors.New("worktree not found")
+	ErrWorktreeLimit     = errors.New("max worktrees per session reached")
+)
+
+var worktreeName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+type Worktree struct {
+	Name      string    `json:"name"`
+	Path      string    `json:"path"`
+	Branch    string    `json:"branch"`
+	Base      string    `json:"base"`
+	Repo      string    `json:"repo"`
+	SessionID string    `json:"session_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type WorktreeOptions struct {
+	Root          string
+	BranchPrefix  string
+	MaxPerSession int
+}
+
+type CreateWorktreeOptions struct {
+	Name   string
+	Branch string
+	Base   string
+}
+
+type RemoveWorktreeResult struct {
+	Worktree
+	BranchDeleted bool `json:"branch_deleted"`
+}
+
+func (r *RemoveWorktreeResult) AffectedPaths() []string { return []string{r.Path} }
+
+type WorktreeManager struct {
+	git       *Service
+	opts      WorktreeOptions
+	mu        sync.Mutex
+	worktrees map[string]*Worktree
+}
+
+func NewWorktreeManager(git *Service, opts WorktreeOptions) *WorktreeManager {
+	return &WorktreeManager{git: git, opts: opts, worktrees: map[string]*Worktree{}}
+}
+
+func (m *WorktreeManager) Enabled() bool {
+	return m.opts.Root != ""
+}
+
+func (m *WorktreeManager) Create(ctx context.Context, sessionID, repo string, opts CreateWorktreeOptions) (*Worktree, error) {
+	if !m.Enabled() {
+		return nil, ErrWorktreesDisabled
+	}
+	name := opts.Name
+	if name == "" {
+		suffix := make([]byte, 4)
+		_, _ = rand.Read(suffix)
+		name = filepath.Base(repo) + "-" + hex.EncodeToString(suffix)
+	}
+	if !worktreeName.MatchString(name) {
+		return nil, fmt.Errorf("invalid worktree name %q", name)
+	}
+	branch := opts.Branch
+	if branch == "" {
+		branch = m.opts.BranchPrefix + name
+	}
+	if strings.HasPrefix(branch, "-") {
+		return nil, fmt.Errorf("invalid branch name %q", branch)
+	}
+	base := opts.Base
+	if base == "" {
+		base = "HEAD"
+	}
+	if err := ValidRev(base); err != nil {
+		return nil, err
+	}
+	root, err := filepath.Abs(m.opts.Root)
+	if err != nil {
+		return nil, err
+	}
+	wt := &Worktree{
+		Name:      name,
+		Path:      filepath.Join(root, name),
+		Branch:    branch,
+		Repo:      repo,
+		SessionID: sessionID,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := m.reserve(wt); err != nil {
+		return nil, err
+	}
+	if err := m.add(ctx, wt, base); err != nil {
+		m.mu.Lock()
+		delete(m.worktrees, wt.Path)
+		m.mu.Unlock()
+		return nil, err
+	}
+	cp := *wt
+	return &cp, nil
+}
+
+func (m *WorktreeManager) reserve(wt *Worktree) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	count := 0
+	for _, other := range m.worktrees {
+		if other.SessionID == wt.SessionID {
+			count++
+		}
+	}
+	if m.opts.MaxPerSession > 0 && count >= m.opts.MaxPerSession {
+		return ErrWorktreeLimit
+	}
+	if _, ok := m.worktrees[wt.Path]; ok {
+		return fmt.Errorf("worktree %s already exists", wt.Name)
+	}
+	if _, err := os.Lstat(wt.Path); err == nil {
+		return fmt.Errorf("%s already exists", wt.Path)
+	}
+	m.worktrees[wt.Path] = wt
+	return nil
+}
+
+func (m *WorktreeManager) add(ctx context.Context, wt *Worktree, base string) error {
+	if _, _, err := m.git.run(ctx, wt.Repo, 0, "check-ref-format", "--branch", wt.Branch); err != nil {
+		return fmt.Errorf("invalid branch name %q", wt.Branch)
+	}
+	out, _, err := m.git.run(ctx, wt.Repo, 0, "rev-parse", "--verify", "--quiet", base+"^{commit}")
+	if err != nil {
+		return fmt.Errorf("unknown base revision %q", base)
+	}
+	oid := strings.TrimSpace(string(out))
+	if err := os.MkdirAll(filepath.Dir(wt.Path), 0700); err != nil {
+		return err
+	}
+	if _, _, err := m.git.run(ctx, wt.Repo, 0, "worktree", "add", "--quiet", "-b", wt.Branch, wt.Path, oid); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	wt.Base = oid
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *WorktreeManager) Find(sessionID, nameOrPath string) (*Worktree, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, wt := range m.worktrees {
+		if wt.SessionID == sessionID && wt.Base != "" && (wt.Name == nameOrPath || wt.Path == filepath.Clean(nameOrPath)) {
+			cp := *wt
+			return &cp, nil
+		}
+	}
+	return nil, ErrWorktreeNotFound
+}
+
+func (m *WorktreeManager) Remove(ctx context.Context, wt *Worktree, force, deleteBranch bool) (*RemoveWorktreeResult, error) {
+	args := []string{"worktree", "remove"}
+	if force {
+		args = append(args, "--force")
+	}
+	if _, _, err := m.git.run(ctx, wt.Repo, 0, append(args, wt.Path)...); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	delete(m.worktrees, wt.Path)
+	m.mu.Unlock()
+	result := &RemoveWorktreeResult{Worktree: *wt}
+	if deleteBranch {
+		flag := "-d"
+		if force {
+			flag = "-D"
+		}
+		_, _, err := m.git.run(ctx, wt.Repo, 0, "branch", flag, wt.Branch)
+		result.BranchDeleted = err == nil
+	}
+	return result, nil
+}
+
+func (m *WorktreeManager) List(sessionID string) []Worktree {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := []Worktree{}
+	for _, wt := range m.worktrees {
+		if wt.SessionID == sessionID && wt.Base != "" {
+			out = append(out, *wt)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out
+}
+
+func (m *WorktreeManager) CloseSession(ctx context.Context, sessionID string) []string {
+	closing := m.List(sessionID)
+	paths := make([]string, 0, len(closing))
+	for i := range closing {
+		wt := &closing[i]
+		_, _, _ = m.git.run(ctx, wt.Repo, 0, "worktree", "remove", wt.Path)
+		m.mu.Lock()
+		delete(m.worktrees, wt.Path)
+		m.mu.Unlock()
+		paths = append(paths, wt.Path)
+	}
+	return paths
+}
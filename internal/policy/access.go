@@ -0,0 +1,256 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	ErrDeniedPath   = errors.New("path is denied by policy")
+	ErrReadOnlyPath = errors.New("path is in a read-only root")
+)
+
+type Root struct {
+	Path     string
+	ReadOnly bool
+	Deny     []string
+}
+
+type rootRules struct {
+	readOnly bool
+	deny     []string
+	owner    string
+	// base is where a session root sits inside the root its rules were
+	// copied from, so per-root deny patterns keep matching the same files.
+	base string
+}
+
+type AccessError struct {
+	Path   string
+	Reason string
+	Rule   string
+	err    error
+}
+
+func (e *AccessError) Error() string {
+	if e.Reason == "deny" {
+		return fmt.Sprintf("%s: %s matches deny rule %q", e.err, e.Path, e.Rule)
+	}
+	return fmt.Sprintf("%s: %s is under %s", e.err, e.Path, e.Rule)
+}
+
+func (e *AccessError) Unwrap() error { return e.err }
+
+func (e *AccessError) ErrorData() any {
+	return map[string]any{"path": e.Path, "reason": e.Reason, "rule": e.Rule}
+}
+
+func validDenyPattern(pattern string) error {
+	if pattern == "" {
+		return errors.New("deny pattern must not be empty")
+	}
+	for _, seg := range strings.Split(strings.Trim(pattern, "/"), "/") {
+		if _, err := path.Match(seg, ""); err != nil {
+			return fmt.Errorf("invalid deny pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+func within(p, root string) bool {
+	return p == root || strings.HasPrefix(p, root+string(filepath.Separator)) || root == string(filepath.Separator)
+}
+
+func longestRoot(roots []string, p string) int {
+	best := -1
+	for i, root := range roots {
+		if within(p, root) && (best == -1 || len(root) > len(roots[best])) {
+			best = i
+		}
+	}
+	return best
+}
+
+func matchDeny(pattern, rel string) bool {
+	segs := strings.Split(rel, "/")
+	pattern = strings.Trim(pattern, "/")
+	if !strings.Contains(pattern, "/") {
+		for _, seg := range segs {
+			if ok, _ := path.Match(pattern, seg); ok {
+				return true
+			}
+		}
+		return false
+	}
+	parts := strings.Split(pattern, "/")
+	for i := 1; i <= len(segs); i++ {
+		if matchDenySegments(parts, segs[:i]) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchDenySegments(parts, segs []string) bool {
+	for len(parts) > 0 {
+		if parts[0] == "**" {
+			for i := 0; i <= len(segs); i++ {
+				if matchDenySegments(parts[1:], segs[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segs) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(parts[0], segs[0]); !ok {
+			return false
+		}
+		parts, segs = parts[1:], segs[1:]
+	}
+	return len(segs) == 0
+}
+
+func (e *Engine) hasDeny() bool {
+	if len(e.deny) > 0 {
+		return true
+	}
+	for _, r := range e.roots.Load().rules {
+		if len(r.deny) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Engine) deniedBy(p string, real bool) (string, bool) {
+	rs := e.roots.Load()
+	roots := rs.allowed
+	if real {
+		roots = rs.real
+	}
+	for i, root := range roots {
+		if !within(p, root) {
+			continue
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil || rel == "." {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		for _, pattern := range e.deny {
+			if matchDeny(pattern, rel) {
+				return pattern, true
+			}
+		}
+		ruleRel := rel
+		if base := rs.rules[i].base; base != "" {
+			ruleRel = base + "/" + rel
+		}
+		for _, pattern := range rs.rules[i].deny {
+			if matchDeny(pattern, ruleRel) {
+				return pattern, true
+			}
+		}
+	}
+	return "", false
+}
+
+func joinBase(base, rel string) string {
+	if rel == "." {
+		return base
+	}
+	return path.Join(base, filepath.ToSlash(rel))
+}
+
+func (e *Engine) checkDenied(logical, real string) error {
+	if pattern, ok := e.deniedBy(logical, false); ok {
+		return &AccessError{Path: logical, Reason: "deny", Rule: pattern, err: ErrDeniedPath}
+	}
+	if real == "" {
+		return nil
+	}
+	if pattern, ok := e.deniedBy(real, true); ok {
+		return &AccessError{Path: logical, Reason: "deny", Rule: pattern, err: ErrDeniedPath}
+	}
+	return nil
+}
+
+func (e *Engine) IsDenied(p string) bool {
+	_, ok := e.deniedBy(filepath.Clean(p), false)
+	return ok
+}
+
+func (e *Engine) CheckWritable(p string) error {
+	p = filepath.Clean(p)
+	rs := e.roots.Load()
+	i := longestRoot(rs.allowed, p)
+	if i == -1 {
+		return ErrForbiddenPath
+	}
+	if rs.rules[i].readOnly {
+		return &AccessError{Path: p, Reason: "read_only", Rule: rs.allowed[i], err: ErrReadOnlyPath}
+	}
+	real, err := e.resolveReal(p)
+	if err != nil {
+		return err
+	}
+	if j := longestRoot(rs.real, real); j != -1 && rs.rules[j].readOnly {
+		return &AccessError{Path: p, Reason: "read_only", Rule: rs.allowed[j], err: ErrReadOnlyPath}
+	}
+	return nil
+}
+
+func (e *Engine) CheckSubtree(p string) error {
+	p = filepath.Clean(p)
+	rs := e.roots.Load()
+	for i, root := range rs.allowed {
+		if root != p && within(root, p) && rs.rules[i].readOnly {
+			return &AccessError{Path: root, Reason: "read_only", Rule: root, err: ErrReadOnlyPath}
+		}
+	}
+	if !e.hasDeny() {
+		return nil
+	}
+	err := filepath.WalkDir(p, func(child string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if child == p {
+			return nil
+		}
+		if pattern, ok := e.deniedBy(child, false); ok {
+			return &AccessError{Path: child, Reason: "deny", Rule: pattern, err: ErrDeniedPath}
+		}
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (e *Engine) ResolveWritePath(cwd, p string) (string, error) {
+	return e.ResolveSessionWritePath("", cwd, p)
+}
+
+func (e *Engine) ResolveSessionWritePath(sessionID, cwd, p string) (string, error) {
+	abs, err := e.ResolveSessionPath(sessionID, cwd, p)
+	if err != nil {
+		return "", err
+	}
+	if err := e.CheckWritable(abs); err != nil {
+		return "", err
+	}
+	return abs, nil
+}
+
+func writeFlag(flag int) bool {
+	return flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0
+}
@@ -0,0 +1,44 @@
+package policy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+var errOpenat2Unsupported = errors.New("openat2 unsupported")
+
+func (e *Engine) OpenFile(path string, flag int, perm os.FileMode) (*os.File, error) {
+	path = filepath.Clean(path)
+	root, ok := e.RootFor(path)
+	if !ok {
+		return nil, ErrForbiddenPath
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return nil, err
+	}
+	if e.hasDeny() {
+		real, err := e.resolveReal(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := e.checkDenied(path, real); err != nil {
+			return nil, err
+		}
+	}
+	if writeFlag(flag) {
+		if err := e.CheckWritable(path); err != nil {
+			return nil, err
+		}
+	}
+	f, err := openBeneath(root, rel, path, flag, perm, e.allowSymlinks)
+	if !errors.Is(err, errOpenat2Unsupported) {
+		return f, err
+	}
+	real, err := e.resolveReal(path)
+	if err != nil {
+		return nil, err
+	}
+	return e.openResolved(real, path, flag, perm)
+}
@@ -0,0 +1,87 @@
+//go:build linux
+
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	sysOpenat2          = 437
+	resolveNoMagiclinks = 0x02
+	resolveNoSymlinks   = 0x04
+	resolveBeneath      = 0x08
+)
+
+type openHow struct {
+	flags   uint64
+	mode    uint64
+	resolve uint64
+}
+
+func openBeneath(root, rel, name string, flag int, perm os.FileMode, allowSymlinks bool) (*os.File, error) {
+	dirfd, err := syscall.Open(root, syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: root, Err: err}
+	}
+	defer syscall.Close(dirfd)
+	how := openHow{
+		flags:   uint64(flag | syscall.O_CLOEXEC),
+		resolve: resolveBeneath | resolveNoMagiclinks,
+	}
+	if flag&syscall.O_CREAT != 0 {
+		how.mode = uint64(perm.Perm())
+	}
+	if !allowSymlinks {
+		how.resolve |= resolveNoSymlinks
+	}
+	relPtr, err := syscall.BytePtrFromString(rel)
+	if err != nil {
+		return nil, err
+	}
+	fd, _, errno := syscall.Syscall6(sysOpenat2, uintptr(dirfd), uintptr(unsafe.Pointer(relPtr)), uintptr(unsafe.Pointer(&how)), unsafe.Sizeof(how), 0, 0)
+	switch {
+	case errno == 0:
+		return os.NewFile(fd, name), nil
+	case errno == syscall.ENOSYS, errno == syscall.EPERM:
+		return nil, errOpenat2Unsupported
+	case errno == syscall.EXDEV && allowSymlinks:
+		return nil, errOpenat2Unsupported
+	case errno == syscall.EXDEV, errno == syscall.ELOOP && !allowSymlinks:
+		return nil, fmt.Errorf("%w: %s", ErrForbiddenPath, name)
+	default:
+		return nil, &os.PathError{Op: "open", Path: name, Err: errno}
+	}
+}
+
+func (e *Engine) openResolved(real, name string, flag int, perm os.FileMode) (*os.File, error) {
+	dir, err := os.Open(filepath.Dir(real))
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+	dirPath, err := os.Readlink("/proc/self/fd/" + strconv.Itoa(int(dir.Fd())))
+	if err != nil {
+		dirPath, err = filepath.EvalSymlinks(filepath.Dir(real))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !e.isRealAllowed(dirPath) {
+		return nil, ErrForbiddenPath
+	}
+	fd, err := syscall.Openat(int(dir.Fd()), filepath.Base(real), flag|syscall.O_NOFOLLOW|syscall.O_CLOEXEC, uint32(perm.Perm()))
+	if err != nil {
+		if errors.Is(err, syscall.ELOOP) {
+			return nil, fmt.Errorf("%w: %s", ErrForbiddenPath, name)
+		}
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	return os.NewFile(uintptr(fd), name), nil
+}
@@ -0,0 +1,24 @@
+//go:build !linux
+
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+func openBeneath(root, rel, name string, flag int, perm os.FileMode, allowSymlinks bool) (*os.File, error) {
+	return nil, errOpenat2Unsupported
+}
+
+func (e *Engine) openResolved(real, name string, flag int, perm os.FileMode) (*os.File, error) {
+	dir, err := filepath.EvalSymlinks(filepath.Dir(real))
+	if err != nil {
+		return nil, err
+	}
+	if !e.isRealAllowed(dir) {
+		return nil, ErrForbiddenPath
+	}
+	return os.OpenFile(filepath.Join(dir, filepath.Base(real)), flag|syscall.O_NOFOLLOW, perm)
+}
@@ -2,40 +2,150 @@ package policy
 
 import (
 	"errors"
+	"fmt"
+	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
-var ErrForbiddenPath = errors.New("path is outside allowed roots")
+const maxSymlinkHops = 40
+
+var (
+	ErrForbiddenPath        = errors.New("path is outside allowed roots")
+	ErrForbiddenInterpreter = errors.New("interpreter is not allowed")
+)
+
+type Options struct {
+	AllowedRoots  []string
+	Roots         []Root
+	Deny          []string
+	AllowShell    bool
+	AllowSymlinks bool
+	Shell         string
+	AllowedShells []string
+	Interpreters  []string
+}
+
+type rootSet struct {
+	allowed []string
+	real    []string
+	rules   []rootRules
+}
 
 type Engine struct {
-	allowedRoots []string
-	allowShell   bool
+	mu            sync.Mutex
+	roots         atomic.Pointer[rootSet]
+	deny          []string
+	allowShell    bool
+	allowSymlinks bool
+	shell         string
+	allowedShells []string
+	interpreters  []string
 }
 
-func New(allowedRoots []string, allowShell bool) (*Engine, error) {
-	norm := make([]string, 0, len(allowedRoots))
-	for _, root := range allowedRoots {
-		abs, err := filepath.Abs(root)
+func New(opts Options) (*Engine, error) {
+	roots := make([]Root, 0, len(opts.AllowedRoots)+len(opts.Roots))
+	for _, root := range opts.AllowedRoots {
+		roots = append(roots, Root{Path: root})
+	}
+	roots = append(roots, opts.Roots...)
+	norm := make([]string, 0, len(roots))
+	real := make([]string, 0, len(roots))
+	rules := make([]rootRules, 0, len(roots))
+	for _, root := range roots {
+		abs, err := filepath.Abs(root.Path)
 		if err != nil {
 			return nil, err
 		}
 		norm = append(norm, filepath.Clean(abs))
+		resolved, err := filepath.EvalSymlinks(abs)
+		if err != nil {
+			resolved = filepath.Clean(abs)
+		}
+		real = append(real, resolved)
+		for _, pattern := range root.Deny {
+			if err := validDenyPattern(pattern); err != nil {
+				return nil, err
+			}
+		}
+		rules = append(rules, rootRules{readOnly: root.ReadOnly, deny: root.Deny})
+	}
+	for _, pattern := range opts.Deny {
+		if err := validDenyPattern(pattern); err != nil {
+			return nil, err
+		}
+	}
+	shell := opts.Shell
+	if shell == "" {
+		shell = "sh"
 	}
-	return &Engine{allowedRoots: norm, allowShell: allowShell}, nil
+	e := &Engine{
+		deny:          opts.Deny,
+		allowShell:    opts.AllowShell,
+		allowSymlinks: opts.AllowSymlinks,
+		shell:         shell,
+		allowedShells: opts.AllowedShells,
+		interpreters:  opts.Interpreters,
+	}
+	e.roots.Store(&rootSet{allowed: norm, real: real, rules: rules})
+	return e, nil
 }
 
 func (e *Engine) AllowedRoots() []string {
-	cp := make([]string, len(e.allowedRoots))
-	copy(cp, e.allowedRoots)
-	return cp
+	return e.RootsFor("")
+}
+
+func (e *Engine) RootsFor(sessionID string) []string {
+	rs := e.roots.Load()
+	out := []string{}
+	for i, root := range rs.allowed {
+		if visible(rs.rules[i].owner, sessionID) {
+			out = append(out, root)
+		}
+	}
+	return out
 }
 
 func (e *Engine) AllowShell() bool {
 	return e.allowShell
 }
 
+func (e *Engine) ResolveShell(requested string) (string, error) {
+	if requested == "" || requested == e.shell {
+		return e.shell, nil
+	}
+	if !containsInterpreter(e.allowedShells, requested) {
+		return "", ErrForbiddenInterpreter
+	}
+	return requested, nil
+}
+
+func (e *Engine) ResolveInterpreter(name string) (string, error) {
+	if name == "" {
+		return "", errors.New("interpreter is required")
+	}
+	if !containsInterpreter(e.interpreters, name) {
+		return "", ErrForbiddenInterpreter
+	}
+	return name, nil
+}
+
+func containsInterpreter(allowed []string, name string) bool {
+	for _, a := range allowed {
+		if a == name {
+			return true
+		}
+	}
+	return false
+}
+
 func (e *Engine) ResolvePath(cwd, p string) (string, error) {
+	return e.ResolveSessionPath("", cwd, p)
+}
+
+func (e *Engine) ResolveSessionPath(sessionID, cwd, p string) (string, error) {
 	candidate := p
 	if !filepath.IsAbs(candidate) {
 		candidate = filepath.Join(cwd, candidate)
@@ -45,22 +155,171 @@ func (e *Engine) ResolvePath(cwd, p string) (string, error) {
 		return "", err
 	}
 	cleaned := filepath.Clean(abs)
-	if !e.IsAllowed(cleaned) {
+	if !e.allowedFor(sessionID, cleaned) {
 		return "", ErrForbiddenPath
 	}
+	real, err := e.resolveReal(cleaned)
+	if err != nil {
+		return "", err
+	}
+	rs := e.roots.Load()
+	if j := longestRoot(rs.real, real); j == -1 || !visible(rs.rules[j].owner, sessionID) {
+		return "", ErrForbiddenPath
+	}
+	if err := e.checkDenied(cleaned, real); err != nil {
+		return "", err
+	}
 	return cleaned, nil
 }
 
+func (e *Engine) RootFor(path string) (string, bool) {
+	rs := e.roots.Load()
+	best := longestRoot(rs.allowed, path)
+	if best == -1 {
+		return "", false
+	}
+	return rs.allowed[best], true
+}
+
+func (e *Engine) resolveReal(path string) (string, error) {
+	rs := e.roots.Load()
+	i := longestRoot(rs.allowed, path)
+	if i == -1 {
+		return "", ErrForbiddenPath
+	}
+	rel, err := filepath.Rel(rs.allowed[i], path)
+	if err != nil {
+		return "", err
+	}
+	cur := rs.real[i]
+	pending := strings.Split(rel, string(filepath.Separator))
+	hops := 0
+	for len(pending) > 0 {
+		name := pending[0]
+		pending = pending[1:]
+		switch name {
+		case "", ".":
+			continue
+		case "..":
+			cur = filepath.Dir(cur)
+			continue
+		}
+		next := filepath.Join(cur, name)
+		st, err := os.Lstat(next)
+		if errors.Is(err, os.ErrNotExist) {
+			cur = filepath.Join(append([]string{next}, pending...)...)
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if st.Mode()&os.ModeSymlink == 0 {
+			cur = next
+			continue
+		}
+		if !e.allowSymlinks {
+			return "", fmt.Errorf("%w: symlink %s", ErrForbiddenPath, next)
+		}
+		hops++
+		if hops > maxSymlinkHops {
+			return "", fmt.Errorf("too many levels of symbolic links: %s", path)
+		}
+		target, err := os.Readlink(next)
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(target) {
+			cur = string(filepath.Separator)
+		}
+		pending = append(strings.Split(target, string(filepath.Separator)), pending...)
+	}
+	if !e.isRealAllowed(cur) {
+		return "", ErrForbiddenPath
+	}
+	return cur, nil
+}
+
+func (e *Engine) isRealAllowed(path string) bool {
+	return longestRoot(e.roots.Load().real, path) != -1
+}
+
 func (e *Engine) IsAllowed(path string) bool {
-	if len(e.allowedRoots) == 0 {
-		return false
+	return e.allowedFor("", path)
+}
+
+func (e *Engine) allowedFor(sessionID, path string) bool {
+	rs := e.roots.Load()
+	i := longestRoot(rs.allowed, filepath.Clean(path))
+	return i != -1 && visible(rs.rules[i].owner, sessionID)
+}
+
+func visible(owner, sessionID string) bool {
+	return owner == "" || owner == sessionID
+}
+
+// AddSessionRoot makes path an allowed root visible only to sessionID. It
+// inherits the read-only flag and deny patterns of the root containing
+// source, the directory path mirrors (a worktree's repository).
+func (e *Engine) AddSessionRoot(sessionID, path, source string) error {
+	if sessionID == "" {
+		return errors.New("session id is required")
 	}
-	cleaned := filepath.Clean(path)
-	for _, root := range e.allowedRoots {
-		if cleaned == root {
-			return true
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	abs = filepath.Clean(abs)
+	real, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	rs := e.roots.Load()
+	if i := longestRoot(rs.allowed, abs); i != -1 && rs.allowed[i] == abs {
+		return fmt.Errorf("%s is already an allowed root", abs)
+	}
+	source = filepath.Clean(source)
+	i := longestRoot(rs.allowed, source)
+	if i == -1 {
+		return ErrForbiddenPath
+	}
+	rules := rs.rules[i]
+	rules.owner = sessionID
+	rel, err := filepath.Rel(rs.allowed[i], source)
+	if err != nil {
+		return err
+	}
+	rules.base = joinBase(rules.base, rel)
+	next := &rootSet{
+		allowed: append(append([]string{}, rs.allowed...), abs),
+		real:    append(append([]string{}, rs.real...), real),
+		rules:   append(append([]rootRules{}, rs.rules...), rules),
+	}
+	e.roots.Store(next)
+	return nil
+}
+
+func (e *Engine) RemoveSessionRoots(sessionID string, paths ...string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	rs := e.roots.Load()
+	next := &rootSet{}
+	for i, root := range rs.allowed {
+		owned := rs.rules[i].owner != "" && rs.rules[i].owner == sessionID
+		if owned && (len(paths) == 0 || containsPath(paths, root)) {
+			continue
 		}
-		if strings.HasPrefix(cleaned, root+string(filepath.Separator)) {
+		next.allowed = append(next.allowed, root)
+		next.real = append(next.real, rs.real[i])
+		next.rules = append(next.rules, rs.rules[i])
+	}
+	e.roots.Store(next)
+}
+
+func containsPath(paths []string, root string) bool {
+	for _, p := range paths {
+		if filepath.Clean(p) == root {
 			return true
 		}
 	}
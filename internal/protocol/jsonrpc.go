@@ -53,4 +53,5 @@ const (
 	ErrConcurrencyConflict  = -32006
 	ErrUnsupportedCapability = -32007
 	ErrResourceLimit        = -32008
+	ErrAccessDenied         = -32009
 )
@@ -36,6 +36,19 @@ type ExecStartParams struct {
 	Login          bool              `json:"login,omitempty"`
 	Command        string            `json:"command,omitempty"`
 	Detach         bool              `json:"detach,omitempty"`
+	MergeStreams   bool              `json:"merge_streams,omitempty"`
+}
+
+type ExecScriptParams struct {
+	SessionID      string            `json:"session_id"`
+	Interpreter    string            `json:"interpreter"`
+	Script         string            `json:"script"`
+	Args           []string          `json:"args,omitempty"`
+	Cwd            string            `json:"cwd,omitempty"`
+	Env            map[string]string `json:"env,omitempty"`
+	Stdin          string            `json:"stdin,omitempty"`
+	TimeoutMS      int               `json:"timeout_ms,omitempty"`
+	MaxOutputBytes int               `json:"max_output_bytes,omitempty"`
 }
 
 type ExecStartResult struct {
@@ -75,24 +88,146 @@ type ExecInputResult struct {
 }
 
 type FSReadParams struct {
-	SessionID string `json:"session_id"`
-	Path      string `json:"path"`
-	Offset    int64  `json:"offset,omitempty"`
-	Length    int64  `json:"length,omitempty"`
-	Encoding  string `json:"encoding,omitempty"`
+	SessionID     string `json:"session_id"`
+	Path          string `json:"path"`
+	Offset        int64  `json:"offset,omitempty"`
+	Length        int64  `json:"length,omitempty"`
+	Encoding      string `json:"encoding,omitempty"`
+	Hash          bool   `json:"hash,omitempty"`
+	StartLine     int    `json:"start_line,omitempty"`
+	MaxLines      int    `json:"max_lines,omitempty"`
+	LineNumbers   bool   `json:"line_numbers,omitempty"`
+	MaxLineLength int    `json:"max_line_length,omitempty"`
+	OnBinary      string `json:"on_binary,omitempty"`
 }
 
 type FSWriteParams struct {
+	SessionID      string `json:"session_id"`
+	Path           string `json:"path"`
+	Content        string `json:"content"`
+	Encoding       string `json:"encoding,omitempty"`
+	Mode           string `json:"mode,omitempty"`
+	MkdirParents   bool   `json:"mkdir_parents,omitempty"`
+	Atomic         bool   `json:"atomic,omitempty"`
+	ExpectedMTime  int64  `json:"expected_mtime,omitempty"`
+	ExpectedSHA256 string `json:"expected_sha256,omitempty"`
+	Hash           bool   `json:"hash,omitempty"`
+	Perm           string `json:"perm,omitempty"`
+	TextEncoding   string `json:"text_encoding,omitempty"`
+	LineEnding     string `json:"line_ending,omitempty"`
+}
+
+type FSChmodParams struct {
 	SessionID     string `json:"session_id"`
 	Path          string `json:"path"`
-	Content       string `json:"content"`
-	Encoding      string `json:"encoding,omitempty"`
-	Mode          string `json:"mode,omitempty"`
+	Perm          string `json:"perm"`
+	ExpectedMTime int64  `json:"expected_mtime,omitempty"`
+}
+
+type FSMoveParams struct {
+	SessionID         string `json:"session_id"`
+	From              string `json:"from"`
+	To                string `json:"to"`
+	Overwrite         bool   `json:"overwrite,omitempty"`
+	MkdirParents      bool   `json:"mkdir_parents,omitempty"`
+	ExpectedMTime     int64  `json:"expected_mtime,omitempty"`
+	ExpectedDestMTime int64  `json:"expected_dest_mtime,omitempty"`
+}
+
+type FSCopyParams struct {
+	SessionID         string `json:"session_id"`
+	From              string `json:"from"`
+	To                string `json:"to"`
+	Recursive         bool   `json:"recursive,omitempty"`
+	Overwrite         bool   `json:"overwrite,omitempty"`
+	MkdirParents      bool   `json:"mkdir_parents,omitempty"`
+	ExpectedMTime     int64  `json:"expected_mtime,omitempty"`
+	ExpectedDestMTime int64  `json:"expected_dest_mtime,omitempty"`
+}
+
+type FSRemoveParams struct {
+	SessionID     string `json:"session_id"`
+	Path          string `json:"path"`
+	Recursive     bool   `json:"recursive,omitempty"`
+	MaxEntries    int    `json:"max_entries,omitempty"`
+	ExpectedMTime int64  `json:"expected_mtime,omitempty"`
+}
+
+type FSMkdirParams struct {
+	SessionID     string `json:"session_id"`
+	Path          string `json:"path"`
+	Parents       bool   `json:"parents,omitempty"`
+	ExpectedMTime int64  `json:"expected_mtime,omitempty"`
+}
+
+type FSUploadBeginParams struct {
+	SessionID     string `json:"session_id"`
+	Path          string `json:"path"`
+	Size          int64  `json:"size,omitempty"`
+	Overwrite     bool   `json:"overwrite,omitempty"`
 	MkdirParents  bool   `json:"mkdir_parents,omitempty"`
-	Atomic        bool   `json:"atomic,omitempty"`
 	ExpectedMTime int64  `json:"expected_mtime,omitempty"`
 }
 
+type FSUploadChunkParams struct {
+	SessionID string `json:"session_id"`
+	UploadID  string `json:"upload_id"`
+	Offset    int64  `json:"offset"`
+	Data      string `json:"data"`
+}
+
+type FSUploadCommitParams struct {
+	SessionID string `json:"session_id"`
+	UploadID  string `json:"upload_id"`
+	SHA256    string `json:"sha256,omitempty"`
+}
+
+type FSUploadRefParams struct {
+	SessionID string `json:"session_id"`
+	UploadID  string `json:"upload_id"`
+}
+
+type FSDownloadParams struct {
+	SessionID string `json:"session_id"`
+	Path      string `json:"path"`
+	Offset    int64  `json:"offset,omitempty"`
+	Length    int64  `json:"length,omitempty"`
+	ChunkSize int    `json:"chunk_size,omitempty"`
+	Window    int    `json:"window,omitempty"`
+}
+
+type FSArchiveParams struct {
+	SessionID string   `json:"session_id"`
+	Path      string   `json:"path"`
+	Format    string   `json:"format,omitempty"`
+	Include   []string `json:"include,omitempty"`
+	Exclude   []string `json:"exclude,omitempty"`
+	ChunkSize int      `json:"chunk_size,omitempty"`
+	Window    int      `json:"window,omitempty"`
+}
+
+type FSExtractParams struct {
+	SessionID       string `json:"session_id"`
+	Path            string `json:"path"`
+	Dest            string `json:"dest"`
+	Format          string `json:"format,omitempty"`
+	Overwrite       bool   `json:"overwrite,omitempty"`
+	StripComponents int    `json:"strip_components,omitempty"`
+	MaxBytes        int64  `json:"max_bytes,omitempty"`
+	MaxEntries      int    `json:"max_entries,omitempty"`
+}
+
+type FSDownloadAckParams struct {
+	SessionID  string `json:"session_id"`
+	DownloadID string `json:"download_id"`
+	Seq        int64  `json:"seq"`
+}
+
+type FSDownloadCancelParams struct {
+	SessionID  string `json:"session_id"`
+	DownloadID string `json:"download_id"`
+}
+
 type FSListParams struct {
 	SessionID  string `json:"session_id"`
 	Path       string `json:"path"`
@@ -101,24 +236,87 @@ type FSListParams struct {
 }
 
 type FSGlobParams struct {
-	SessionID  string `json:"session_id"`
-	Pattern    string `json:"pattern"`
-	Cwd        string `json:"cwd,omitempty"`
-	MaxMatches int    `json:"max_matches,omitempty"`
+	SessionID  string   `json:"session_id"`
+	Pattern    string   `json:"pattern,omitempty"`
+	Patterns   []string `json:"patterns,omitempty"`
+	Exclude    []string `json:"exclude,omitempty"`
+	Ignore     bool     `json:"ignore,omitempty"`
+	Sort       string   `json:"sort,omitempty"`
+	Cwd        string   `json:"cwd,omitempty"`
+	MaxMatches int      `json:"max_matches,omitempty"`
+}
+
+type FSSearchParams struct {
+	SessionID    string   `json:"session_id"`
+	Path         string   `json:"path,omitempty"`
+	Pattern      string   `json:"pattern"`
+	Literal      bool     `json:"literal,omitempty"`
+	IgnoreCase   bool     `json:"ignore_case,omitempty"`
+	SmartCase    bool     `json:"smart_case,omitempty"`
+	Include      []string `json:"include,omitempty"`
+	Exclude      []string `json:"exclude,omitempty"`
+	NoIgnore     bool     `json:"no_ignore,omitempty"`
+	Hidden       bool     `json:"hidden,omitempty"`
+	Context      int      `json:"context,omitempty"`
+	Before       int      `json:"before,omitempty"`
+	After        int      `json:"after,omitempty"`
+	MaxMatches   int      `json:"max_matches,omitempty"`
+	MaxBytes     int      `json:"max_bytes,omitempty"`
+	MaxFileBytes int64    `json:"max_file_bytes,omitempty"`
+}
+
+type FSWatchParams struct {
+	SessionID  string   `json:"session_id"`
+	Path       string   `json:"path,omitempty"`
+	Recursive  *bool    `json:"recursive,omitempty"`
+	Include    []string `json:"include,omitempty"`
+	Exclude    []string `json:"exclude,omitempty"`
+	DebounceMS int      `json:"debounce_ms,omitempty"`
+}
+
+type FSUnwatchParams struct {
+	SessionID string `json:"session_id"`
+	WatchID   string `json:"watch_id"`
 }
 
 type FSStatParams struct {
 	SessionID string `json:"session_id"`
 	Path      string `json:"path"`
+	Hash      bool   `json:"hash,omitempty"`
+}
+
+type FSHashParams struct {
+	SessionID  string   `json:"session_id"`
+	Path       string   `json:"path"`
+	Algorithms []string `json:"algorithms,omitempty"`
+	Offset     int64    `json:"offset,omitempty"`
+	Length     int64    `json:"length,omitempty"`
 }
 
 type FSEditParams struct {
-	SessionID     string `json:"session_id"`
-	Path          string `json:"path"`
-	OldString     string `json:"old_string"`
-	NewString     string `json:"new_string"`
-	ReplaceAll    bool   `json:"replace_all,omitempty"`
-	ExpectedMTime int64  `json:"expected_mtime,omitempty"`
+	SessionID      string `json:"session_id"`
+	Path           string `json:"path"`
+	OldString      string `json:"old_string"`
+	NewString      string `json:"new_string"`
+	ReplaceAll     bool   `json:"replace_all,omitempty"`
+	ExpectedMTime  int64  `json:"expected_mtime,omitempty"`
+	ExpectedSHA256 string `json:"expected_sha256,omitempty"`
+}
+
+type FSMultiEditOp struct {
+	OldString  string `json:"old_string"`
+	NewString  string `json:"new_string"`
+	ReplaceAll bool   `json:"replace_all,omitempty"`
+	Match      string `json:"match,omitempty"`
+}
+
+type FSMultiEditParams struct {
+	SessionID      string          `json:"session_id"`
+	Path           string          `json:"path"`
+	Edits          []FSMultiEditOp `json:"edits"`
+	Match          string          `json:"match,omitempty"`
+	ExpectedMTime  int64           `json:"expected_mtime,omitempty"`
+	ExpectedSHA256 string          `json:"expected_sha256,omitempty"`
 }
 
 type FSEditResult struct {
@@ -127,12 +325,34 @@ type FSEditResult struct {
 	MTime        int64  `json:"mtime"`
 	Created      bool   `json:"created"`
 	Replacements int    `json:"replacements"`
+	TextEncoding string `json:"text_encoding,omitempty"`
+	LineEnding   string `json:"line_ending,omitempty"`
 }
 
-type FSPatchParams struct {
+type FSCheckpointParams struct {
 	SessionID string `json:"session_id"`
-	PatchText string `json:"patch_text"`
-	Cwd       string `json:"cwd,omitempty"`
+	Name      string `json:"name,omitempty"`
+}
+
+type FSHistoryParams struct {
+	SessionID string `json:"session_id"`
+	Limit     int    `json:"limit,omitempty"`
+}
+
+type FSUndoParams struct {
+	SessionID  string `json:"session_id"`
+	Checkpoint string `json:"checkpoint,omitempty"`
+	Steps      int    `json:"steps,omitempty"`
+	Force      bool   `json:"force,omitempty"`
+}
+
+type FSPatchParams struct {
+	SessionID      string            `json:"session_id"`
+	PatchText      string            `json:"patch_text"`
+	Cwd            string            `json:"cwd,omitempty"`
+	ExpectedSHA256 map[string]string `json:"expected_sha256,omitempty"`
+	DryRun         bool              `json:"dry_run,omitempty"`
+	Format         string            `json:"format,omitempty"`
 }
 
 type FSPatchMove struct {
@@ -145,6 +365,114 @@ type FSPatchResult struct {
 	Updated []string      `json:"updated"`
 	Deleted []string      `json:"deleted"`
 	Moved   []FSPatchMove `json:"moved,omitempty"`
+	Format  string        `json:"format"`
+	DryRun  bool          `json:"dry_run,omitempty"`
+	Files   []FSPatchFile `json:"files,omitempty"`
+}
+
+type FSPatchFile struct {
+	Path   string       `json:"path"`
+	Status string       `json:"status"`
+	Diff   string       `json:"diff"`
+	Hunks  []FSDiffHunk `json:"hunks"`
+}
+
+type FSDiffHunk struct {
+	OldStart int      `json:"old_start"`
+	OldLines int      `json:"old_lines"`
+	NewStart int      `json:"new_start"`
+	NewLines int      `json:"new_lines"`
+	Lines    []string `json:"lines"`
+}
+
+type FSDiffParams struct {
+	SessionID        string  `json:"session_id"`
+	Path             string  `json:"path"`
+	OtherPath        string  `json:"other_path,omitempty"`
+	Content          *string `json:"content,omitempty"`
+	Encoding         string  `json:"encoding,omitempty"`
+	Format           string  `json:"format,omitempty"`
+	Context          *int    `json:"context,omitempty"`
+	IgnoreWhitespace bool    `json:"ignore_whitespace,omitempty"`
+	MaxBytes         int64   `json:"max_bytes,omitempty"`
+}
+
+func (r FSPatchResult) AffectedPaths() []string {
+	paths := append(append(append([]string{}, r.Added...), r.Updated...), r.Deleted...)
+	for _, m := range r.Moved {
+		paths = append(paths, m.From, m.To)
+	}
+	return paths
+}
+
+type GitStatusParams struct {
+	SessionID  string   `json:"session_id"`
+	Cwd        string   `json:"cwd,omitempty"`
+	Paths      []string `json:"paths,omitempty"`
+	Untracked  *bool    `json:"untracked,omitempty"`
+	Ignored    bool     `json:"ignored,omitempty"`
+	MaxEntries int      `json:"max_entries,omitempty"`
+	MaxBytes   int64    `json:"max_bytes,omitempty"`
+	TimeoutMS  int      `json:"timeout_ms,omitempty"`
+}
+
+type GitDiffParams struct {
+	SessionID  string   `json:"session_id"`
+	Cwd        string   `json:"cwd,omitempty"`
+	Paths      []string `json:"paths,omitempty"`
+	Staged     bool     `json:"staged,omitempty"`
+	Base       string   `json:"base,omitempty"`
+	Target     string   `json:"target,omitempty"`
+	Context    *int     `json:"context,omitempty"`
+	MaxEntries int      `json:"max_entries,omitempty"`
+	MaxBytes   int64    `json:"max_bytes,omitempty"`
+	TimeoutMS  int      `json:"timeout_ms,omitempty"`
+}
+
+type GitLogParams struct {
+	SessionID  string   `json:"session_id"`
+	Cwd        string   `json:"cwd,omitempty"`
+	Paths      []string `json:"paths,omitempty"`
+	Rev        string   `json:"rev,omitempty"`
+	Skip       int      `json:"skip,omitempty"`
+	MaxEntries int      `json:"max_entries,omitempty"`
+	MaxBytes   int64    `json:"max_bytes,omitempty"`
+	TimeoutMS  int      `json:"timeout_ms,omitempty"`
+}
+
+type GitBlameParams struct {
+	SessionID  string `json:"session_id"`
+	Cwd        string `json:"cwd,omitempty"`
+	Path       string `json:"path"`
+	Rev        string `json:"rev,omitempty"`
+	StartLine  int    `json:"start_line,omitempty"`
+	EndLine    int    `json:"end_line,omitempty"`
+	MaxEntries int    `json:"max_entries,omitempty"`
+	MaxBytes   int64  `json:"max_bytes,omitempty"`
+	TimeoutMS  int    `json:"timeout_ms,omitempty"`
+}
+
+type WorktreeCreateParams struct {
+	SessionID string `json:"session_id"`
+	Cwd       string `json:"cwd,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Branch    string `json:"branch,omitempty"`
+	Base      string `json:"base,omitempty"`
+	SetCwd    *bool  `json:"set_cwd,omitempty"`
+	TimeoutMS int    `json:"timeout_ms,omitempty"`
+}
+
+type WorktreeRemoveParams struct {
+	SessionID    string `json:"session_id"`
+	Name         string `json:"name,omitempty"`
+	Path         string `json:"path,omitempty"`
+	Force        bool   `json:"force,omitempty"`
+	DeleteBranch bool   `json:"delete_branch,omitempty"`
+	TimeoutMS    int    `json:"timeout_ms,omitempty"`
+}
+
+type WorktreeListParams struct {
+	SessionID string `json:"session_id"`
 }
 
 type PTYOpenParams struct {
@@ -180,3 +508,64 @@ type PTYCloseParams struct {
 	SessionID string `json:"session_id"`
 	PTYID     string `json:"pty_id"`
 }
+
+type PTYAttachParams struct {
+	SessionID string `json:"session_id"`
+	PTYID     string `json:"pty_id"`
+	Role      string `json:"role,omitempty"`
+}
+
+type PTYAttachResult struct {
+	PTYID        string `json:"pty_id"`
+	ProcessID    string `json:"process_id"`
+	Role         string `json:"role"`
+	Owner        string `json:"owner"`
+	Participants any    `json:"participants"`
+}
+
+type PTYDetachParams struct {
+	SessionID string `json:"session_id"`
+	PTYID     string `json:"pty_id"`
+}
+
+type PTYHandoffParams struct {
+	SessionID   string `json:"session_id"`
+	PTYID       string `json:"pty_id"`
+	ToSessionID string `json:"to_session_id"`
+	Role        string `json:"role,omitempty"`
+}
+
+type PTYGrantParams struct {
+	SessionID   string `json:"session_id"`
+	PTYID       string `json:"pty_id"`
+	ToSessionID string `json:"to_session_id"`
+	Role        string `json:"role,omitempty"`
+}
+
+type ShellOpenParams struct {
+	SessionID   string            `json:"session_id"`
+	Interpreter string            `json:"interpreter,omitempty"`
+	Cwd         string            `json:"cwd,omitempty"`
+	Env         map[string]string `json:"env,omitempty"`
+	Login       bool              `json:"login,omitempty"`
+}
+
+type ShellOpenResult struct {
+	ShellID     string `json:"shell_id"`
+	Interpreter string `json:"interpreter"`
+	Cwd         string `json:"cwd"`
+	Pid         int    `json:"pid"`
+}
+
+type ShellRunParams struct {
+	SessionID      string `json:"session_id"`
+	ShellID        string `json:"shell_id"`
+	Command        string `json:"command"`
+	TimeoutMS      int    `json:"timeout_ms,omitempty"`
+	MaxOutputBytes int    `json:"max_output_bytes,omitempty"`
+}
+
+type ShellCloseParams struct {
+	SessionID string `json:"session_id"`
+	ShellID   string `json:"shell_id"`
+}
@@ -8,6 +8,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
@@ -16,6 +17,7 @@ import (
 	"github.com/samiralibabic/rexd/internal/events"
 	execsvc "github.com/samiralibabic/rexd/internal/exec"
 	fssvc "github.com/samiralibabic/rexd/internal/fs"
+	gitsvc "github.com/samiralibabic/rexd/internal/git"
 	"github.com/samiralibabic/rexd/internal/policy"
 	"github.com/samiralibabic/rexd/internal/protocol"
 	"github.com/samiralibabic/rexd/internal/session"
@@ -23,33 +25,73 @@ import (
 
 const ServerVersion = "0.1.4"
 
+const streamDrainTimeout = 2 * time.Second
+
 type Service struct {
-	cfg      config.Config
-	sessions *session.Manager
-	policy   *policy.Engine
-	exec     *execsvc.Manager
-	pty      *execsvc.PTYManager
-	fs       *fssvc.Service
-	bus      *events.Bus
-	audit    *audit.Logger
+	cfg       config.Config
+	sessions  *session.Manager
+	policy    *policy.Engine
+	exec      *execsvc.Manager
+	pty       *execsvc.PTYManager
+	shells    *execsvc.ShellManager
+	fs        *fssvc.Service
+	watches   *fssvc.WatchManager
+	transfers *fssvc.TransferManager
+	journal   *fssvc.JournalManager
+	git       *gitsvc.Service
+	worktrees *gitsvc.WorktreeManager
+	bus       *events.Bus
+	audit     *audit.Logger
 }
 
 func NewService(cfg config.Config) (*Service, error) {
-	roots := config.AllowedRoots(cfg)
-	pol, err := policy.New(roots, cfg.Security.AllowShell)
+	roots := make([]policy.Root, 0, len(cfg.Security.AllowedRoot))
+	for _, r := range cfg.Security.AllowedRoot {
+		if r.Path != "" {
+			roots = append(roots, policy.Root{Path: r.Path, ReadOnly: r.Mode == "ro", Deny: r.Deny})
+		}
+	}
+	pol, err := policy.New(policy.Options{
+		Roots:         roots,
+		Deny:          cfg.Security.Deny,
+		AllowShell:    cfg.Security.AllowShell,
+		AllowSymlinks: cfg.Security.AllowSymlinks,
+		Shell:         cfg.Exec.Shell,
+		AllowedShells: cfg.Exec.AllowedShells,
+		Interpreters:  cfg.Exec.ScriptInterpreters,
+	})
 	if err != nil {
 		return nil, err
 	}
 	bus := events.NewBus()
+	fsService := fssvc.NewService(int64(cfg.Limits.MaxFileReadBytes), pol.OpenFile, pol.IsDenied, pol.RootFor)
+	gitService := gitsvc.NewService(cfg.Git.Binary, pol.IsDenied)
 	return &Service{
 		cfg:      cfg,
 		sessions: session.NewManager(cfg.Limits.MaxConcurrentSessions),
 		policy:   pol,
-		exec:     execsvc.NewManager(bus),
-		pty:      execsvc.NewPTYManager(bus),
-		fs:       fssvc.NewService(int64(cfg.Limits.MaxFileReadBytes)),
-		bus:      bus,
-		audit:    audit.New(cfg.Audit.Enabled, cfg.Audit.Path),
+		exec: execsvc.NewManager(bus, execsvc.OutputBatching{
+			MaxBytes:      cfg.Exec.OutputBatchBytes,
+			FlushInterval: time.Duration(cfg.Exec.OutputFlushMs) * time.Millisecond,
+		}),
+		pty:       execsvc.NewPTYManager(bus),
+		shells:    execsvc.NewShellManager(),
+		fs:        fsService,
+		watches:   fssvc.NewWatchManager(bus, pol.IsDenied),
+		transfers: fssvc.NewTransferManager(bus, fsService, time.Duration(cfg.Limits.DownloadIdleTimeoutMs)*time.Millisecond),
+		journal: fssvc.NewJournalManager(fsService, fssvc.JournalOptions{
+			Enabled:    cfg.Journal.Enabled,
+			MaxEntries: cfg.Journal.MaxEntries,
+			MaxBytes:   cfg.Journal.MaxBytes,
+		}),
+		git: gitService,
+		worktrees: gitsvc.NewWorktreeManager(gitService, gitsvc.WorktreeOptions{
+			Root:          cfg.Workspace.WorktreeRoot,
+			BranchPrefix:  cfg.Workspace.BranchPrefix,
+			MaxPerSession: cfg.Workspace.MaxWorktreesPerSession,
+		}),
+		bus:   bus,
+		audit: audit.New(cfg.Audit.Enabled, cfg.Audit.Path),
 	}, nil
 }
 
@@ -97,6 +139,12 @@ func (s *Service) Handle(ctx context.Context, req protocol.Request) protocol.Res
 			return s.errResp(id, err)
 		}
 		resp.Result = out
+	case "exec.script":
+		out, err := s.execScript(ctx, req.Params)
+		if err != nil {
+			return s.errResp(id, err)
+		}
+		resp.Result = out
 	case "exec.wait":
 		out, err := s.execWait(ctx, req.Params)
 		if err != nil {
@@ -139,24 +187,228 @@ func (s *Service) Handle(ctx context.Context, req protocol.Request) protocol.Res
 			return s.errResp(id, err)
 		}
 		resp.Result = out
+	case "fs.search":
+		out, err := s.fsSearch(req.Params)
+		if err != nil {
+			return s.errResp(id, err)
+		}
+		resp.Result = out
+	case "fs.watch":
+		out, err := s.fsWatch(req.Params)
+		if err != nil {
+			return s.errResp(id, err)
+		}
+		resp.Result = out
+	case "fs.unwatch":
+		out, err := s.fsUnwatch(req.Params)
+		if err != nil {
+			return s.errResp(id, err)
+		}
+		resp.Result = out
+	case "fs.chmod":
+		out, err := s.fsChmod(req.Params)
+		if err != nil {
+			return s.errResp(id, err)
+		}
+		resp.Result = out
+	case "fs.hash":
+		out, err := s.fsHash(req.Params)
+		if err != nil {
+			return s.errResp(id, err)
+		}
+		resp.Result = out
 	case "fs.stat":
 		out, err := s.fsStat(req.Params)
 		if err != nil {
 			return s.errResp(id, err)
 		}
 		resp.Result = out
+	case "fs.move":
+		out, err := s.fsMove(req.Params)
+		if err != nil {
+			return s.errResp(id, err)
+		}
+		resp.Result = out
+	case "fs.copy":
+		out, err := s.fsCopy(req.Params)
+		if err != nil {
+			return s.errResp(id, err)
+		}
+		resp.Result = out
+	case "fs.remove":
+		out, err := s.fsRemove(req.Params)
+		if err != nil {
+			return s.errResp(id, err)
+		}
+		resp.Result = out
+	case "fs.mkdir":
+		out, err := s.fsMkdir(req.Params)
+		if err != nil {
+			return s.errResp(id, err)
+		}
+		resp.Result = out
+	case "fs.upload.begin":
+		out, err := s.fsUploadBegin(req.Params)
+		if err != nil {
+			return s.errResp(id, err)
+		}
+		resp.Result = out
+	case "fs.upload.chunk":
+		out, err := s.fsUploadChunk(req.Params)
+		if err != nil {
+			return s.errResp(id, err)
+		}
+		resp.Result = out
+	case "fs.upload.status":
+		out, err := s.fsUploadStatus(req.Params)
+		if err != nil {
+			return s.errResp(id, err)
+		}
+		resp.Result = out
+	case "fs.upload.commit":
+		out, err := s.fsUploadCommit(req.Params)
+		if err != nil {
+			return s.errResp(id, err)
+		}
+		resp.Result = out
+	case "fs.upload.abort":
+		out, err := s.fsUploadAbort(req.Params)
+		if err != nil {
+			return s.errResp(id, err)
+		}
+		resp.Result = out
+	case "fs.download":
+		out, err := s.fsDownload(req.Params)
+		if err != nil {
+			return s.errResp(id, err)
+		}
+		resp.Result = out
+	case "fs.archive":
+		out, err := s.fsArchive(req.Params)
+		if err != nil {
+			return s.errResp(id, err)
+		}
+		resp.Result = out
+	case "fs.extract":
+		out, err := s.fsExtract(req.Params)
+		if err != nil {
+			return s.errResp(id, err)
+		}
+		resp.Result = out
+	case "fs.download.ack":
+		out, err := s.fsDownloadAck(req.Params)
+		if err != nil {
+			return s.errResp(id, err)
+		}
+		resp.Result = out
+	case "fs.download.cancel":
+		out, err := s.fsDownloadCancel(req.Params)
+		if err != nil {
+			return s.errResp(id, err)
+		}
+		resp.Result = out
 	case "fs.edit":
 		out, err := s.fsEdit(req.Params)
 		if err != nil {
 			return s.errResp(id, err)
 		}
 		resp.Result = out
+	case "fs.multi_edit":
+		out, err := s.fsMultiEdit(req.Params)
+		if err != nil {
+			return s.errResp(id, err)
+		}
+		resp.Result = out
+	case "fs.diff":
+		out, err := s.fsDiff(req.Params)
+		if err != nil {
+			return s.errResp(id, err)
+		}
+		resp.Result = out
 	case "fs.patch":
 		out, err := s.fsPatch(req.Params)
 		if err != nil {
 			return s.errResp(id, err)
 		}
 		resp.Result = out
+	case "fs.checkpoint":
+		out, err := s.fsCheckpoint(req.Params)
+		if err != nil {
+			return s.errResp(id, err)
+		}
+		resp.Result = out
+	case "fs.history":
+		out, err := s.fsHistory(req.Params)
+		if err != nil {
+			return s.errResp(id, err)
+		}
+		resp.Result = out
+	case "fs.undo":
+		out, err := s.fsUndo(req.Params)
+		if err != nil {
+			return s.errResp(id, err)
+		}
+		resp.Result = out
+	case "git.status":
+		out, err := s.gitStatus(ctx, req.Params)
+		if err != nil {
+			return s.errResp(id, err)
+		}
+		resp.Result = out
+	case "git.diff":
+		out, err := s.gitDiff(ctx, req.Params)
+		if err != nil {
+			return s.errResp(id, err)
+		}
+		resp.Result = out
+	case "git.log":
+		out, err := s.gitLog(ctx, req.Params)
+		if err != nil {
+			return s.errResp(id, err)
+		}
+		resp.Result = out
+	case "git.blame":
+		out, err := s.gitBlame(ctx, req.Params)
+		if err != nil {
+			return s.errResp(id, err)
+		}
+		resp.Result = out
+	case "workspace.worktree.create":
+		out, err := s.worktreeCreate(ctx, req.Params)
+		if err != nil {
+			return s.errResp(id, err)
+		}
+		resp.Result = out
+	case "workspace.worktree.remove":
+		out, err := s.worktreeRemove(ctx, req.Params)
+		if err != nil {
+			return s.errResp(id, err)
+		}
+		resp.Result = out
+	case "workspace.worktree.list":
+		out, err := s.worktreeList(req.Params)
+		if err != nil {
+			return s.errResp(id, err)
+		}
+		resp.Result = out
+	case "shell.open":
+		out, err := s.shellOpen(req.Params)
+		if err != nil {
+			return s.errResp(id, err)
+		}
+		resp.Result = out
+	case "shell.run":
+		out, err := s.shellRun(req.Params)
+		if err != nil {
+			return s.errResp(id, err)
+		}
+		resp.Result = out
+	case "shell.close":
+		out, err := s.shellClose(req.Params)
+		if err != nil {
+			return s.errResp(id, err)
+		}
+		resp.Result = out
 	case "pty.open":
 		out, err := s.ptyOpen(ctx, req.Params)
 		if err != nil {
@@ -181,10 +433,38 @@ func (s *Service) Handle(ctx context.Context, req protocol.Request) protocol.Res
 			return s.errResp(id, err)
 		}
 		resp.Result = out
+	case "pty.attach":
+		out, err := s.ptyAttach(req.Params)
+		if err != nil {
+			return s.errResp(id, err)
+		}
+		resp.Result = out
+	case "pty.detach":
+		out, err := s.ptyDetach(req.Params)
+		if err != nil {
+			return s.errResp(id, err)
+		}
+		resp.Result = out
+	case "pty.handoff":
+		out, err := s.ptyHandoff(req.Params)
+		if err != nil {
+			return s.errResp(id, err)
+		}
+		resp.Result = out
+	case "pty.grant":
+		out, err := s.ptyGrant(req.Params)
+		if err != nil {
+			return s.errResp(id, err)
+		}
+		resp.Result = out
 	default:
 		return protocol.ErrorResponse(id, protocol.ErrMethodNotFound, "method not found", map[string]any{"method": req.Method})
 	}
-	s.audit.Write(audit.Entry{Method: req.Method, Result: resp.Result})
+	entry := audit.Entry{Method: req.Method, Result: resp.Result}
+	if affected, ok := resp.Result.(interface{ AffectedPaths() []string }); ok {
+		entry.Paths = affected.AffectedPaths()
+	}
+	s.audit.Write(entry)
 	return resp
 }
 
@@ -194,13 +474,35 @@ func (s *Service) errResp(id any, err error) protocol.Response {
 		return protocol.ErrorResponse(id, protocol.ErrInvalidParams, err.Error(), nil)
 	case errors.Is(err, policy.ErrForbiddenPath):
 		return protocol.ErrorResponse(id, protocol.ErrForbiddenPath, "Path is outside allowed roots", nil)
+	case errors.Is(err, policy.ErrDeniedPath), errors.Is(err, policy.ErrReadOnlyPath):
+		return protocol.ErrorResponse(id, protocol.ErrAccessDenied, err.Error(), errorData(err))
 	case errors.Is(err, fssvc.ErrConflict):
+		return protocol.ErrorResponse(id, protocol.ErrConcurrencyConflict, err.Error(), errorData(err))
+	case errors.Is(err, fssvc.ErrDestinationExists), errors.Is(err, fssvc.ErrChecksumMismatch):
 		return protocol.ErrorResponse(id, protocol.ErrConcurrencyConflict, err.Error(), nil)
+	case errors.Is(err, gitsvc.ErrTimeout):
+		return protocol.ErrorResponse(id, protocol.ErrTimeout, err.Error(), nil)
+	case errors.Is(err, gitsvc.ErrWorktreesDisabled):
+		return protocol.ErrorResponse(id, protocol.ErrUnsupportedCapability, err.Error(), nil)
+	case errors.Is(err, gitsvc.ErrWorktreeLimit):
+		return protocol.ErrorResponse(id, protocol.ErrResourceLimit, err.Error(), nil)
+	case errors.Is(err, policy.ErrForbiddenInterpreter):
+		return protocol.ErrorResponse(id, protocol.ErrUnauthorized, err.Error(), nil)
+	case errors.Is(err, execsvc.ErrPTYReadOnly), errors.Is(err, execsvc.ErrPTYNotOwner), errors.Is(err, execsvc.ErrPTYNotAttached), errors.Is(err, execsvc.ErrPTYNeedsGrant):
+		return protocol.ErrorResponse(id, protocol.ErrUnauthorized, err.Error(), nil)
 	case strings.Contains(err.Error(), "process not found"):
 		return protocol.ErrorResponse(id, protocol.ErrProcessNotFound, err.Error(), nil)
 	default:
-		return protocol.ErrorResponse(id, protocol.ErrInvalidParams, err.Error(), nil)
+		return protocol.ErrorResponse(id, protocol.ErrInvalidParams, err.Error(), errorData(err))
+	}
+}
+
+func errorData(err error) any {
+	var withData interface{ ErrorData() any }
+	if errors.As(err, &withData) {
+		return withData.ErrorData()
 	}
+	return nil
 }
 
 func decode[T any](raw json.RawMessage) (T, error) {
@@ -235,11 +537,15 @@ func (s *Service) sessionOpen(raw json.RawMessage) (any, error) {
 	if err != nil {
 		return nil, err
 	}
+	capabilities := []string{"exec", "fs", "events", "pty", "shell", "watch", "git", "http"}
+	if s.worktrees.Enabled() {
+		capabilities = append(capabilities, "worktree")
+	}
 	return protocol.SessionOpenResult{
 		SessionID:      sess.ID,
 		Protocol:       "rexd/1",
 		ServerVersion:  ServerVersion,
-		Capabilities:   []string{"exec", "fs", "events", "pty", "http"},
+		Capabilities:   capabilities,
 		Limits:         map[string]int{"default_timeout_ms": s.cfg.Limits.DefaultTimeoutMs, "max_output_bytes": s.cfg.Limits.MaxOutputBytes},
 		WorkspaceRoots: roots,
 	}, nil
@@ -257,6 +563,7 @@ func (s *Service) sessionInfo(raw json.RawMessage) (any, error) {
 	return map[string]any{
 		"session_id":        sess.ID,
 		"cwd":               sess.CWD,
+		"env":               sess.Env,
 		"workspace_roots":   sess.WorkspaceRoots,
 		"running_processes": sess.ProcessCount,
 		"limits": map[string]any{
@@ -275,6 +582,16 @@ func (s *Service) sessionClose(raw json.RawMessage) (any, error) {
 	if err := s.sessions.Close(p.SessionID); err != nil {
 		return nil, err
 	}
+	s.shells.CloseSession(p.SessionID)
+	s.pty.CloseSession(p.SessionID)
+	s.watches.CloseSession(p.SessionID)
+	s.transfers.CloseSession(p.SessionID)
+	s.journal.CloseSession(p.SessionID)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(s.cfg.Limits.DefaultTimeoutMs)*time.Millisecond)
+	s.worktrees.CloseSession(ctx, p.SessionID)
+	cancel()
+	s.policy.RemoveSessionRoots(p.SessionID)
+	s.bus.Forget(p.SessionID)
 	return map[string]any{"ok": true}, nil
 }
 
@@ -296,11 +613,11 @@ func (s *Service) execStart(ctx context.Context, raw json.RawMessage) (any, erro
 		return nil, err
 	}
 	if sess.ProcessCount >= s.cfg.Limits.MaxProcessesPerSess {
-		return nil, errors.New("max processes per session reached")
+		return nil, session.ErrProcessLimit
 	}
 	cwd := sess.CWD
 	if p.Cwd != "" {
-		cwd, err = s.policy.ResolvePath(sess.CWD, p.Cwd)
+		cwd, err = s.policy.ResolveSessionPath(sess.ID, sess.CWD, p.Cwd)
 		if err != nil {
 			return nil, err
 		}
@@ -313,10 +630,14 @@ func (s *Service) execStart(ctx context.Context, raw json.RawMessage) (any, erro
 		if p.Command == "" {
 			return nil, errors.New("command required when shell=true")
 		}
+		interpreter, err := s.policy.ResolveShell("")
+		if err != nil {
+			return nil, err
+		}
 		if p.Login {
-			cmd = exec.CommandContext(ctx, "sh", "-lc", p.Command)
+			cmd = exec.CommandContext(ctx, interpreter, "-lc", p.Command)
 		} else {
-			cmd = exec.CommandContext(ctx, "sh", "-c", p.Command)
+			cmd = exec.CommandContext(ctx, interpreter, "-c", p.Command)
 		}
 	} else {
 		if len(p.Argv) == 0 {
@@ -325,27 +646,112 @@ func (s *Service) execStart(ctx context.Context, raw json.RawMessage) (any, erro
 		cmd = exec.CommandContext(ctx, p.Argv[0], p.Argv[1:]...)
 	}
 	cmd.Dir = cwd
-	if len(p.Env) > 0 {
-		cmd.Env = append(cmd.Env, buildEnv(p.Env)...)
+	return s.startProcess(sess, cmd, p, nil)
+}
+
+func (s *Service) execScript(ctx context.Context, raw json.RawMessage) (any, error) {
+	p, err := decode[protocol.ExecScriptParams](raw)
+	if err != nil {
+		return nil, err
+	}
+	sess, err := s.sessions.Get(p.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	if sess.ProcessCount >= s.cfg.Limits.MaxProcessesPerSess {
+		return nil, session.ErrProcessLimit
 	}
-	stdout, err := cmd.StdoutPipe()
+	if p.Script == "" {
+		return nil, errors.New("script is required")
+	}
+	interpreter, err := s.policy.ResolveInterpreter(p.Interpreter)
 	if err != nil {
 		return nil, err
 	}
-	stderr, err := cmd.StderrPipe()
+	cwd := sess.CWD
+	if p.Cwd != "" {
+		cwd, err = s.policy.ResolveSessionPath(sess.ID, sess.CWD, p.Cwd)
+		if err != nil {
+			return nil, err
+		}
+	}
+	dir, err := os.MkdirTemp("", "rexd-script-")
 	if err != nil {
 		return nil, err
 	}
-	stdin, err := cmd.StdinPipe()
+	cleanup := func() { _ = os.RemoveAll(dir) }
+	scriptPath := filepath.Join(dir, "script")
+	if err := os.WriteFile(scriptPath, []byte(p.Script), 0600); err != nil {
+		cleanup()
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, interpreter, append([]string{scriptPath}, p.Args...)...)
+	cmd.Dir = cwd
+	out, err := s.startProcess(sess, cmd, protocol.ExecStartParams{
+		SessionID:      p.SessionID,
+		Env:            p.Env,
+		Stdin:          p.Stdin,
+		TimeoutMS:      p.TimeoutMS,
+		MaxOutputBytes: p.MaxOutputBytes,
+	}, cleanup)
 	if err != nil {
+		cleanup()
+		return nil, err
+	}
+	return out, nil
+}
+
+func (s *Service) startProcess(sess *session.Session, cmd *exec.Cmd, p protocol.ExecStartParams, cleanup func()) (any, error) {
+	if err := s.sessions.IncProcess(sess.ID, s.cfg.Limits.MaxProcessesPerSess); err != nil {
 		return nil, err
 	}
-	if err := cmd.Start(); err != nil {
+	reserved := true
+	defer func() {
+		if reserved {
+			_ = s.sessions.DecProcess(sess.ID)
+		}
+	}()
+	if len(p.Env) > 0 {
+		cmd.Env = append(cmd.Env, buildEnv(p.Env)...)
+	}
+	stdout, stdoutW, err := os.Pipe()
+	if err != nil {
 		return nil, err
 	}
-	if err := s.sessions.IncProcess(sess.ID); err != nil {
+	var stderr, stderrW *os.File
+	if p.MergeStreams {
+		stderrW = stdoutW
+	} else {
+		stderr, stderrW, err = os.Pipe()
+		if err != nil {
+			_ = stdout.Close()
+			_ = stdoutW.Close()
+			return nil, err
+		}
+	}
+	closeReaders := func() {
+		_ = stdout.Close()
+		if stderr != nil {
+			_ = stderr.Close()
+		}
+	}
+	cmd.Stdout = stdoutW
+	cmd.Stderr = stderrW
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		closeReaders()
+		_ = stdoutW.Close()
+		_ = stderrW.Close()
 		return nil, err
 	}
+	startErr := cmd.Start()
+	_ = stdoutW.Close()
+	_ = stderrW.Close()
+	if startErr != nil {
+		closeReaders()
+		return nil, startErr
+	}
+	reserved = false
 	maxOutput := p.MaxOutputBytes
 	if maxOutput <= 0 {
 		maxOutput = s.cfg.Limits.MaxOutputBytes
@@ -371,7 +777,11 @@ func (s *Service) execStart(ctx context.Context, raw json.RawMessage) (any, erro
 	}
 	rp.CancelTimeout(cancel)
 	s.exec.Add(rp)
-	s.exec.WireStreams(rp, stdout, stderr)
+	if stderr != nil {
+		s.exec.WireStreams(rp, stdout, stderr)
+	} else {
+		s.exec.WireStreams(rp, stdout, nil)
+	}
 	if p.Stdin != "" {
 		_, _ = stdin.Write([]byte(p.Stdin))
 		_ = stdin.Close()
@@ -383,6 +793,14 @@ func (s *Service) execStart(ctx context.Context, raw json.RawMessage) (any, erro
 	}()
 	go func() {
 		waitErr := cmd.Wait()
+		if !rp.WaitStreams(streamDrainTimeout) {
+			closeReaders()
+			rp.WaitStreams(streamDrainTimeout)
+		}
+		closeReaders()
+		if cleanup != nil {
+			cleanup()
+		}
 		state := s.exec.Wait(rp, waitErr)
 		rp.ExitCh <- state
 		s.bus.Publish(sess.ID, "exec.exit", map[string]any{
@@ -467,126 +885,835 @@ func (s *Service) execInput(raw json.RawMessage) (any, error) {
 	return protocol.ExecInputResult{AcceptedBytes: n}, nil
 }
 
-func (s *Service) resolveSessionPath(sessionID, inputPath string) (string, error) {
-	sess, err := s.sessions.Get(sessionID)
-	if err != nil {
-		return "", err
-	}
-	return s.policy.ResolvePath(sess.CWD, inputPath)
-}
-
-func (s *Service) fsRead(raw json.RawMessage) (any, error) {
-	p, err := decode[protocol.FSReadParams](raw)
+func (s *Service) shellOpen(raw json.RawMessage) (any, error) {
+	p, err := decode[protocol.ShellOpenParams](raw)
 	if err != nil {
 		return nil, err
 	}
-	abs, err := s.resolveSessionPath(p.SessionID, p.Path)
+	sess, err := s.sessions.Get(p.SessionID)
 	if err != nil {
 		return nil, err
 	}
-	return s.fs.Read(abs, p.Encoding, p.Offset, p.Length)
-}
-
-func (s *Service) fsWrite(raw json.RawMessage) (any, error) {
-	p, err := decode[protocol.FSWriteParams](raw)
+	if !s.policy.AllowShell() {
+		return nil, errors.New("shell mode disabled")
+	}
+	if sess.ProcessCount >= s.cfg.Limits.MaxProcessesPerSess {
+		return nil, session.ErrProcessLimit
+	}
+	interpreter, err := s.policy.ResolveShell(p.Interpreter)
 	if err != nil {
 		return nil, err
 	}
-	abs, err := s.resolveSessionPath(p.SessionID, p.Path)
-	if err != nil {
+	cwd := sess.CWD
+	if p.Cwd != "" {
+		cwd, err = s.policy.ResolveSessionPath(sess.ID, sess.CWD, p.Cwd)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := s.sessions.IncProcess(sess.ID, s.cfg.Limits.MaxProcessesPerSess); err != nil {
 		return nil, err
 	}
-	content, err := fssvc.DecodeContent(p.Content, p.Encoding)
+	sh, err := s.shells.Open(sess.ID, interpreter, cwd, p.Env, p.Login, s.cfg.Limits.MaxOutputBytes)
 	if err != nil {
+		_ = s.sessions.DecProcess(sess.ID)
 		return nil, err
 	}
-	mode := p.Mode
-	if mode == "" {
-		mode = "replace"
-	}
-	return s.fs.Write(abs, content, mode, p.MkdirParents, true, p.ExpectedMTime)
+	go func() {
+		<-sh.Done()
+		_ = s.sessions.DecProcess(sess.ID)
+	}()
+	return protocol.ShellOpenResult{
+		ShellID:     sh.ID,
+		Interpreter: interpreter,
+		Cwd:         cwd,
+		Pid:         sh.Cmd.Process.Pid,
+	}, nil
 }
 
-func (s *Service) fsList(raw json.RawMessage) (any, error) {
-	p, err := decode[protocol.FSListParams](raw)
+func (s *Service) shellRun(raw json.RawMessage) (any, error) {
+	p, err := decode[protocol.ShellRunParams](raw)
 	if err != nil {
 		return nil, err
 	}
-	abs, err := s.resolveSessionPath(p.SessionID, p.Path)
+	if p.Command == "" {
+		return nil, errors.New("command is required")
+	}
+	sh, err := s.shells.Get(p.ShellID, p.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	timeoutMS := p.TimeoutMS
+	if timeoutMS <= 0 {
+		timeoutMS = s.cfg.Limits.DefaultTimeoutMs
+	}
+	if timeoutMS > s.cfg.Limits.HardTimeoutMs {
+		timeoutMS = s.cfg.Limits.HardTimeoutMs
+	}
+	maxOutput := p.MaxOutputBytes
+	if maxOutput <= 0 {
+		maxOutput = s.cfg.Limits.MaxOutputBytes
+	}
+	result, err := sh.Run(p.Command, time.Duration(timeoutMS)*time.Millisecond, maxOutput)
+	if err != nil {
+		return nil, err
+	}
+	if result.Cwd != "" {
+		if cwd, err := s.policy.ResolveSessionPath(p.SessionID, "/", result.Cwd); err == nil {
+			_ = s.sessions.SetCWD(p.SessionID, cwd)
+		}
+	}
+	if result.Env != nil {
+		_ = s.sessions.SetEnv(p.SessionID, result.Env)
+	}
+	return result, nil
+}
+
+func (s *Service) shellClose(raw json.RawMessage) (any, error) {
+	p, err := decode[protocol.ShellCloseParams](raw)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.shells.Close(p.ShellID, p.SessionID); err != nil {
+		return nil, err
+	}
+	return map[string]any{"ok": true}, nil
+}
+
+func (s *Service) resolveSessionPath(sessionID, inputPath string) (string, error) {
+	sess, err := s.sessions.Get(sessionID)
+	if err != nil {
+		return "", err
+	}
+	return s.policy.ResolveSessionPath(sess.ID, sess.CWD, inputPath)
+}
+
+func (s *Service) resolveSessionWritePath(sessionID, inputPath string) (string, error) {
+	sess, err := s.sessions.Get(sessionID)
+	if err != nil {
+		return "", err
+	}
+	return s.policy.ResolveSessionWritePath(sess.ID, sess.CWD, inputPath)
+}
+
+func (s *Service) fsRead(raw json.RawMessage) (any, error) {
+	p, err := decode[protocol.FSReadParams](raw)
+	if err != nil {
+		return nil, err
+	}
+	abs, err := s.resolveSessionPath(p.SessionID, p.Path)
+	if err != nil {
+		return nil, err
+	}
+	if p.OnBinary != "" && p.OnBinary != "base64" && p.OnBinary != "error" {
+		return nil, errors.New("on_binary must be base64 or error")
+	}
+	result, err := s.fs.Read(abs, fssvc.ReadOptions{
+		Encoding:      p.Encoding,
+		Offset:        p.Offset,
+		Length:        p.Length,
+		StartLine:     p.StartLine,
+		MaxLines:      p.MaxLines,
+		LineNumbers:   p.LineNumbers,
+		MaxLineLength: p.MaxLineLength,
+		OnBinary:      p.OnBinary,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.withHash(result, abs, p.Hash)
+}
+
+func (s *Service) withHash(result map[string]any, abs string, include bool) (map[string]any, error) {
+	if !include || result["exists"] == false || (result["type"] != nil && result["type"] != "file") {
+		return result, nil
+	}
+	sum, err := s.fs.SHA256(abs)
+	if err != nil {
+		return nil, err
+	}
+	result["sha256"] = sum
+	return result, nil
+}
+
+func (s *Service) fsWrite(raw json.RawMessage) (any, error) {
+	p, err := decode[protocol.FSWriteParams](raw)
+	if err != nil {
+		return nil, err
+	}
+	abs, err := s.resolveSessionWritePath(p.SessionID, p.Path)
+	if err != nil {
+		return nil, err
+	}
+	content, err := fssvc.DecodeContent(p.Content, p.Encoding)
+	if err != nil {
+		return nil, err
+	}
+	mode := p.Mode
+	if mode == "" {
+		mode = "replace"
+	}
+	perm, err := fssvc.ParsePerm(p.Perm)
+	if err != nil {
+		return nil, err
+	}
+	if p.Encoding == "base64" && (p.TextEncoding != "" || p.LineEnding != "") {
+		return nil, errors.New("text_encoding and line_ending require utf8 content")
+	}
+	rec := s.journal.Capture(abs)
+	result, err := s.fs.Write(abs, content, fssvc.WriteOptions{
+		Mode:         mode,
+		MkdirParents: p.MkdirParents,
+		Atomic:       true,
+		Perm:         perm,
+		Pre:          fssvc.Preconditions{MTime: p.ExpectedMTime, SHA256: strings.ToLower(p.ExpectedSHA256)},
+		TextEncoding: p.TextEncoding,
+		LineEnding:   p.LineEnding,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.journal.Record(p.SessionID, "fs.write", rec)
+	return s.withHash(result, abs, p.Hash)
+}
+
+func (s *Service) fsMove(raw json.RawMessage) (any, error) {
+	p, err := decode[protocol.FSMoveParams](raw)
+	if err != nil {
+		return nil, err
+	}
+	from, to, err := s.resolveSessionPaths(p.SessionID, p.From, p.To)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.policy.CheckWritable(from); err != nil {
+		return nil, err
+	}
+	if s.isAllowedRoot(p.SessionID, from) {
+		return nil, errors.New("cannot move an allowed root")
+	}
+	if err := s.checkSubtrees(from); err != nil {
+		return nil, err
+	}
+	if p.Overwrite {
+		if err := s.checkSubtrees(to); err != nil {
+			return nil, err
+		}
+	}
+	return journaled(s, p.SessionID, "fs.move", []string{from, to}, func() (*fssvc.MoveResult, error) {
+		return s.fs.Move(from, to, p.Overwrite, p.MkdirParents, p.ExpectedMTime, p.ExpectedDestMTime)
+	})
+}
+
+func (s *Service) fsCopy(raw json.RawMessage) (any, error) {
+	p, err := decode[protocol.FSCopyParams](raw)
+	if err != nil {
+		return nil, err
+	}
+	from, to, err := s.resolveSessionPaths(p.SessionID, p.From, p.To)
+	if err != nil {
+		return nil, err
+	}
+	if p.Overwrite {
+		if err := s.checkSubtrees(to); err != nil {
+			return nil, err
+		}
+	}
+	return journaled(s, p.SessionID, "fs.copy", []string{to}, func() (*fssvc.CopyResult, error) {
+		return s.fs.Copy(from, to, p.Recursive, p.Overwrite, p.MkdirParents, p.ExpectedMTime, p.ExpectedDestMTime)
+	})
+}
+
+func (s *Service) fsRemove(raw json.RawMessage) (any, error) {
+	p, err := decode[protocol.FSRemoveParams](raw)
+	if err != nil {
+		return nil, err
+	}
+	abs, err := s.resolveSessionWritePath(p.SessionID, p.Path)
+	if err != nil {
+		return nil, err
+	}
+	if s.isAllowedRoot(p.SessionID, abs) {
+		return nil, errors.New("cannot remove an allowed root")
+	}
+	if p.Recursive {
+		if err := s.checkSubtrees(abs); err != nil {
+			return nil, err
+		}
+	}
+	return journaled(s, p.SessionID, "fs.remove", []string{abs}, func() (*fssvc.RemoveResult, error) {
+		return s.fs.Remove(abs, p.Recursive, p.MaxEntries, p.ExpectedMTime)
+	})
+}
+
+func (s *Service) fsMkdir(raw json.RawMessage) (any, error) {
+	p, err := decode[protocol.FSMkdirParams](raw)
+	if err != nil {
+		return nil, err
+	}
+	abs, err := s.resolveSessionWritePath(p.SessionID, p.Path)
+	if err != nil {
+		return nil, err
+	}
+	return journaled(s, p.SessionID, "fs.mkdir", []string{abs}, func() (*fssvc.MkdirResult, error) {
+		return s.fs.Mkdir(abs, p.Parents, p.ExpectedMTime)
+	})
+}
+
+func (s *Service) checkSubtrees(paths ...string) error {
+	for _, p := range paths {
+		if err := s.policy.CheckSubtree(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Service) resolveSessionPaths(sessionID, from, to string) (string, string, error) {
+	if from == "" || to == "" {
+		return "", "", errors.New("from and to are required")
+	}
+	fromAbs, err := s.resolveSessionPath(sessionID, from)
+	if err != nil {
+		return "", "", err
+	}
+	toAbs, err := s.resolveSessionWritePath(sessionID, to)
+	if err != nil {
+		return "", "", err
+	}
+	return fromAbs, toAbs, nil
+}
+
+func (s *Service) isAllowedRoot(sessionID, abs string) bool {
+	for _, root := range s.policy.RootsFor(sessionID) {
+		if filepath.Clean(root) == abs {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Service) fsUploadBegin(raw json.RawMessage) (any, error) {
+	p, err := decode[protocol.FSUploadBeginParams](raw)
+	if err != nil {
+		return nil, err
+	}
+	abs, err := s.resolveSessionWritePath(p.SessionID, p.Path)
+	if err != nil {
+		return nil, err
+	}
+	return s.transfers.BeginUpload(p.SessionID, abs, fssvc.UploadOptions{
+		Size:          p.Size,
+		Overwrite:     p.Overwrite,
+		MkdirParents:  p.MkdirParents,
+		ExpectedMTime: p.ExpectedMTime,
+	})
+}
+
+func (s *Service) fsUploadChunk(raw json.RawMessage) (any, error) {
+	p, err := decode[protocol.FSUploadChunkParams](raw)
+	if err != nil {
+		return nil, err
+	}
+	return s.transfers.UploadChunk(p.UploadID, p.SessionID, p.Offset, p.Data)
+}
+
+func (s *Service) fsUploadStatus(raw json.RawMessage) (any, error) {
+	p, err := decode[protocol.FSUploadRefParams](raw)
+	if err != nil {
+		return nil, err
+	}
+	return s.transfers.UploadStatus(p.UploadID, p.SessionID)
+}
+
+func (s *Service) fsUploadCommit(raw json.RawMessage) (any, error) {
+	p, err := decode[protocol.FSUploadCommitParams](raw)
+	if err != nil {
+		return nil, err
+	}
+	status, err := s.transfers.UploadStatus(p.UploadID, p.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	return journaled(s, p.SessionID, "fs.upload.commit", []string{status.Path}, func() (*fssvc.UploadResult, error) {
+		return s.transfers.CommitUpload(p.UploadID, p.SessionID, strings.ToLower(p.SHA256))
+	})
+}
+
+func (s *Service) fsUploadAbort(raw json.RawMessage) (any, error) {
+	p, err := decode[protocol.FSUploadRefParams](raw)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.transfers.AbortUpload(p.UploadID, p.SessionID); err != nil {
+		return nil, err
+	}
+	return map[string]any{"ok": true}, nil
+}
+
+func (s *Service) fsDownload(raw json.RawMessage) (any, error) {
+	p, err := decode[protocol.FSDownloadParams](raw)
+	if err != nil {
+		return nil, err
+	}
+	abs, err := s.resolveSessionPath(p.SessionID, p.Path)
+	if err != nil {
+		return nil, err
+	}
+	dl, err := s.transfers.StartDownload(p.SessionID, abs, fssvc.DownloadOptions{
+		Offset:    p.Offset,
+		Length:    p.Length,
+		ChunkSize: p.ChunkSize,
+		Window:    p.Window,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{"download_id": dl.ID, "path": abs, "size": dl.Size}, nil
+}
+
+func (s *Service) fsArchive(raw json.RawMessage) (any, error) {
+	p, err := decode[protocol.FSArchiveParams](raw)
+	if err != nil {
+		return nil, err
+	}
+	abs, err := s.resolveSessionPath(p.SessionID, p.Path)
+	if err != nil {
+		return nil, err
+	}
+	return s.transfers.StartArchive(p.SessionID, abs, fssvc.ArchiveOptions{
+		Format:     p.Format,
+		Include:    p.Include,
+		Exclude:    p.Exclude,
+		MaxBytes:   int64(s.cfg.Limits.MaxArchiveBytes),
+		MaxEntries: s.cfg.Limits.MaxArchiveEntries,
+	}, fssvc.DownloadOptions{ChunkSize: p.ChunkSize, Window: p.Window})
+}
+
+func (s *Service) fsExtract(raw json.RawMessage) (any, error) {
+	p, err := decode[protocol.FSExtractParams](raw)
+	if err != nil {
+		return nil, err
+	}
+	if p.Path == "" || p.Dest == "" {
+		return nil, errors.New("path and dest are required")
+	}
+	if p.Format != "" && !fssvc.ValidArchiveFormat(p.Format) {
+		return nil, fmt.Errorf("unsupported archive format %q", p.Format)
+	}
+	if p.StripComponents < 0 {
+		return nil, errors.New("strip_components must not be negative")
+	}
+	archive, dest, err := s.resolveSessionPaths(p.SessionID, p.Path, p.Dest)
+	if err != nil {
+		return nil, err
+	}
+	maxBytes, maxEntries := int64(s.cfg.Limits.MaxArchiveBytes), s.cfg.Limits.MaxArchiveEntries
+	if p.MaxBytes > 0 && (maxBytes <= 0 || p.MaxBytes < maxBytes) {
+		maxBytes = p.MaxBytes
+	}
+	if p.MaxEntries > 0 && (maxEntries <= 0 || p.MaxEntries < maxEntries) {
+		maxEntries = p.MaxEntries
+	}
+	return journaled(s, p.SessionID, "fs.extract", []string{dest}, func() (*fssvc.ExtractResult, error) {
+		return s.fs.Extract(archive, dest, fssvc.ExtractOptions{
+			Format:          p.Format,
+			Overwrite:       p.Overwrite,
+			StripComponents: p.StripComponents,
+			MaxBytes:        maxBytes,
+			MaxEntries:      maxEntries,
+		})
+	})
+}
+
+func (s *Service) fsDownloadAck(raw json.RawMessage) (any, error) {
+	p, err := decode[protocol.FSDownloadAckParams](raw)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.transfers.AckDownload(p.DownloadID, p.SessionID, p.Seq); err != nil {
+		return nil, err
+	}
+	return map[string]any{"ok": true}, nil
+}
+
+func (s *Service) fsDownloadCancel(raw json.RawMessage) (any, error) {
+	p, err := decode[protocol.FSDownloadCancelParams](raw)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.transfers.CancelDownload(p.DownloadID, p.SessionID); err != nil {
+		return nil, err
+	}
+	return map[string]any{"ok": true}, nil
+}
+
+func (s *Service) fsList(raw json.RawMessage) (any, error) {
+	p, err := decode[protocol.FSListParams](raw)
+	if err != nil {
+		return nil, err
+	}
+	abs, err := s.resolveSessionPath(p.SessionID, p.Path)
 	if err != nil {
 		return nil, err
 	}
 	return s.fs.List(abs, p.Recursive, p.MaxEntries)
 }
 
-func (s *Service) fsGlob(raw json.RawMessage) (any, error) {
-	p, err := decode[protocol.FSGlobParams](raw)
+func (s *Service) fsGlob(raw json.RawMessage) (any, error) {
+	p, err := decode[protocol.FSGlobParams](raw)
+	if err != nil {
+		return nil, err
+	}
+	sess, err := s.sessions.Get(p.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	cwd := sess.CWD
+	if p.Cwd != "" {
+		cwd, err = s.policy.ResolveSessionPath(sess.ID, sess.CWD, p.Cwd)
+		if err != nil {
+			return nil, err
+		}
+	}
+	patterns := p.Patterns
+	if p.Pattern != "" {
+		patterns = append([]string{p.Pattern}, patterns...)
+	}
+	if len(patterns) == 0 {
+		return nil, errors.New("pattern is required")
+	}
+	roots := []string{}
+	for i, pattern := range patterns {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(cwd, pattern)
+		}
+		patterns[i] = pattern
+		for _, expanded := range fssvc.ExpandBraces(filepath.ToSlash(pattern)) {
+			bases, err := s.globRoots(sess.ID, fssvc.GlobBase(expanded))
+			if err != nil {
+				return nil, err
+			}
+			roots = append(roots, bases...)
+		}
+	}
+	return s.fs.Glob(dedupeRoots(roots), fssvc.GlobOptions{
+		Cwd:        cwd,
+		Patterns:   patterns,
+		Exclude:    p.Exclude,
+		Ignore:     p.Ignore,
+		Sort:       p.Sort,
+		MaxMatches: p.MaxMatches,
+	})
+}
+
+func (s *Service) globRoots(sessionID, base string) ([]string, error) {
+	if _, err := s.policy.ResolveSessionPath(sessionID, base, base); err == nil {
+		return []string{base}, nil
+	}
+	roots := []string{}
+	for _, root := range s.policy.RootsFor(sessionID) {
+		rel, err := filepath.Rel(base, root)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, "../") {
+			roots = append(roots, root)
+		}
+	}
+	if len(roots) == 0 {
+		return nil, policy.ErrForbiddenPath
+	}
+	return roots, nil
+}
+
+func dedupeRoots(roots []string) []string {
+	sort.Strings(roots)
+	out := []string{}
+	for _, root := range roots {
+		if len(out) > 0 {
+			last := out[len(out)-1]
+			if root == last || strings.HasPrefix(root, strings.TrimSuffix(last, "/")+"/") {
+				continue
+			}
+		}
+		out = append(out, root)
+	}
+	return out
+}
+
+func (s *Service) fsSearch(raw json.RawMessage) (any, error) {
+	p, err := decode[protocol.FSSearchParams](raw)
+	if err != nil {
+		return nil, err
+	}
+	target := p.Path
+	if target == "" {
+		target = "."
+	}
+	abs, err := s.resolveSessionPath(p.SessionID, target)
+	if err != nil {
+		return nil, err
+	}
+	before, after := p.Before, p.After
+	if p.Context > 0 {
+		before, after = max(before, p.Context), max(after, p.Context)
+	}
+	return s.fs.Search(abs, fssvc.SearchOptions{
+		Pattern:       p.Pattern,
+		Literal:       p.Literal,
+		IgnoreCase:    p.IgnoreCase,
+		SmartCase:     p.SmartCase,
+		Include:       p.Include,
+		Exclude:       p.Exclude,
+		NoIgnore:      p.NoIgnore,
+		Hidden:        p.Hidden,
+		ContextBefore: before,
+		ContextAfter:  after,
+		MaxMatches:    p.MaxMatches,
+		MaxBytes:      p.MaxBytes,
+		MaxFileBytes:  p.MaxFileBytes,
+	})
+}
+
+func (s *Service) fsWatch(raw json.RawMessage) (any, error) {
+	p, err := decode[protocol.FSWatchParams](raw)
+	if err != nil {
+		return nil, err
+	}
+	target := p.Path
+	if target == "" {
+		target = "."
+	}
+	abs, err := s.resolveSessionPath(p.SessionID, target)
+	if err != nil {
+		return nil, err
+	}
+	recursive := true
+	if p.Recursive != nil {
+		recursive = *p.Recursive
+	}
+	w, err := s.watches.Watch(p.SessionID, abs, fssvc.WatchOptions{
+		Recursive: recursive,
+		Include:   p.Include,
+		Exclude:   p.Exclude,
+		Debounce:  time.Duration(p.DebounceMS) * time.Millisecond,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{"watch_id": w.ID, "path": abs, "recursive": recursive}, nil
+}
+
+func (s *Service) fsUnwatch(raw json.RawMessage) (any, error) {
+	p, err := decode[protocol.FSUnwatchParams](raw)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.watches.Unwatch(p.WatchID, p.SessionID); err != nil {
+		return nil, err
+	}
+	return map[string]any{"ok": true}, nil
+}
+
+func (s *Service) fsStat(raw json.RawMessage) (any, error) {
+	p, err := decode[protocol.FSStatParams](raw)
+	if err != nil {
+		return nil, err
+	}
+	abs, err := s.resolveSessionPath(p.SessionID, p.Path)
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.fs.Stat(abs)
+	if err != nil {
+		return nil, err
+	}
+	return s.withHash(result, abs, p.Hash)
+}
+
+func (s *Service) fsChmod(raw json.RawMessage) (any, error) {
+	p, err := decode[protocol.FSChmodParams](raw)
+	if err != nil {
+		return nil, err
+	}
+	if p.Perm == "" {
+		return nil, errors.New("perm is required")
+	}
+	perm, err := fssvc.ParsePerm(p.Perm)
+	if err != nil {
+		return nil, err
+	}
+	abs, err := s.resolveSessionWritePath(p.SessionID, p.Path)
+	if err != nil {
+		return nil, err
+	}
+	return journaled(s, p.SessionID, "fs.chmod", []string{abs}, func() (map[string]any, error) {
+		return s.fs.Chmod(abs, perm, p.ExpectedMTime)
+	})
+}
+
+func (s *Service) fsHash(raw json.RawMessage) (any, error) {
+	p, err := decode[protocol.FSHashParams](raw)
+	if err != nil {
+		return nil, err
+	}
+	abs, err := s.resolveSessionPath(p.SessionID, p.Path)
+	if err != nil {
+		return nil, err
+	}
+	return s.fs.Hash(abs, p.Algorithms, p.Offset, p.Length)
+}
+
+func (s *Service) fsEdit(raw json.RawMessage) (any, error) {
+	p, err := decode[protocol.FSEditParams](raw)
+	if err != nil {
+		return nil, err
+	}
+	if p.Path == "" {
+		return nil, errors.New("path is required")
+	}
+	abs, err := s.resolveSessionWritePath(p.SessionID, p.Path)
+	if err != nil {
+		return nil, err
+	}
+	result, err := journaled(s, p.SessionID, "fs.edit", []string{abs}, func() (map[string]any, error) {
+		return s.fs.Edit(abs, p.OldString, p.NewString, p.ReplaceAll, fssvc.Preconditions{MTime: p.ExpectedMTime, SHA256: strings.ToLower(p.ExpectedSHA256)})
+	})
+	if err != nil {
+		return nil, err
+	}
+	lineEnding, _ := result["line_ending"].(string)
+	return protocol.FSEditResult{
+		Path:         abs,
+		BytesWritten: result["bytes_written"].(int),
+		MTime:        result["mtime"].(int64),
+		Created:      result["created"].(bool),
+		Replacements: result["replacements"].(int),
+		TextEncoding: result["text_encoding"].(string),
+		LineEnding:   lineEnding,
+	}, nil
+}
+
+func (s *Service) fsMultiEdit(raw json.RawMessage) (any, error) {
+	p, err := decode[protocol.FSMultiEditParams](raw)
 	if err != nil {
 		return nil, err
 	}
-	sess, err := s.sessions.Get(p.SessionID)
+	if p.Path == "" {
+		return nil, errors.New("path is required")
+	}
+	abs, err := s.resolveSessionWritePath(p.SessionID, p.Path)
 	if err != nil {
 		return nil, err
 	}
-	cwd := sess.CWD
-	if p.Cwd != "" {
-		cwd, err = s.policy.ResolvePath(sess.CWD, p.Cwd)
-		if err != nil {
-			return nil, err
+	edits := make([]fssvc.EditSpec, 0, len(p.Edits))
+	for i, e := range p.Edits {
+		match := e.Match
+		if match == "" {
+			match = p.Match
+		}
+		if !fssvc.ValidMatch(match) {
+			return nil, fmt.Errorf("edit %d: unsupported match %q", i, match)
 		}
+		edits = append(edits, fssvc.EditSpec{OldString: e.OldString, NewString: e.NewString, ReplaceAll: e.ReplaceAll, Match: match})
 	}
-	pattern := p.Pattern
-	if !filepath.IsAbs(pattern) {
-		pattern = filepath.Join(cwd, pattern)
+	return journaled(s, p.SessionID, "fs.multi_edit", []string{abs}, func() (map[string]any, error) {
+		return s.fs.MultiEdit(abs, edits, fssvc.Preconditions{MTime: p.ExpectedMTime, SHA256: strings.ToLower(p.ExpectedSHA256)})
+	})
+}
+
+func journaled[T any](s *Service, sessionID, method string, paths []string, mutate func() (T, error)) (T, error) {
+	rec := s.journal.Capture(paths...)
+	out, err := mutate()
+	if err != nil {
+		return out, err
 	}
-	matches, err := s.fs.Glob(pattern, p.MaxMatches)
+	s.journal.Record(sessionID, method, rec)
+	return out, nil
+}
+
+func (s *Service) fsCheckpoint(raw json.RawMessage) (any, error) {
+	p, err := decode[protocol.FSCheckpointParams](raw)
 	if err != nil {
 		return nil, err
 	}
-	filtered := make([]string, 0, len(matches))
-	for _, m := range matches {
-		if s.policy.IsAllowed(m) {
-			filtered = append(filtered, m)
-		}
+	if _, err := s.sessions.Get(p.SessionID); err != nil {
+		return nil, err
 	}
-	return map[string]any{"matches": filtered}, nil
+	return s.journal.Checkpoint(p.SessionID, p.Name)
 }
 
-func (s *Service) fsStat(raw json.RawMessage) (any, error) {
-	p, err := decode[protocol.FSStatParams](raw)
+func (s *Service) fsHistory(raw json.RawMessage) (any, error) {
+	p, err := decode[protocol.FSHistoryParams](raw)
 	if err != nil {
 		return nil, err
 	}
-	abs, err := s.resolveSessionPath(p.SessionID, p.Path)
+	if _, err := s.sessions.Get(p.SessionID); err != nil {
+		return nil, err
+	}
+	return s.journal.History(p.SessionID, p.Limit)
+}
+
+func (s *Service) fsUndo(raw json.RawMessage) (any, error) {
+	p, err := decode[protocol.FSUndoParams](raw)
 	if err != nil {
 		return nil, err
 	}
-	return s.fs.Stat(abs)
+	if _, err := s.sessions.Get(p.SessionID); err != nil {
+		return nil, err
+	}
+	if p.Checkpoint != "" && p.Steps != 0 {
+		return nil, errors.New("checkpoint and steps are mutually exclusive")
+	}
+	if p.Steps < 0 {
+		return nil, errors.New("steps must be positive")
+	}
+	check := func(path string) error {
+		_, err := s.policy.ResolveSessionWritePath(p.SessionID, "", path)
+		return err
+	}
+	return s.journal.Undo(p.SessionID, fssvc.UndoOptions{Checkpoint: p.Checkpoint, Steps: p.Steps, Force: p.Force, Check: check})
 }
 
-func (s *Service) fsEdit(raw json.RawMessage) (any, error) {
-	p, err := decode[protocol.FSEditParams](raw)
+func (s *Service) fsDiff(raw json.RawMessage) (any, error) {
+	p, err := decode[protocol.FSDiffParams](raw)
 	if err != nil {
 		return nil, err
 	}
 	if p.Path == "" {
 		return nil, errors.New("path is required")
 	}
+	if (p.OtherPath == "") == (p.Content == nil) {
+		return nil, errors.New("exactly one of other_path or content is required")
+	}
+	opts := fssvc.DiffOptions{Context: fssvc.DefaultDiffContext, IgnoreWhitespace: p.IgnoreWhitespace, MaxBytes: p.MaxBytes}
+	switch p.Format {
+	case "", "unified":
+	case "word":
+		opts.Word = true
+	default:
+		return nil, fmt.Errorf("unsupported diff format %q", p.Format)
+	}
+	if p.Context != nil {
+		if *p.Context < 0 {
+			return nil, errors.New("context must not be negative")
+		}
+		opts.Context = *p.Context
+	}
 	abs, err := s.resolveSessionPath(p.SessionID, p.Path)
 	if err != nil {
 		return nil, err
 	}
-	result, err := s.fs.Edit(abs, p.OldString, p.NewString, p.ReplaceAll, p.ExpectedMTime)
+	if p.Content != nil {
+		content, err := fssvc.DecodeContent(*p.Content, p.Encoding)
+		if err != nil {
+			return nil, err
+		}
+		return s.fs.DiffContent(abs, content, opts)
+	}
+	other, err := s.resolveSessionPath(p.SessionID, p.OtherPath)
 	if err != nil {
 		return nil, err
 	}
-	return protocol.FSEditResult{
-		Path:         abs,
-		BytesWritten: result["bytes_written"].(int),
-		MTime:        result["mtime"].(int64),
-		Created:      result["created"].(bool),
-		Replacements: result["replacements"].(int),
-	}, nil
+	return s.fs.DiffFiles(abs, other, opts)
 }
 
 func (s *Service) fsPatch(raw json.RawMessage) (any, error) {
@@ -605,94 +1732,60 @@ func (s *Service) fsPatch(raw json.RawMessage) (any, error) {
 
 	cwd := sess.CWD
 	if p.Cwd != "" {
-		cwd, err = s.policy.ResolvePath(sess.CWD, p.Cwd)
+		cwd, err = s.policy.ResolveSessionPath(sess.ID, sess.CWD, p.Cwd)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	hunks, err := fssvc.ParsePatch(p.PatchText)
+	hunks, format, err := fssvc.ParsePatchFormat(p.PatchText, p.Format)
 	if err != nil {
 		return nil, err
 	}
 
-	result := protocol.FSPatchResult{
-		Added:   []string{},
-		Updated: []string{},
-		Deleted: []string{},
-		Moved:   []protocol.FSPatchMove{},
-	}
-
-	for _, hunk := range hunks {
-		absPath, err := s.policy.ResolvePath(cwd, hunk.Path)
+	for path, expected := range p.ExpectedSHA256 {
+		absPath, err := s.policy.ResolveSessionPath(sess.ID, cwd, path)
 		if err != nil {
 			return nil, err
 		}
+		if err := s.fs.CheckSHA256(absPath, strings.ToLower(expected)); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
 
-		switch hunk.Type {
-		case "add":
-			content := hunk.Contents
-			if content != "" && !strings.HasSuffix(content, "\n") {
-				content += "\n"
-			}
-			if _, err := s.fs.Write(absPath, []byte(content), "create", true, false, 0); err != nil {
-				return nil, err
-			}
-			result.Added = append(result.Added, absPath)
-
-		case "delete":
-			if _, err := os.Stat(absPath); err != nil {
-				return nil, err
-			}
-			if err := os.Remove(absPath); err != nil {
-				return nil, err
-			}
-			result.Deleted = append(result.Deleted, absPath)
-
-		case "update":
-			original, err := os.ReadFile(absPath)
-			if err != nil {
-				return nil, err
-			}
-			nextContent := string(original)
-			if len(hunk.Chunks) > 0 {
-				nextContent, err = fssvc.DerivePatchedContent(string(original), hunk.Chunks)
-				if err != nil {
-					return nil, err
-				}
-			}
-
-			if hunk.MovePath != "" {
-				movePath, err := s.policy.ResolvePath(cwd, hunk.MovePath)
-				if err != nil {
-					return nil, err
-				}
-				if _, err := s.fs.Write(movePath, []byte(nextContent), "replace", true, true, 0); err != nil {
-					return nil, err
-				}
-
-				if movePath == absPath {
-					result.Updated = append(result.Updated, absPath)
-					continue
-				}
-
-				if err := os.Remove(absPath); err != nil {
-					return nil, err
-				}
-				result.Moved = append(result.Moved, protocol.FSPatchMove{From: absPath, To: movePath})
-				continue
-			}
-
-			if _, err := s.fs.Write(absPath, []byte(nextContent), "replace", true, true, 0); err != nil {
-				return nil, err
+	plan, err := s.fs.PlanPatch(hunks, func(path string) (string, error) {
+		return s.policy.ResolveSessionWritePath(sess.ID, cwd, path)
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := protocol.FSPatchResult{
+		Added:   plan.Added,
+		Updated: plan.Updated,
+		Deleted: plan.Deleted,
+		Moved:   []protocol.FSPatchMove{},
+		Format:  format,
+		DryRun:  p.DryRun,
+	}
+	for _, m := range plan.Moved {
+		result.Moved = append(result.Moved, protocol.FSPatchMove{From: m.From, To: m.To})
+	}
+	if p.DryRun {
+		result.Files = []protocol.FSPatchFile{}
+		for _, d := range plan.Diffs(fssvc.DiffOptions{Context: fssvc.DefaultDiffContext}) {
+			file := protocol.FSPatchFile{Path: d.Path, Status: d.Status, Diff: d.Diff, Hunks: []protocol.FSDiffHunk{}}
+			for _, h := range d.Hunks {
+				file.Hunks = append(file.Hunks, protocol.FSDiffHunk(h))
 			}
-			result.Updated = append(result.Updated, absPath)
-
-		default:
-			return nil, fmt.Errorf("unsupported patch hunk type %q", hunk.Type)
+			result.Files = append(result.Files, file)
 		}
+		return result, nil
 	}
-
+	rec := s.journal.Capture(plan.Paths()...)
+	if err := s.fs.CommitPatch(plan); err != nil {
+		return nil, err
+	}
+	s.journal.Record(p.SessionID, "fs.patch", rec)
 	return result, nil
 }
 
@@ -707,7 +1800,7 @@ func (s *Service) ptyOpen(ctx context.Context, raw json.RawMessage) (any, error)
 	}
 	cwd := sess.CWD
 	if p.Cwd != "" {
-		cwd, err = s.policy.ResolvePath(sess.CWD, p.Cwd)
+		cwd, err = s.policy.ResolveSessionPath(sess.ID, sess.CWD, p.Cwd)
 		if err != nil {
 			return nil, err
 		}
@@ -715,7 +1808,11 @@ func (s *Service) ptyOpen(ctx context.Context, raw json.RawMessage) (any, error)
 	if p.Shell && !s.policy.AllowShell() {
 		return nil, errors.New("shell mode disabled")
 	}
-	ptySession, err := s.pty.Open(ctx, p.SessionID, p.Argv, p.Shell, p.Command, cwd, p.Env, p.Cols, p.Rows)
+	interpreter, err := s.policy.ResolveShell("")
+	if err != nil {
+		return nil, err
+	}
+	ptySession, err := s.pty.Open(ctx, p.SessionID, p.Argv, p.Shell, interpreter, p.Command, cwd, p.Env, p.Cols, p.Rows)
 	if err != nil {
 		return nil, err
 	}
@@ -730,7 +1827,7 @@ func (s *Service) ptyInput(raw json.RawMessage) (any, error) {
 	if err != nil {
 		return nil, err
 	}
-	n, err := s.pty.Input(p.PTYID, p.Data)
+	n, err := s.pty.Input(p.PTYID, p.SessionID, p.Data)
 	if err != nil {
 		return nil, err
 	}
@@ -742,7 +1839,7 @@ func (s *Service) ptyResize(raw json.RawMessage) (any, error) {
 	if err != nil {
 		return nil, err
 	}
-	if err := s.pty.Resize(p.PTYID, p.Cols, p.Rows); err != nil {
+	if err := s.pty.Resize(p.PTYID, p.SessionID, p.Cols, p.Rows); err != nil {
 		return nil, err
 	}
 	return map[string]any{"ok": true}, nil
@@ -753,8 +1850,317 @@ func (s *Service) ptyClose(raw json.RawMessage) (any, error) {
 	if err != nil {
 		return nil, err
 	}
-	if err := s.pty.Close(p.PTYID); err != nil {
+	if err := s.pty.Close(p.PTYID, p.SessionID); err != nil {
+		return nil, err
+	}
+	return map[string]any{"ok": true}, nil
+}
+
+func (s *Service) ptyAttach(raw json.RawMessage) (any, error) {
+	p, err := decode[protocol.PTYAttachParams](raw)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.sessions.Get(p.SessionID); err != nil {
+		return nil, err
+	}
+	ps, err := s.pty.Attach(p.PTYID, p.SessionID, p.Role)
+	if err != nil {
+		return nil, err
+	}
+	role, err := ps.Role(p.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	return protocol.PTYAttachResult{
+		PTYID:        ps.ID,
+		ProcessID:    ps.ProcessID,
+		Role:         role,
+		Owner:        ps.Owner(),
+		Participants: ps.Participants(),
+	}, nil
+}
+
+func (s *Service) ptyDetach(raw json.RawMessage) (any, error) {
+	p, err := decode[protocol.PTYDetachParams](raw)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.pty.Detach(p.PTYID, p.SessionID); err != nil {
 		return nil, err
 	}
 	return map[string]any{"ok": true}, nil
 }
+
+func (s *Service) ptyHandoff(raw json.RawMessage) (any, error) {
+	p, err := decode[protocol.PTYHandoffParams](raw)
+	if err != nil {
+		return nil, err
+	}
+	if p.ToSessionID == "" {
+		return nil, errors.New("to_session_id is required")
+	}
+	ps, err := s.pty.Handoff(p.PTYID, p.SessionID, p.ToSessionID, p.Role)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{
+		"pty_id":       ps.ID,
+		"owner":        ps.Owner(),
+		"participants": ps.Participants(),
+	}, nil
+}
+
+func (s *Service) ptyGrant(raw json.RawMessage) (any, error) {
+	p, err := decode[protocol.PTYGrantParams](raw)
+	if err != nil {
+		return nil, err
+	}
+	if p.ToSessionID == "" {
+		return nil, errors.New("to_session_id is required")
+	}
+	if _, err := s.sessions.Get(p.ToSessionID); err != nil && p.Role != "" {
+		return nil, err
+	}
+	ps, err := s.pty.Grant(p.PTYID, p.SessionID, p.ToSessionID, p.Role)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{
+		"pty_id":       ps.ID,
+		"owner":        ps.Owner(),
+		"participants": ps.Participants(),
+	}, nil
+}
+
+func gitCall[T any](s *Service, ctx context.Context, sessionID, cwd string, paths []string, timeoutMS int, fn func(context.Context, gitsvc.Repo) (T, error)) (T, error) {
+	var zero T
+	sess, err := s.sessions.Get(sessionID)
+	if err != nil {
+		return zero, err
+	}
+	if sess.ProcessCount >= s.cfg.Limits.MaxProcessesPerSess {
+		return zero, session.ErrProcessLimit
+	}
+	dir := sess.CWD
+	if cwd != "" {
+		dir, err = s.policy.ResolveSessionPath(sess.ID, sess.CWD, cwd)
+		if err != nil {
+			return zero, err
+		}
+	}
+	if timeoutMS <= 0 {
+		timeoutMS = s.cfg.Limits.DefaultTimeoutMs
+	}
+	if timeoutMS > s.cfg.Limits.HardTimeoutMs {
+		timeoutMS = s.cfg.Limits.HardTimeoutMs
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeoutMS)*time.Millisecond)
+	defer cancel()
+	if err := s.sessions.IncProcess(sess.ID, s.cfg.Limits.MaxProcessesPerSess); err != nil {
+		return zero, err
+	}
+	defer func() { _ = s.sessions.DecProcess(sess.ID) }()
+	root, err := s.git.Root(ctx, dir)
+	if err != nil {
+		return zero, err
+	}
+	if _, err := s.policy.ResolveSessionPath(sess.ID, dir, root); err != nil {
+		return zero, err
+	}
+	repo := gitsvc.Repo{Root: root}
+	for _, p := range paths {
+		abs, err := s.policy.ResolveSessionPath(sess.ID, dir, p)
+		if err != nil {
+			return zero, err
+		}
+		rel, err := filepath.Rel(root, abs)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+			return zero, fmt.Errorf("%s is outside the repository %s", p, root)
+		}
+		repo.Paths = append(repo.Paths, filepath.ToSlash(rel))
+	}
+	return fn(ctx, repo)
+}
+
+func (s *Service) gitLimits(maxEntries int, maxBytes int64) gitsvc.Limits {
+	limits := gitsvc.Limits{MaxEntries: s.cfg.Git.MaxEntries, MaxBytes: s.cfg.Git.MaxBytes}
+	if maxEntries > 0 && (limits.MaxEntries <= 0 || maxEntries < limits.MaxEntries) {
+		limits.MaxEntries = maxEntries
+	}
+	if maxBytes > 0 && (limits.MaxBytes <= 0 || maxBytes < limits.MaxBytes) {
+		limits.MaxBytes = maxBytes
+	}
+	return limits
+}
+
+func (s *Service) gitStatus(ctx context.Context, raw json.RawMessage) (any, error) {
+	p, err := decode[protocol.GitStatusParams](raw)
+	if err != nil {
+		return nil, err
+	}
+	untracked := p.Untracked == nil || *p.Untracked
+	return gitCall(s, ctx, p.SessionID, p.Cwd, p.Paths, p.TimeoutMS, func(ctx context.Context, repo gitsvc.Repo) (*gitsvc.StatusResult, error) {
+		return s.git.Status(ctx, repo, gitsvc.StatusOptions{
+			Untracked: untracked,
+			Ignored:   p.Ignored,
+			Limits:    s.gitLimits(p.MaxEntries, p.MaxBytes),
+		})
+	})
+}
+
+func (s *Service) gitDiff(ctx context.Context, raw json.RawMessage) (any, error) {
+	p, err := decode[protocol.GitDiffParams](raw)
+	if err != nil {
+		return nil, err
+	}
+	contextLines := fssvc.DefaultDiffContext
+	if p.Context != nil {
+		if *p.Context < 0 {
+			return nil, errors.New("context must not be negative")
+		}
+		contextLines = *p.Context
+	}
+	if p.Staged && p.Target != "" {
+		return nil, errors.New("staged cannot be combined with target")
+	}
+	return gitCall(s, ctx, p.SessionID, p.Cwd, p.Paths, p.TimeoutMS, func(ctx context.Context, repo gitsvc.Repo) (*gitsvc.DiffResult, error) {
+		return s.git.Diff(ctx, repo, gitsvc.DiffOptions{
+			Staged:  p.Staged,
+			Base:    p.Base,
+			Target:  p.Target,
+			Context: contextLines,
+			Limits:  s.gitLimits(p.MaxEntries, p.MaxBytes),
+		})
+	})
+}
+
+func (s *Service) gitLog(ctx context.Context, raw json.RawMessage) (any, error) {
+	p, err := decode[protocol.GitLogParams](raw)
+	if err != nil {
+		return nil, err
+	}
+	if p.Skip < 0 {
+		return nil, errors.New("skip must not be negative")
+	}
+	return gitCall(s, ctx, p.SessionID, p.Cwd, p.Paths, p.TimeoutMS, func(ctx context.Context, repo gitsvc.Repo) (*gitsvc.LogResult, error) {
+		return s.git.Log(ctx, repo, gitsvc.LogOptions{
+			Rev:    p.Rev,
+			Skip:   p.Skip,
+			Limits: s.gitLimits(p.MaxEntries, p.MaxBytes),
+		})
+	})
+}
+
+func (s *Service) gitBlame(ctx context.Context, raw json.RawMessage) (any, error) {
+	p, err := decode[protocol.GitBlameParams](raw)
+	if err != nil {
+		return nil, err
+	}
+	if p.Path == "" {
+		return nil, errors.New("path is required")
+	}
+	if p.StartLine < 0 || p.EndLine < 0 || (p.EndLine > 0 && p.EndLine < p.StartLine) {
+		return nil, errors.New("invalid line range")
+	}
+	return gitCall(s, ctx, p.SessionID, p.Cwd, []string{p.Path}, p.TimeoutMS, func(ctx context.Context, repo gitsvc.Repo) (*gitsvc.BlameResult, error) {
+		return s.git.Blame(ctx, repo, gitsvc.BlameOptions{
+			Rev:       p.Rev,
+			StartLine: p.StartLine,
+			EndLine:   p.EndLine,
+			Limits:    s.gitLimits(p.MaxEntries, p.MaxBytes),
+		})
+	})
+}
+
+func (s *Service) worktreeCreate(ctx context.Context, raw json.RawMessage) (any, error) {
+	p, err := decode[protocol.WorktreeCreateParams](raw)
+	if err != nil {
+		return nil, err
+	}
+	if !s.worktrees.Enabled() {
+		return nil, gitsvc.ErrWorktreesDisabled
+	}
+	wt, err := gitCall(s, ctx, p.SessionID, p.Cwd, nil, p.TimeoutMS, func(ctx context.Context, repo gitsvc.Repo) (*gitsvc.Worktree, error) {
+		if err := s.policy.CheckWritable(repo.Root); err != nil {
+			return nil, err
+		}
+		wt, err := s.worktrees.Create(ctx, p.SessionID, repo.Root, gitsvc.CreateWorktreeOptions{
+			Name:   p.Name,
+			Branch: p.Branch,
+			Base:   p.Base,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := s.policy.AddSessionRoot(p.SessionID, wt.Path, repo.Root); err != nil {
+			_, _ = s.worktrees.Remove(ctx, wt, true, true)
+			return nil, err
+		}
+		return wt, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	_ = s.sessions.AddRoot(p.SessionID, wt.Path)
+	if p.SetCwd == nil || *p.SetCwd {
+		_ = s.sessions.SetCWD(p.SessionID, wt.Path)
+	}
+	sess, err := s.sessions.Get(p.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{"worktree": wt, "cwd": sess.CWD}, nil
+}
+
+func (s *Service) worktreeRemove(ctx context.Context, raw json.RawMessage) (any, error) {
+	p, err := decode[protocol.WorktreeRemoveParams](raw)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.sessions.Get(p.SessionID); err != nil {
+		return nil, err
+	}
+	ref := p.Name
+	if ref == "" {
+		ref = p.Path
+	}
+	if ref == "" {
+		return nil, errors.New("name or path is required")
+	}
+	wt, err := s.worktrees.Find(p.SessionID, ref)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.policy.CheckWritable(wt.Repo); err != nil {
+		return nil, err
+	}
+	timeoutMS := p.TimeoutMS
+	if timeoutMS <= 0 {
+		timeoutMS = s.cfg.Limits.DefaultTimeoutMs
+	}
+	if timeoutMS > s.cfg.Limits.HardTimeoutMs {
+		timeoutMS = s.cfg.Limits.HardTimeoutMs
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeoutMS)*time.Millisecond)
+	defer cancel()
+	result, err := s.worktrees.Remove(ctx, wt, p.Force, p.DeleteBranch)
+	if err != nil {
+		return nil, err
+	}
+	s.policy.RemoveSessionRoots(p.SessionID, wt.Path)
+	_ = s.sessions.RemoveRoot(p.SessionID, wt.Path)
+	s.journal.Prune(p.SessionID, wt.Path)
+	return result, nil
+}
+
+func (s *Service) worktreeList(raw json.RawMessage) (any, error) {
+	p, err := decode[protocol.WorktreeListParams](raw)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.sessions.Get(p.SessionID); err != nil {
+		return nil, err
+	}
+	return map[string]any{"worktrees": s.worktrees.List(p.SessionID)}, nil
+}
@@ -23,15 +23,6 @@ func RunStdio(ctx context.Context, svc *Service, in io.Reader, out io.Writer) er
 			}
 			return err
 		}
-		if req.ID != nil {
-			resp := svc.Handle(ctx, req)
-			if err := enc.Encode(resp); err != nil {
-				return err
-			}
-		} else {
-			_ = svc.Handle(ctx, req)
-		}
-
 		var sid struct {
 			SessionID string `json:"session_id"`
 		}
@@ -47,5 +38,14 @@ func RunStdio(ctx context.Context, svc *Service, in io.Reader, out io.Writer) er
 				}()
 			}
 		}
+
+		if req.ID != nil {
+			resp := svc.Handle(ctx, req)
+			if err := enc.Encode(resp); err != nil {
+				return err
+			}
+		} else {
+			_ = svc.Handle(ctx, req)
+		}
 	}
 }
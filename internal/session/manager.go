@@ -4,11 +4,14 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"errors"
+	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 )
 
 var ErrNotFound = errors.New("session not found")
+var ErrProcessLimit = errors.New("max processes per session reached")
 
 type Session struct {
 	ID             string
@@ -16,6 +19,7 @@ type Session struct {
 	ClientVersion  string
 	WorkspaceRoots []string
 	CWD            string
+	Env            map[string]string
 	CreatedAt      time.Time
 	ProcessCount   int
 }
@@ -87,13 +91,61 @@ func (m *Manager) SetCWD(id, cwd string) error {
 	return nil
 }
 
-func (m *Manager) IncProcess(id string) error {
+func (m *Manager) AddRoot(id, root string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	s, ok := m.sessions[id]
 	if !ok {
 		return ErrNotFound
 	}
+	s.WorkspaceRoots = append(append([]string{}, s.WorkspaceRoots...), root)
+	return nil
+}
+
+func (m *Manager) RemoveRoot(id, root string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	if !ok {
+		return ErrNotFound
+	}
+	roots := []string{}
+	for _, r := range s.WorkspaceRoots {
+		if r != root {
+			roots = append(roots, r)
+		}
+	}
+	s.WorkspaceRoots = roots
+	if s.CWD == root || strings.HasPrefix(s.CWD, root+string(filepath.Separator)) {
+		s.CWD = "/"
+		if len(roots) > 0 {
+			s.CWD = roots[0]
+		}
+	}
+	return nil
+}
+
+func (m *Manager) SetEnv(id string, env map[string]string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	if !ok {
+		return ErrNotFound
+	}
+	s.Env = env
+	return nil
+}
+
+func (m *Manager) IncProcess(id string, max int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if s.ProcessCount >= max {
+		return ErrProcessLimit
+	}
 	s.ProcessCount++
 	return nil
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"net/http"
+	"sync"
 
 	"github.com/gorilla/websocket"
 	"github.com/samiralibabic/rexd/internal/protocol"
@@ -24,6 +25,7 @@ func Handler(handle RequestHandler, subscribe SubscribeFunc) http.HandlerFunc {
 		}
 		defer conn.Close()
 
+		var writeMu sync.Mutex
 		subscriptions := map[string]func(){}
 		defer func() {
 			for _, unsub := range subscriptions {
@@ -40,11 +42,6 @@ func Handler(handle RequestHandler, subscribe SubscribeFunc) http.HandlerFunc {
 			if err := json.Unmarshal(payload, &req); err != nil {
 				return
 			}
-			resp := handle(r.Context(), req)
-			raw, _ := json.Marshal(resp)
-			if err := conn.WriteMessage(websocket.TextMessage, raw); err != nil {
-				return
-			}
 			var sid struct {
 				SessionID string `json:"session_id"`
 			}
@@ -56,11 +53,21 @@ func Handler(handle RequestHandler, subscribe SubscribeFunc) http.HandlerFunc {
 					go func() {
 						for evt := range ch {
 							evtRaw, _ := json.Marshal(evt)
+							writeMu.Lock()
 							_ = conn.WriteMessage(websocket.TextMessage, evtRaw)
+							writeMu.Unlock()
 						}
 					}()
 				}
 			}
+			resp := handle(r.Context(), req)
+			raw, _ := json.Marshal(resp)
+			writeMu.Lock()
+			err = conn.WriteMessage(websocket.TextMessage, raw)
+			writeMu.Unlock()
+			if err != nil {
+				return
+			}
 		}
 	}
 }
@@ -0,0 +1,161 @@
+package integration
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samiralibabic/rexd/internal/config"
+	"github.com/samiralibabic/rexd/internal/server"
+)
+
+type stdioClient struct {
+	t      *testing.T
+	conn   net.Conn
+	enc    *json.Encoder
+	dec    *bufio.Reader
+	nextID int
+	events []map[string]any
+}
+
+func newStdioClient(t *testing.T, cfg config.Config) *stdioClient {
+	t.Helper()
+	svc, err := server.NewService(cfg)
+	if err != nil {
+		t.Fatalf("new service: %v", err)
+	}
+	client, srv := net.Pipe()
+	t.Cleanup(func() { _ = client.Close() })
+	go func() {
+		_ = server.RunStdio(context.Background(), svc, srv, srv)
+	}()
+	return &stdioClient{t: t, conn: client, enc: json.NewEncoder(client), dec: bufio.NewReader(client)}
+}
+
+func (c *stdioClient) next(timeout time.Duration) map[string]any {
+	c.t.Helper()
+	_ = c.conn.SetReadDeadline(time.Now().Add(timeout))
+	var msg map[string]any
+	if err := readLine(c.dec, &msg); err != nil {
+		c.t.Fatalf("read message: %v", err)
+	}
+	return msg
+}
+
+func (c *stdioClient) call(method string, params map[string]any) map[string]any {
+	c.t.Helper()
+	c.nextID++
+	id := c.nextID
+	if err := c.enc.Encode(map[string]any{"jsonrpc": "2.0", "id": id, "method": method, "params": params}); err != nil {
+		c.t.Fatalf("encode %s: %v", method, err)
+	}
+	for {
+		msg := c.next(5 * time.Second)
+		if rid, ok := msg["id"].(float64); ok && int(rid) == id {
+			return msg
+		}
+		if _, ok := msg["method"]; ok {
+			c.events = append(c.events, msg)
+		}
+	}
+}
+
+func (c *stdioClient) result(method string, params map[string]any) map[string]any {
+	c.t.Helper()
+	resp := c.call(method, params)
+	if resp["error"] != nil {
+		c.t.Fatalf("%s returned error: %+v", method, resp["error"])
+	}
+	out, _ := resp["result"].(map[string]any)
+	return out
+}
+
+func (c *stdioClient) errorCode(method string, params map[string]any) int {
+	c.t.Helper()
+	resp := c.call(method, params)
+	rpcErr, ok := resp["error"].(map[string]any)
+	if !ok {
+		c.t.Fatalf("%s: expected error, got %+v", method, resp["result"])
+	}
+	return int(rpcErr["code"].(float64))
+}
+
+func (c *stdioClient) waitEvent(method string, match func(params map[string]any) bool) map[string]any {
+	c.t.Helper()
+	for i, evt := range c.events {
+		params, _ := evt["params"].(map[string]any)
+		if evt["method"] == method && (match == nil || match(params)) {
+			c.events = append(c.events[:i], c.events[i+1:]...)
+			return params
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		msg := c.next(time.Until(deadline))
+		if _, ok := msg["method"]; !ok {
+			continue
+		}
+		params, _ := msg["params"].(map[string]any)
+		if msg["method"] == method && (match == nil || match(params)) {
+			return params
+		}
+		c.events = append(c.events, msg)
+	}
+	c.t.Fatalf("timed out waiting for %s", method)
+	return nil
+}
+
+func (c *stdioClient) openSession(root string) string {
+	c.t.Helper()
+	res := c.result("session.open", map[string]any{
+		"client_name":     "test-client",
+		"workspace_roots": []string{root},
+	})
+	return res["session_id"].(string)
+}
+
+func testConfig(root string) config.Config {
+	cfg := config.Default()
+	cfg.Security.AllowedRoot = []config.AllowedRoot{{Path: root}}
+	return cfg
+}
+
+func (c *stdioClient) collectExec(processID string) (string, string, map[string]any) {
+	c.t.Helper()
+	var stdout, stderr strings.Builder
+	handle := func(msg map[string]any) map[string]any {
+		params, _ := msg["params"].(map[string]any)
+		if params == nil || params["process_id"] != processID {
+			return nil
+		}
+		switch msg["method"] {
+		case "exec.stdout":
+			stdout.WriteString(params["data"].(string))
+		case "exec.stderr":
+			stderr.WriteString(params["data"].(string))
+		case "exec.exit":
+			return params
+		}
+		return nil
+	}
+	pending := c.events
+	c.events = nil
+	for _, msg := range pending {
+		if exit := handle(msg); exit != nil {
+			return stdout.String(), stderr.String(), exit
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		msg := c.next(time.Until(deadline))
+		if exit := handle(msg); exit != nil {
+			return stdout.String(), stderr.String(), exit
+		}
+	}
+	c.t.Fatalf("timed out waiting for exec.exit of %s", processID)
+	return "", "", nil
+}
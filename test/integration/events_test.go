@@ -0,0 +1,60 @@
+package integration
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExecEventsCarryGlobalSequenceAndMergedStreams(t *testing.T) {
+	tmp := t.TempDir()
+	c := newStdioClient(t, testConfig(tmp))
+	sessionID := c.openSession(tmp)
+
+	started := c.result("exec.start", map[string]any{
+		"session_id":    sessionID,
+		"argv":          []string{"sh", "-c", "echo one; echo two >&2; echo three"},
+		"cwd":           tmp,
+		"merge_streams": true,
+	})
+	processID := started["process_id"].(string)
+
+	var lastSeq float64
+	var merged string
+	msgs := c.events
+	c.events = nil
+	deadline := time.Now().Add(5 * time.Second)
+	for done := false; !done; {
+		var msg map[string]any
+		if len(msgs) > 0 {
+			msg, msgs = msgs[0], msgs[1:]
+		} else {
+			if time.Now().After(deadline) {
+				t.Fatal("timed out waiting for exec.exit")
+			}
+			msg = c.next(time.Until(deadline))
+		}
+		params, _ := msg["params"].(map[string]any)
+		if params == nil || params["process_id"] != processID {
+			continue
+		}
+		seq, _ := params["event_seq"].(float64)
+		if seq <= lastSeq {
+			t.Fatalf("event_seq not monotonic: %v after %v", seq, lastSeq)
+		}
+		lastSeq = seq
+		if ts, _ := params["ts"].(string); ts == "" {
+			t.Fatalf("missing ts on %v", msg["method"])
+		}
+		switch msg["method"] {
+		case "exec.stdout":
+			merged += params["data"].(string)
+		case "exec.stderr":
+			t.Fatalf("unexpected exec.stderr with merge_streams: %v", params["data"])
+		case "exec.exit":
+			done = true
+		}
+	}
+	if merged != "one\ntwo\nthree\n" {
+		t.Fatalf("expected merged output in write order, got %q", merged)
+	}
+}
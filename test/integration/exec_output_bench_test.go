@@ -0,0 +1,59 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/samiralibabic/rexd/internal/events"
+	execsvc "github.com/samiralibabic/rexd/internal/exec"
+)
+
+func goTestOutput(lines int) []byte {
+	var buf bytes.Buffer
+	for i := 0; i < lines; i++ {
+		fmt.Fprintf(&buf, "=== RUN   TestPackage%d/case_%d\n--- PASS: TestPackage%d/case_%d (0.00s)\n", i/100, i, i/100, i)
+	}
+	return buf.Bytes()
+}
+
+func BenchmarkExecOutputCoalescing(b *testing.B) {
+	output := goTestOutput(10000)
+	cases := []struct {
+		name  string
+		batch execsvc.OutputBatching
+	}{
+		{"per_line", execsvc.OutputBatching{}},
+		{"coalesced", execsvc.OutputBatching{MaxBytes: 32768, FlushInterval: 10 * time.Millisecond}},
+	}
+	for _, tc := range cases {
+		b.Run(tc.name, func(b *testing.B) {
+			var notifications, dropped int64
+			b.SetBytes(int64(len(output)))
+			for i := 0; i < b.N; i++ {
+				bus := events.NewBus()
+				ch, unsub := bus.Subscribe("s_bench")
+				received := make(chan int64)
+				go func() {
+					var n int64
+					for evt := range ch {
+						_, _ = json.Marshal(evt)
+						n++
+					}
+					received <- n
+				}()
+				mgr := execsvc.NewManager(bus, tc.batch)
+				rp := &execsvc.RunningProcess{ID: "p_bench", SessionID: "s_bench"}
+				mgr.WireStreams(rp, bytes.NewReader(output), nil)
+				rp.WaitStreams(time.Minute)
+				unsub()
+				notifications += <-received
+				dropped += bus.Dropped()
+			}
+			b.ReportMetric(float64(notifications)/float64(b.N), "notifications/op")
+			b.ReportMetric(float64(dropped)/float64(b.N), "dropped/op")
+		})
+	}
+}
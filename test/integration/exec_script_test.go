@@ -0,0 +1,80 @@
+package integration
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/samiralibabic/rexd/internal/protocol"
+)
+
+func TestExecScriptRunsWithoutShellModeAndCleansUp(t *testing.T) {
+	tmp := t.TempDir()
+	cfg := testConfig(tmp)
+	cfg.Security.AllowShell = false
+	cfg.Exec.ScriptInterpreters = []string{"sh"}
+	c := newStdioClient(t, cfg)
+	sessionID := c.openSession(tmp)
+
+	started := c.result("exec.script", map[string]any{
+		"session_id":  sessionID,
+		"interpreter": "sh",
+		"script":      "echo \"$0\"\necho \"arg=$1\"\npwd\n",
+		"args":        []string{"one"},
+		"cwd":         tmp,
+	})
+	stdout, _, exit := c.collectExec(started["process_id"].(string))
+	if exit["exit_code"].(float64) != 0 {
+		t.Fatalf("script failed: %+v", exit)
+	}
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if len(lines) != 3 || lines[1] != "arg=one" || lines[2] != tmp {
+		t.Fatalf("unexpected script output: %q", stdout)
+	}
+	if strings.HasPrefix(lines[0], tmp) {
+		t.Fatalf("script file should live outside the workspace, got %s", lines[0])
+	}
+	if _, err := os.Stat(lines[0]); !os.IsNotExist(err) {
+		t.Fatalf("expected script file to be removed, got err=%v", err)
+	}
+
+	code := c.errorCode("exec.script", map[string]any{
+		"session_id":  sessionID,
+		"interpreter": "python3",
+		"script":      "print(1)",
+	})
+	if code != protocol.ErrUnauthorized {
+		t.Fatalf("expected disallowed interpreter to fail with %d, got %d", protocol.ErrUnauthorized, code)
+	}
+}
+
+func TestProcessLimitIsReservedBeforeStart(t *testing.T) {
+	tmp := t.TempDir()
+	cfg := testConfig(tmp)
+	cfg.Limits.MaxProcessesPerSess = 1
+	cfg.Exec.ScriptInterpreters = []string{"sh"}
+	c := newStdioClient(t, cfg)
+	sessionID := c.openSession(tmp)
+
+	marker := tmp + "/ran"
+	started := c.result("exec.start", map[string]any{"session_id": sessionID, "argv": []string{"sleep", "30"}})
+	resp := c.call("exec.script", map[string]any{
+		"session_id":  sessionID,
+		"interpreter": "sh",
+		"script":      "touch " + marker + "\n",
+	})
+	if rpcErr, ok := resp["error"].(map[string]any); !ok || !strings.Contains(rpcErr["message"].(string), "max processes") {
+		t.Fatalf("expected process limit error, got %+v", resp)
+	}
+
+	c.result("exec.kill", map[string]any{"session_id": sessionID, "process_id": started["process_id"]})
+	c.collectExec(started["process_id"].(string))
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Fatalf("expected the rejected script never to run, got err=%v", err)
+	}
+
+	next := c.result("exec.start", map[string]any{"session_id": sessionID, "argv": []string{"true"}})
+	if _, _, exit := c.collectExec(next["process_id"].(string)); exit["exit_code"].(float64) != 0 {
+		t.Fatalf("expected the freed slot to be reusable, got %+v", exit)
+	}
+}
@@ -0,0 +1,147 @@
+package integration
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func (c *stdioClient) collectArchive(res map[string]any) []byte {
+	c.t.Helper()
+	downloadID := res["download_id"]
+	var got bytes.Buffer
+	for {
+		chunk := c.waitEvent("fs.data", func(p map[string]any) bool { return p["download_id"] == downloadID })
+		data, _ := base64.StdEncoding.DecodeString(chunk["data"].(string))
+		got.Write(data)
+		c.result("fs.download.ack", map[string]any{"session_id": chunk["session_id"], "download_id": downloadID, "seq": chunk["seq"]})
+		if chunk["eof"] == true {
+			return got.Bytes()
+		}
+	}
+}
+
+func TestFSArchiveStreamsFilteredTarGz(t *testing.T) {
+	tmp := t.TempDir()
+	writeTree(t, tmp, map[string]string{
+		"build/app.js":            "console.log(1)\n",
+		"build/assets/style.css":  "body{}\n",
+		"build/app.js.map":        "{}\n",
+		"build/node_modules/x.js": "x\n",
+	})
+	c := newStdioClient(t, testConfig(tmp))
+	sessionID := c.openSession(tmp)
+
+	res := c.result("fs.archive", map[string]any{
+		"session_id": sessionID,
+		"path":       "build",
+		"exclude":    []string{"*.map", "node_modules"},
+	})
+	if res["format"] != "tar.gz" || res["entries"] != float64(3) {
+		t.Fatalf("unexpected archive result: %+v", res)
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(c.collectArchive(res)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	names := []string{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, hdr.Name)
+		if hdr.Name == "assets/style.css" {
+			if body, _ := io.ReadAll(tr); string(body) != "body{}\n" {
+				t.Fatalf("unexpected content: %q", body)
+			}
+		}
+	}
+	sort.Strings(names)
+	if strings.Join(names, ",") != "app.js,assets/,assets/style.css" {
+		t.Fatalf("unexpected entries: %v", names)
+	}
+}
+
+func TestFSExtractRoundTripsZip(t *testing.T) {
+	tmp := t.TempDir()
+	writeTree(t, tmp, map[string]string{"src/main.go": "package main\n", "src/pkg/util.go": "package pkg\n"})
+	if err := os.Chmod(filepath.Join(tmp, "src/main.go"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	c := newStdioClient(t, testConfig(tmp))
+	sessionID := c.openSession(tmp)
+
+	data := c.collectArchive(c.result("fs.archive", map[string]any{"session_id": sessionID, "path": "src", "format": "zip"}))
+	if err := os.WriteFile(filepath.Join(tmp, "src.zip"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	res := c.result("fs.extract", map[string]any{"session_id": sessionID, "path": "src.zip", "dest": "copy"})
+	if res["format"] != "zip" || res["files"] != float64(2) {
+		t.Fatalf("unexpected extract result: %+v", res)
+	}
+	if got, _ := os.ReadFile(filepath.Join(tmp, "copy/pkg/util.go")); string(got) != "package pkg\n" {
+		t.Fatalf("unexpected extracted content: %q", got)
+	}
+	if st, err := os.Stat(filepath.Join(tmp, "copy/main.go")); err != nil || st.Mode().Perm() != 0o755 {
+		t.Fatalf("mode not preserved: %v %v", st.Mode(), err)
+	}
+	if code := c.errorCode("fs.extract", map[string]any{"session_id": sessionID, "path": "src.zip", "dest": "copy"}); code != -32006 {
+		t.Fatalf("expected existing files to conflict without overwrite, got %d", code)
+	}
+	if code := c.errorCode("fs.extract", map[string]any{"session_id": sessionID, "path": "src.zip", "dest": "limited", "max_entries": 1}); code != -32602 {
+		t.Fatalf("expected entry limit to reject the archive, got %d", code)
+	}
+	if _, err := os.Stat(filepath.Join(tmp, "limited")); !os.IsNotExist(err) {
+		t.Fatalf("rejected archive must not create the destination: %v", err)
+	}
+}
+
+func TestFSExtractRejectsEscapingEntries(t *testing.T) {
+	tmp := t.TempDir()
+	var slip bytes.Buffer
+	zw := zip.NewWriter(&slip)
+	w, _ := zw.Create("ok.txt")
+	_, _ = w.Write([]byte("ok"))
+	w, _ = zw.Create("../evil.txt")
+	_, _ = w.Write([]byte("evil"))
+	_ = zw.Close()
+
+	var link bytes.Buffer
+	tw := tar.NewWriter(&link)
+	_ = tw.WriteHeader(&tar.Header{Name: "escape", Typeflag: tar.TypeSymlink, Linkname: "../../etc", Mode: 0o777})
+	_ = tw.Close()
+
+	var chained bytes.Buffer
+	tw = tar.NewWriter(&chained)
+	_ = tw.WriteHeader(&tar.Header{Name: "y", Typeflag: tar.TypeSymlink, Linkname: ".", Mode: 0o777})
+	_ = tw.WriteHeader(&tar.Header{Name: "x", Typeflag: tar.TypeSymlink, Linkname: "y/..", Mode: 0o777})
+	_ = tw.Close()
+
+	writeTree(t, tmp, map[string]string{"slip.zip": slip.String(), "link.tar": link.String(), "chained.tar": chained.String()})
+	c := newStdioClient(t, testConfig(tmp))
+	sessionID := c.openSession(tmp)
+
+	for _, name := range []string{"slip.zip", "link.tar", "chained.tar"} {
+		if code := c.errorCode("fs.extract", map[string]any{"session_id": sessionID, "path": name, "dest": "out"}); code != -32602 {
+			t.Fatalf("%s: expected escaping entry to be rejected, got %d", name, code)
+		}
+	}
+	for _, p := range []string{"evil.txt", "out"} {
+		if _, err := os.Lstat(filepath.Join(tmp, p)); !os.IsNotExist(err) {
+			t.Fatalf("%s must not exist after a rejected extract: %v", p, err)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package integration
+
+import (
+	"strings"
+	"testing"
+)
+
+func errorData(t *testing.T, resp map[string]any) map[string]any {
+	t.Helper()
+	rpcErr, ok := resp["error"].(map[string]any)
+	if !ok {
+		t.Fatalf("expected error, got %+v", resp["result"])
+	}
+	data, ok := rpcErr["data"].(map[string]any)
+	if !ok {
+		t.Fatalf("expected error data, got %+v", rpcErr)
+	}
+	return data
+}
+
+func TestFSPatchAndEditFailureDiagnostics(t *testing.T) {
+	tmp := t.TempDir()
+	writeTree(t, tmp, map[string]string{
+		"a.txt": "keep\n",
+		"b.go":  "package b\n\nfunc Sum(a, b int) int {\n\treturn a + b\n}\n\nfunc Sub(a, b int) int {\n\treturn a - b\n}\n",
+	})
+	c := newStdioClient(t, testConfig(tmp))
+	sessionID := c.openSession(tmp)
+
+	data := errorData(t, c.call("fs.patch", map[string]any{
+		"session_id": sessionID,
+		"patch_text": "*** Begin Patch\n*** Update File: a.txt\n@@\n-keep\n+kept\n*** Update File: b.go\n@@\n func Sum(a, b int) int {\n-\treturn a+b\n+\treturn b + a\n }\n*** End Patch",
+	}))
+	if data["reason"] != "not_found" || data["path"] != "b.go" || data["hunk_index"].(float64) != 1 || data["chunk_index"].(float64) != 0 {
+		t.Fatalf("unexpected patch diagnostics: %+v", data)
+	}
+	if expected := data["expected"].([]any); len(expected) != 3 || expected[1] != "\treturn a+b" {
+		t.Fatalf("unexpected expected lines: %+v", data["expected"])
+	}
+	closest := data["closest_match"].(map[string]any)
+	if closest["start_line"].(float64) != 3 || closest["end_line"].(float64) != 5 {
+		t.Fatalf("unexpected closest match: %+v", closest)
+	}
+	if score := closest["similarity"].(float64); score <= 0.5 || score >= 1 {
+		t.Fatalf("unexpected similarity %v", score)
+	}
+	if diff := closest["diff"].(string); !strings.Contains(diff, "-\treturn a+b\n+\treturn a + b\n") {
+		t.Fatalf("unexpected closest diff:\n%s", diff)
+	}
+
+	data = errorData(t, c.call("fs.edit", map[string]any{
+		"session_id": sessionID,
+		"path":       "b.go",
+		"old_string": "int) int {",
+		"new_string": "int) (int, error) {",
+	}))
+	matches := data["matches"].([]any)
+	if data["reason"] != "ambiguous" || len(matches) != 2 {
+		t.Fatalf("unexpected ambiguity diagnostics: %+v", data)
+	}
+	if first, second := matches[0].(map[string]any), matches[1].(map[string]any); first["start_line"].(float64) != 3 || second["start_line"].(float64) != 7 {
+		t.Fatalf("unexpected match locations: %+v", matches)
+	}
+
+	data = errorData(t, c.call("fs.multi_edit", map[string]any{
+		"session_id": sessionID,
+		"path":       "b.go",
+		"edits": []map[string]any{
+			{"old_string": "package b", "new_string": "package c"},
+			{"old_string": "func Sub(x, y int) int {", "new_string": "func Minus(x, y int) int {"},
+		},
+	}))
+	if data["reason"] != "not_found" || data["edit_index"].(float64) != 1 || data["closest_match"].(map[string]any)["start_line"].(float64) != 7 {
+		t.Fatalf("unexpected multi_edit diagnostics: %+v", data)
+	}
+}
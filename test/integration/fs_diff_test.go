@@ -0,0 +1,77 @@
+package integration
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFSDiffBetweenPathsAndContent(t *testing.T) {
+	tmp := t.TempDir()
+	writeTree(t, tmp, map[string]string{
+		"a.txt": "one\ntwo\nthree\nfour\nfive\nsix\nseven\n",
+		"b.txt": "one\ntwo\nTHREE\nfour\nfive\nsix\nseven  \n",
+	})
+	c := newStdioClient(t, testConfig(tmp))
+	sessionID := c.openSession(tmp)
+
+	res := c.result("fs.diff", map[string]any{"session_id": sessionID, "path": "a.txt", "other_path": "b.txt", "context": 1})
+	want := "--- " + filepath.Join(tmp, "a.txt") + "\n+++ " + filepath.Join(tmp, "b.txt") + "\n" +
+		"@@ -2,3 +2,3 @@\n two\n-three\n+THREE\n four\n" +
+		"@@ -6,2 +6,2 @@\n six\n-seven\n+seven  \n"
+	if res["diff"] != want || res["identical"] != false || res["added"] != float64(2) || res["removed"] != float64(2) {
+		t.Fatalf("unexpected diff result: %+v\n%s", res, res["diff"])
+	}
+	hunks := res["hunks"].([]any)
+	if len(hunks) != 2 || hunks[0].(map[string]any)["old_start"] != float64(2) {
+		t.Fatalf("unexpected hunks: %+v", hunks)
+	}
+
+	res = c.result("fs.diff", map[string]any{"session_id": sessionID, "path": "a.txt", "other_path": "b.txt", "ignore_whitespace": true})
+	if hunks := res["hunks"].([]any); len(hunks) != 1 || res["added"] != float64(1) {
+		t.Fatalf("ignore_whitespace should drop the trailing-space change: %+v", res)
+	}
+
+	res = c.result("fs.diff", map[string]any{
+		"session_id": sessionID,
+		"path":       "a.txt",
+		"content":    "one\ntwo\nthree little pigs\nfour\nfive\nsix\nseven\n",
+		"format":     "word",
+	})
+	if res["format"] != "word" || !strings.Contains(res["diff"].(string), "three{+ little pigs+}\n") {
+		t.Fatalf("unexpected word diff:\n%s", res["diff"])
+	}
+
+	res = c.result("fs.diff", map[string]any{"session_id": sessionID, "path": "missing.txt", "content": "new\n"})
+	if !strings.HasPrefix(res["diff"].(string), "--- /dev/null\n") {
+		t.Fatalf("expected diff against a missing file to start from /dev/null:\n%s", res["diff"])
+	}
+
+	res = c.result("fs.diff", map[string]any{"session_id": sessionID, "path": "a.txt", "content": "one\ntwo\nthree\nfour\nfive\nsix\nseven\n"})
+	if res["identical"] != true || res["diff"] != "" {
+		t.Fatalf("expected identical content: %+v", res)
+	}
+
+	if code := c.errorCode("fs.diff", map[string]any{"session_id": sessionID, "path": "a.txt", "other_path": "b.txt", "max_bytes": 10}); code != -32602 {
+		t.Fatalf("expected max_bytes guard to reject the diff, got %d", code)
+	}
+	if code := c.errorCode("fs.diff", map[string]any{"session_id": sessionID, "path": "a.txt"}); code != -32602 {
+		t.Fatalf("expected missing other_path/content to be rejected, got %d", code)
+	}
+}
+
+func TestFSDiffReportsLineEndingChanges(t *testing.T) {
+	tmp := t.TempDir()
+	writeTree(t, tmp, map[string]string{"lf.txt": "one\ntwo\n", "crlf.txt": "one\r\ntwo\r\n"})
+	c := newStdioClient(t, testConfig(tmp))
+	sessionID := c.openSession(tmp)
+
+	res := c.result("fs.diff", map[string]any{"session_id": sessionID, "path": "lf.txt", "other_path": "crlf.txt"})
+	if res["identical"] != false || res["line_endings_differ"] != true || res["old_line_ending"] != "lf" || res["new_line_ending"] != "crlf" {
+		t.Fatalf("expected a line-ending difference: %+v", res)
+	}
+	res = c.result("fs.diff", map[string]any{"session_id": sessionID, "path": "crlf.txt", "content": "one\r\ntwo\r\n"})
+	if res["identical"] != true || res["line_endings_differ"] != false {
+		t.Fatalf("expected identical CRLF content: %+v", res)
+	}
+}
@@ -0,0 +1,119 @@
+package integration
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func globMatches(t *testing.T, res map[string]any) []string {
+	t.Helper()
+	out := []string{}
+	for _, m := range res["matches"].([]any) {
+		out = append(out, m.(string))
+	}
+	return out
+}
+
+func TestFSGlobDoublestarAndFilters(t *testing.T) {
+	tmp := t.TempDir()
+	writeTree(t, tmp, map[string]string{
+		".gitignore":           "dist/\n",
+		"src/index.ts":         "",
+		"src/lib/util.ts":      "",
+		"src/lib/util.test.ts": "",
+		"src/lib/deep/x.tsx":   "",
+		"src/readme.md":        "",
+		"dist/bundle.ts":       "",
+		"node_modules/a/b.ts":  "",
+	})
+	c := newStdioClient(t, testConfig(tmp))
+	sessionID := c.openSession(tmp)
+
+	got := globMatches(t, c.result("fs.glob", map[string]any{
+		"session_id": sessionID,
+		"pattern":    "src/**/*.ts",
+	}))
+	want := []string{
+		filepath.Join(tmp, "src/index.ts"),
+		filepath.Join(tmp, "src/lib/util.test.ts"),
+		filepath.Join(tmp, "src/lib/util.ts"),
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+
+	got = globMatches(t, c.result("fs.glob", map[string]any{
+		"session_id": sessionID,
+		"patterns":   []string{"**/*.{ts,tsx}"},
+		"exclude":    []string{"*.test.ts", "node_modules/**"},
+		"ignore":     true,
+	}))
+	if len(got) != 3 {
+		t.Fatalf("expected 3 matches with exclude and ignore, got %v", got)
+	}
+	for _, m := range got {
+		if filepath.Base(m) == "util.test.ts" || filepath.Base(m) == "bundle.ts" || filepath.Base(m) == "b.ts" {
+			t.Fatalf("unexpected match %s in %v", m, got)
+		}
+	}
+
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(tmp, "src/index.ts"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	res := c.result("fs.glob", map[string]any{
+		"session_id":  sessionID,
+		"pattern":     "src/**/*.ts",
+		"sort":        "mtime",
+		"max_matches": 2,
+	})
+	got = globMatches(t, res)
+	if len(got) != 2 || res["truncated"] != true {
+		t.Fatalf("expected truncated result with 2 matches, got %+v", res)
+	}
+	for _, m := range got {
+		if m == filepath.Join(tmp, "src/index.ts") {
+			t.Fatalf("expected oldest file to sort last, got %v", got)
+		}
+	}
+
+	capped := filepath.Join(tmp, "capped")
+	files := map[string]string{}
+	for _, name := range []string{"e.go", "a/z.go", "a.go", "b/c/d.go", "b.go", "c.go"} {
+		files[name] = "package x\n"
+	}
+	writeTree(t, capped, files)
+	res = c.result("fs.glob", map[string]any{
+		"session_id":  sessionID,
+		"pattern":     "capped/**/*.go",
+		"max_matches": 3,
+	})
+	got = globMatches(t, res)
+	want = []string{filepath.Join(capped, "a.go"), filepath.Join(capped, "a/z.go"), filepath.Join(capped, "b.go")}
+	if strings.Join(got, ",") != strings.Join(want, ",") || res["truncated"] != true {
+		t.Fatalf("expected the first 3 paths and truncation, got %+v", res)
+	}
+	res = c.result("fs.glob", map[string]any{
+		"session_id":  sessionID,
+		"pattern":     "capped/**/*.go",
+		"max_matches": 6,
+	})
+	if got = globMatches(t, res); len(got) != 6 || res["truncated"] != false {
+		t.Fatalf("expected all 6 matches without truncation, got %+v", res)
+	}
+
+	if code := c.errorCode("fs.glob", map[string]any{
+		"session_id": sessionID,
+		"pattern":    "/etc/*.conf",
+	}); code != -32002 {
+		t.Fatalf("expected forbidden error for glob outside roots, got %d", code)
+	}
+}
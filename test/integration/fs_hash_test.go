@@ -0,0 +1,86 @@
+package integration
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestFSHashAndPreconditions(t *testing.T) {
+	tmp := t.TempDir()
+	writeTree(t, tmp, map[string]string{"a.txt": "abc", "b.txt": "one\ntwo\n"})
+	c := newStdioClient(t, testConfig(tmp))
+	sessionID := c.openSession(tmp)
+
+	res := c.result("fs.hash", map[string]any{
+		"session_id": sessionID,
+		"path":       "a.txt",
+		"algorithms": []string{"sha256", "xxhash64"},
+	})
+	if res["sha256"] != sha256Hex("abc") || res["xxhash64"] != "44bc2cf5ad770999" {
+		t.Fatalf("unexpected hashes: %+v", res)
+	}
+	res = c.result("fs.hash", map[string]any{"session_id": sessionID, "path": "a.txt", "offset": 1, "length": 1})
+	if res["sha256"] != sha256Hex("b") || res["length"].(float64) != 1 {
+		t.Fatalf("unexpected range hash: %+v", res)
+	}
+
+	read := c.result("fs.read", map[string]any{"session_id": sessionID, "path": "b.txt", "hash": true})
+	stat := c.result("fs.stat", map[string]any{"session_id": sessionID, "path": "b.txt", "hash": true})
+	if read["sha256"] != sha256Hex("one\ntwo\n") || stat["sha256"] != read["sha256"] {
+		t.Fatalf("expected read and stat hashes to match content: %v %v", read["sha256"], stat["sha256"])
+	}
+
+	if code := c.errorCode("fs.write", map[string]any{
+		"session_id":      sessionID,
+		"path":            "b.txt",
+		"content":         "lost update",
+		"expected_sha256": sha256Hex("stale"),
+	}); code != -32006 {
+		t.Fatalf("expected hash conflict on write, got %d", code)
+	}
+	res = c.result("fs.write", map[string]any{
+		"session_id":      sessionID,
+		"path":            "b.txt",
+		"content":         "one\nthree\n",
+		"expected_sha256": read["sha256"],
+		"hash":            true,
+	})
+	if res["sha256"] != sha256Hex("one\nthree\n") {
+		t.Fatalf("expected write to return new hash, got %+v", res)
+	}
+
+	if code := c.errorCode("fs.edit", map[string]any{
+		"session_id":      sessionID,
+		"path":            "b.txt",
+		"old_string":      "three",
+		"new_string":      "four",
+		"expected_sha256": read["sha256"],
+	}); code != -32006 {
+		t.Fatalf("expected hash conflict on edit, got %d", code)
+	}
+
+	patch := "*** Begin Patch\n*** Update File: b.txt\n@@\n one\n-three\n+four\n*** End Patch"
+	if code := c.errorCode("fs.patch", map[string]any{
+		"session_id":      sessionID,
+		"patch_text":      patch,
+		"expected_sha256": map[string]string{"b.txt": read["sha256"].(string)},
+	}); code != -32006 {
+		t.Fatalf("expected hash conflict on patch, got %d", code)
+	}
+	c.result("fs.patch", map[string]any{
+		"session_id":      sessionID,
+		"patch_text":      patch,
+		"expected_sha256": map[string]string{"b.txt": res["sha256"].(string)},
+	})
+	if data, _ := os.ReadFile(filepath.Join(tmp, "b.txt")); string(data) != "one\nfour\n" {
+		t.Fatalf("unexpected patched content %q", data)
+	}
+}
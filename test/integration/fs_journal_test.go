@@ -0,0 +1,94 @@
+package integration
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFSUndoRevertsToCheckpoint(t *testing.T) {
+	tmp := t.TempDir()
+	writeTree(t, tmp, map[string]string{"a.txt": "alpha\n", "old/keep.txt": "keep\n"})
+	cfg := testConfig(tmp)
+	cfg.Journal.Enabled = true
+	c := newStdioClient(t, cfg)
+	sessionID := c.openSession(tmp)
+
+	c.result("fs.checkpoint", map[string]any{"session_id": sessionID, "name": "start"})
+	c.result("fs.edit", map[string]any{"session_id": sessionID, "path": "a.txt", "old_string": "alpha", "new_string": "ALPHA"})
+	c.result("fs.write", map[string]any{"session_id": sessionID, "path": "new/dir/b.txt", "content": "bravo\n", "mkdir_parents": true})
+	c.result("fs.remove", map[string]any{"session_id": sessionID, "path": "old", "recursive": true})
+	c.result("fs.checkpoint", map[string]any{"session_id": sessionID, "name": "after-remove"})
+	c.result("fs.patch", map[string]any{"session_id": sessionID, "patch_text": "*** Begin Patch\n*** Update File: a.txt\n@@\n-ALPHA\n+AL\n*** End Patch\n"})
+
+	history := c.result("fs.history", map[string]any{"session_id": sessionID})
+	entries := history["entries"].([]any)
+	if len(entries) != 4 || entries[3].(map[string]any)["method"] != "fs.patch" || len(history["checkpoints"].([]any)) != 2 {
+		t.Fatalf("unexpected history: %+v", history)
+	}
+
+	res := c.result("fs.undo", map[string]any{"session_id": sessionID})
+	if got, _ := os.ReadFile(filepath.Join(tmp, "a.txt")); string(got) != "ALPHA\n" || len(res["undone"].([]any)) != 1 {
+		t.Fatalf("single-step undo failed: %q %+v", got, res)
+	}
+
+	res = c.result("fs.undo", map[string]any{"session_id": sessionID, "checkpoint": "start"})
+	if len(res["undone"].([]any)) != 3 {
+		t.Fatalf("expected three mutations undone: %+v", res)
+	}
+	if got, _ := os.ReadFile(filepath.Join(tmp, "a.txt")); string(got) != "alpha\n" {
+		t.Fatalf("a.txt not restored: %q", got)
+	}
+	if got, _ := os.ReadFile(filepath.Join(tmp, "old/keep.txt")); string(got) != "keep\n" {
+		t.Fatalf("removed directory not restored: %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(tmp, "new")); !os.IsNotExist(err) {
+		t.Fatalf("created parent directories should be removed: %v", err)
+	}
+	history = c.result("fs.history", map[string]any{"session_id": sessionID})
+	if len(history["entries"].([]any)) != 0 || len(history["checkpoints"].([]any)) != 1 {
+		t.Fatalf("undo should drop undone entries and later checkpoints: %+v", history)
+	}
+}
+
+func TestFSUndoDetectsExternalChanges(t *testing.T) {
+	tmp := t.TempDir()
+	writeTree(t, tmp, map[string]string{"a.txt": "one\n"})
+	cfg := testConfig(tmp)
+	cfg.Journal.Enabled = true
+	c := newStdioClient(t, cfg)
+	sessionID := c.openSession(tmp)
+
+	c.result("fs.write", map[string]any{"session_id": sessionID, "path": "a.txt", "content": "two\n"})
+	time.Sleep(10 * time.Millisecond)
+	if err := os.WriteFile(filepath.Join(tmp, "a.txt"), []byte("three\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	resp := c.call("fs.undo", map[string]any{"session_id": sessionID})
+	data := errorData(t, resp)
+	if code := resp["error"].(map[string]any)["code"]; code != float64(-32006) {
+		t.Fatalf("expected conflict, got %v", code)
+	}
+	conflicts := data["conflicts"].([]any)
+	if len(conflicts) != 1 || conflicts[0].(map[string]any)["path"] != filepath.Join(tmp, "a.txt") {
+		t.Fatalf("unexpected conflict data: %+v", conflicts)
+	}
+	if got, _ := os.ReadFile(filepath.Join(tmp, "a.txt")); string(got) != "three\n" {
+		t.Fatalf("conflicting undo must not touch the file: %q", got)
+	}
+
+	c.result("fs.undo", map[string]any{"session_id": sessionID, "force": true})
+	if got, _ := os.ReadFile(filepath.Join(tmp, "a.txt")); string(got) != "one\n" {
+		t.Fatalf("forced undo did not restore the file: %q", got)
+	}
+}
+
+func TestFSJournalDisabledByDefault(t *testing.T) {
+	tmp := t.TempDir()
+	c := newStdioClient(t, testConfig(tmp))
+	sessionID := c.openSession(tmp)
+	if code := c.errorCode("fs.undo", map[string]any{"session_id": sessionID}); code != -32602 {
+		t.Fatalf("expected fs.undo to fail without a journal, got %d", code)
+	}
+}
@@ -0,0 +1,88 @@
+package integration
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFSMultiEditAppliesAllOrNothing(t *testing.T) {
+	tmp := t.TempDir()
+	original := "package main\n\nfunc main() {\n    if ready {   \n        run()\n    }\n}\n"
+	writeTree(t, tmp, map[string]string{"main.go": original})
+	target := filepath.Join(tmp, "main.go")
+	c := newStdioClient(t, testConfig(tmp))
+	sessionID := c.openSession(tmp)
+
+	code := c.errorCode("fs.multi_edit", map[string]any{
+		"session_id": sessionID,
+		"path":       "main.go",
+		"edits": []map[string]any{
+			{"old_string": "package main", "new_string": "package app"},
+			{"old_string": "missing()", "new_string": "x()"},
+		},
+	})
+	if code != -32602 {
+		t.Fatalf("expected failing edit to reject the batch, got %d", code)
+	}
+	if got, _ := os.ReadFile(target); string(got) != original {
+		t.Fatalf("failed multi_edit must not modify the file: %q", got)
+	}
+
+	if code := c.errorCode("fs.multi_edit", map[string]any{
+		"session_id": sessionID,
+		"path":       "main.go",
+		"edits":      []map[string]any{{"old_string": "if ready {\n    run()\n}", "new_string": "if ready {\n    start()\n}"}},
+	}); code != -32602 {
+		t.Fatalf("expected exact match to fail on indentation differences, got %d", code)
+	}
+
+	res := c.result("fs.multi_edit", map[string]any{
+		"session_id": sessionID,
+		"path":       "main.go",
+		"edits": []map[string]any{
+			{"old_string": "package main", "new_string": "package app"},
+			{"old_string": "if ready {\n    run()\n}", "new_string": "if ready {\n    start()\n    wait()\n}", "match": "indentation"},
+			{"old_string": "func main() {", "new_string": "func Main() {"},
+		},
+	})
+	want := "package app\n\nfunc Main() {\n    if ready {\n        start()\n        wait()\n    }\n}\n"
+	if got, _ := os.ReadFile(target); string(got) != want {
+		t.Fatalf("unexpected file after multi_edit:\n%s", got)
+	}
+	edits := res["edits"].([]any)
+	if len(edits) != 3 || edits[1].(map[string]any)["match"] != "indentation" || edits[0].(map[string]any)["match"] != "exact" {
+		t.Fatalf("unexpected per-edit results: %+v", edits)
+	}
+	diff := res["diff"].(string)
+	for _, line := range []string{"-package main", "+package app", "-        run()", "+        start()", "+        wait()", "@@ -1,"} {
+		if !strings.Contains(diff, line) {
+			t.Fatalf("diff missing %q:\n%s", line, diff)
+		}
+	}
+	ranges := res["ranges"].([]any)
+	first := ranges[0].(map[string]any)
+	if first["old_start"].(float64) != 1 || first["new_start"].(float64) != 1 || first["new_lines"].(float64) != 1 {
+		t.Fatalf("unexpected first range: %+v", ranges)
+	}
+
+	if code := c.errorCode("fs.multi_edit", map[string]any{
+		"session_id":     sessionID,
+		"path":           "main.go",
+		"expected_mtime": 1,
+		"edits":          []map[string]any{{"old_string": "package app", "new_string": "package main"}},
+	}); code != -32006 {
+		t.Fatalf("expected stale expected_mtime to conflict, got %d", code)
+	}
+
+	c.result("fs.multi_edit", map[string]any{
+		"session_id": sessionID,
+		"path":       "main.go",
+		"match":      "whitespace",
+		"edits":      []map[string]any{{"old_string": "    if ready {   \n", "new_string": "    if ready && ok {\n"}},
+	})
+	if got, _ := os.ReadFile(target); !strings.Contains(string(got), "    if ready && ok {\n        start()") {
+		t.Fatalf("whitespace-insensitive edit not applied:\n%s", got)
+	}
+}
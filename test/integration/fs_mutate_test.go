@@ -0,0 +1,142 @@
+package integration
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFSMutationMethods(t *testing.T) {
+	tmp := t.TempDir()
+	root := filepath.Join(tmp, "ws")
+	writeTree(t, root, map[string]string{
+		"src/a.txt":      "alpha",
+		"src/sub/b.sh":   "#!/bin/sh\n",
+		"notes/todo.txt": "todo",
+		"big/1":          "",
+		"big/2":          "",
+		"big/nested/3":   "",
+		"conflict/c.txt": "c",
+	})
+	if err := os.Chmod(filepath.Join(root, "src/sub/b.sh"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(filepath.Join(root, "src/sub/b.sh"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	auditPath := filepath.Join(tmp, "audit.log")
+	cfg := testConfig(root)
+	cfg.Audit.Enabled = true
+	cfg.Audit.Path = auditPath
+	c := newStdioClient(t, cfg)
+	sessionID := c.openSession(root)
+
+	res := c.result("fs.copy", map[string]any{"session_id": sessionID, "from": "src", "to": "copy", "recursive": true})
+	if res["files"].(float64) != 2 || res["dirs"].(float64) != 2 {
+		t.Fatalf("unexpected copy result: %+v", res)
+	}
+	st, err := os.Stat(filepath.Join(root, "copy/sub/b.sh"))
+	if err != nil || st.Mode().Perm() != 0755 || !st.ModTime().Equal(old) {
+		t.Fatalf("expected mode and mtime to be preserved, got %v %v", st, err)
+	}
+	if code := c.errorCode("fs.copy", map[string]any{"session_id": sessionID, "from": "src/a.txt", "to": "notes/todo.txt"}); code != -32006 {
+		t.Fatalf("expected destination exists error, got %d", code)
+	}
+	c.result("fs.copy", map[string]any{"session_id": sessionID, "from": "src/a.txt", "to": "notes/todo.txt", "overwrite": true})
+	if data, _ := os.ReadFile(filepath.Join(root, "notes/todo.txt")); string(data) != "alpha" {
+		t.Fatalf("expected overwrite, got %q", data)
+	}
+
+	stale := map[string]any{"session_id": sessionID, "from": "src/a.txt", "to": "moved/a.txt", "mkdir_parents": true, "expected_mtime": 1}
+	if code := c.errorCode("fs.move", stale); code != -32006 {
+		t.Fatalf("expected mtime conflict, got %d", code)
+	}
+	stat := c.result("fs.stat", map[string]any{"session_id": sessionID, "path": "src/a.txt"})
+	stale["expected_mtime"] = stat["mtime"]
+	res = c.result("fs.move", stale)
+	if res["to"] != filepath.Join(root, "moved/a.txt") {
+		t.Fatalf("unexpected move result: %+v", res)
+	}
+	if _, err := os.Stat(filepath.Join(root, "src/a.txt")); !os.IsNotExist(err) {
+		t.Fatalf("expected source to be gone, got %v", err)
+	}
+	if code := c.errorCode("fs.move", map[string]any{"session_id": sessionID, "from": "moved/a.txt", "to": "../outside.txt"}); code != -32002 {
+		t.Fatalf("expected forbidden destination, got %d", code)
+	}
+
+	res = c.result("fs.mkdir", map[string]any{"session_id": sessionID, "path": "a/b/c", "parents": true})
+	if res["created"] != true {
+		t.Fatalf("expected mkdir to create, got %+v", res)
+	}
+	if c.errorCode("fs.mkdir", map[string]any{"session_id": sessionID, "path": "a/b/c"}) == 0 {
+		t.Fatalf("expected error creating an existing directory without parents")
+	}
+
+	if c.errorCode("fs.remove", map[string]any{"session_id": sessionID, "path": "big"}) == 0 {
+		t.Fatalf("expected non-recursive remove of a non-empty directory to fail")
+	}
+	if c.errorCode("fs.remove", map[string]any{"session_id": sessionID, "path": "big", "recursive": true, "max_entries": 3}) == 0 {
+		t.Fatalf("expected max_entries cap to refuse removal")
+	}
+	res = c.result("fs.remove", map[string]any{"session_id": sessionID, "path": "big", "recursive": true})
+	if res["removed"].(float64) != 5 {
+		t.Fatalf("expected 5 removed entries, got %+v", res)
+	}
+	if c.errorCode("fs.remove", map[string]any{"session_id": sessionID, "path": ".", "recursive": true}) == 0 {
+		t.Fatalf("expected removing the workspace root to fail")
+	}
+
+	audit, err := os.ReadFile(auditPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`"method":"fs.move"`,
+		`"paths":["` + filepath.Join(root, "src/a.txt") + `","` + filepath.Join(root, "moved/a.txt") + `"]`,
+		`"paths":["` + filepath.Join(root, "big") + `"]`,
+	} {
+		if !strings.Contains(string(audit), want) {
+			t.Fatalf("audit log missing %s:\n%s", want, audit)
+		}
+	}
+}
+
+func TestFSMoveOverwriteReplacesAcrossTypes(t *testing.T) {
+	tmp := t.TempDir()
+	writeTree(t, tmp, map[string]string{
+		"file.txt":      "new file",
+		"dir/keep.txt":  "new dir",
+		"old-dir/x.txt": "old",
+		"old-file.txt":  "old",
+		"a.txt":         "a",
+		"b.txt":         "b",
+	})
+	c := newStdioClient(t, testConfig(tmp))
+	sessionID := c.openSession(tmp)
+
+	c.result("fs.move", map[string]any{"session_id": sessionID, "from": "file.txt", "to": "old-dir", "overwrite": true})
+	if data, err := os.ReadFile(filepath.Join(tmp, "old-dir")); err != nil || string(data) != "new file" {
+		t.Fatalf("expected file to replace directory, got %q, %v", data, err)
+	}
+	c.result("fs.move", map[string]any{"session_id": sessionID, "from": "dir", "to": "old-file.txt", "overwrite": true})
+	if data, err := os.ReadFile(filepath.Join(tmp, "old-file.txt", "keep.txt")); err != nil || string(data) != "new dir" {
+		t.Fatalf("expected directory to replace file, got %q, %v", data, err)
+	}
+	c.result("fs.move", map[string]any{"session_id": sessionID, "from": "a.txt", "to": "b.txt", "overwrite": true})
+	if data, err := os.ReadFile(filepath.Join(tmp, "b.txt")); err != nil || string(data) != "a" {
+		t.Fatalf("expected file to replace file, got %q, %v", data, err)
+	}
+
+	entries, err := os.ReadDir(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if strings.Contains(e.Name(), ".rexd-") {
+			t.Fatalf("expected no leftover aside entries, found %s", e.Name())
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package integration
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFSPatchIsTransactional(t *testing.T) {
+	tmp := t.TempDir()
+	writeTree(t, tmp, map[string]string{
+		"a.txt":   "alpha\nbeta\n",
+		"old.txt": "remove me\n",
+		"b.txt":   "gamma\n",
+	})
+	c := newStdioClient(t, testConfig(tmp))
+	sessionID := c.openSession(tmp)
+
+	failing := "*** Begin Patch\n" +
+		"*** Update File: a.txt\n@@\n-alpha\n+ALPHA\n" +
+		"*** Delete File: old.txt\n" +
+		"*** Add File: new.txt\n+fresh\n" +
+		"*** Update File: b.txt\n@@\n-does not exist\n+x\n" +
+		"*** End Patch"
+	if code := c.errorCode("fs.patch", map[string]any{"session_id": sessionID, "patch_text": failing}); code != -32602 {
+		t.Fatalf("expected failing hunk to reject the patch, got %d", code)
+	}
+	if got, _ := os.ReadFile(filepath.Join(tmp, "a.txt")); string(got) != "alpha\nbeta\n" {
+		t.Fatalf("a.txt changed by failed patch: %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(tmp, "old.txt")); err != nil {
+		t.Fatalf("old.txt deleted by failed patch: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmp, "new.txt")); !os.IsNotExist(err) {
+		t.Fatalf("new.txt created by failed patch: %v", err)
+	}
+
+	patch := "*** Begin Patch\n" +
+		"*** Update File: a.txt\n@@\n-alpha\n+ALPHA\n" +
+		"*** Delete File: old.txt\n" +
+		"*** Add File: new.txt\n+fresh\n" +
+		"*** Update File: b.txt\n*** Move to: moved/b.txt\n@@\n-gamma\n+GAMMA\n" +
+		"*** End Patch"
+	res := c.result("fs.patch", map[string]any{"session_id": sessionID, "patch_text": patch, "dry_run": true})
+	if res["dry_run"] != true {
+		t.Fatalf("expected dry_run in result: %+v", res)
+	}
+	files := map[string]map[string]any{}
+	for _, f := range res["files"].([]any) {
+		entry := f.(map[string]any)
+		files[filepath.Base(entry["path"].(string))+":"+entry["status"].(string)] = entry
+	}
+	if len(files) != 5 || files["a.txt:modified"] == nil || files["old.txt:deleted"] == nil || files["new.txt:added"] == nil || files["b.txt:deleted"] == nil || files["b.txt:added"] == nil {
+		t.Fatalf("unexpected dry-run files: %+v", res["files"])
+	}
+	if diff := files["a.txt:modified"]["diff"].(string); !strings.Contains(diff, "-alpha\n+ALPHA\n") {
+		t.Fatalf("unexpected dry-run diff:\n%s", diff)
+	}
+	if diff := files["new.txt:added"]["diff"].(string); !strings.HasPrefix(diff, "--- /dev/null\n") || !strings.Contains(diff, "+fresh") {
+		t.Fatalf("unexpected add diff:\n%s", diff)
+	}
+	if got, _ := os.ReadFile(filepath.Join(tmp, "a.txt")); string(got) != "alpha\nbeta\n" {
+		t.Fatalf("dry run touched disk: %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(tmp, "moved")); !os.IsNotExist(err) {
+		t.Fatalf("dry run created directories: %v", err)
+	}
+
+	res = c.result("fs.patch", map[string]any{"session_id": sessionID, "patch_text": patch})
+	if res["files"] != nil || len(res["moved"].([]any)) != 1 {
+		t.Fatalf("unexpected patch result: %+v", res)
+	}
+	if got, _ := os.ReadFile(filepath.Join(tmp, "moved", "b.txt")); string(got) != "GAMMA\n" {
+		t.Fatalf("unexpected moved content: %q", got)
+	}
+	for _, gone := range []string{"old.txt", "b.txt"} {
+		if _, err := os.Stat(filepath.Join(tmp, gone)); !os.IsNotExist(err) {
+			t.Fatalf("%s should be gone: %v", gone, err)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package integration
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFSPatchAcceptsGitDiff(t *testing.T) {
+	tmp := t.TempDir()
+	writeTree(t, tmp, map[string]string{
+		"main.go":   "package main\n\n// extra line added after the diff was made\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(\"hi\")\n}\n",
+		"old.txt":   "one\ntwo\nthree\n",
+		"gone.txt":  "bye\n",
+		"run.sh":    "echo run\n",
+		"noeol.txt": "first\nlast",
+	})
+	c := newStdioClient(t, testConfig(tmp))
+	sessionID := c.openSession(tmp)
+
+	patch := `diff --git a/main.go b/main.go
+index 1111111..2222222 100644
+--- a/main.go
++++ b/main.go
+@@ -4,4 +4,4 @@ import "fmt"
+ 
+ func main() {
+-	fmt.Println("hi")
++	fmt.Println("hello")
+ }
+diff --git a/old.txt b/new.txt
+similarity index 80%
+rename from old.txt
+rename to new.txt
+--- a/old.txt
++++ b/new.txt
+@@ -1,3 +1,3 @@
+ one
+-two
++TWO
+ three
+diff --git a/gone.txt b/gone.txt
+deleted file mode 100644
+--- a/gone.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-bye
+diff --git a/run.sh b/run.sh
+old mode 100644
+new mode 100755
+diff --git a/added.txt b/added.txt
+new file mode 100755
+--- /dev/null
++++ b/added.txt
+@@ -0,0 +1,2 @@
++#!/bin/sh
++exit 0
+\ No newline at end of file
+diff --git a/noeol.txt b/noeol.txt
+--- a/noeol.txt
++++ b/noeol.txt
+@@ -1,2 +1,2 @@
+ first
+-last
+\ No newline at end of file
++LAST
+`
+	res := c.result("fs.patch", map[string]any{"session_id": sessionID, "patch_text": patch})
+	if res["format"] != "git" {
+		t.Fatalf("expected git format to be detected, got %+v", res)
+	}
+	expect := map[string]string{
+		"main.go":   "package main\n\n// extra line added after the diff was made\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(\"hello\")\n}\n",
+		"new.txt":   "one\nTWO\nthree\n",
+		"run.sh":    "echo run\n",
+		"added.txt": "#!/bin/sh\nexit 0",
+		"noeol.txt": "first\nLAST\n",
+	}
+	for name, want := range expect {
+		got, err := os.ReadFile(filepath.Join(tmp, name))
+		if err != nil || string(got) != want {
+			t.Fatalf("%s = %q (%v), want %q", name, got, err, want)
+		}
+	}
+	for _, name := range []string{"old.txt", "gone.txt"} {
+		if _, err := os.Stat(filepath.Join(tmp, name)); !os.IsNotExist(err) {
+			t.Fatalf("%s should have been removed: %v", name, err)
+		}
+	}
+	for _, name := range []string{"run.sh", "added.txt"} {
+		st, err := os.Stat(filepath.Join(tmp, name))
+		if err != nil || st.Mode().Perm() != 0o755 {
+			t.Fatalf("%s should be executable: %v %v", name, st.Mode(), err)
+		}
+	}
+}
+
+func TestFSPatchAcceptsPlainUnifiedDiffWithFuzz(t *testing.T) {
+	tmp := t.TempDir()
+	writeTree(t, tmp, map[string]string{"conf.ini": "[a]\nkey=1\nname=x\nport=80\n[b]\nother=2\n"})
+	c := newStdioClient(t, testConfig(tmp))
+	sessionID := c.openSession(tmp)
+
+	patch := "--- conf.ini.orig\t2026-01-01 00:00:00\n" +
+		"+++ conf.ini\t2026-01-02 00:00:00\n" +
+		"@@ -1,5 +1,5 @@\n" +
+		" [a]\n" +
+		" key=changed-locally\n" +
+		"-name=x\n" +
+		"+name=y\n" +
+		" port=80\n" +
+		" [b]\n"
+	if code := c.errorCode("fs.patch", map[string]any{"session_id": sessionID, "patch_text": patch, "format": "rexd"}); code != -32602 {
+		t.Fatalf("expected explicit rexd format to reject a unified diff, got %d", code)
+	}
+	res := c.result("fs.patch", map[string]any{"session_id": sessionID, "patch_text": patch})
+	if res["format"] != "unified" {
+		t.Fatalf("expected unified format, got %+v", res)
+	}
+	if got, _ := os.ReadFile(filepath.Join(tmp, "conf.ini")); string(got) != "[a]\nkey=1\nname=y\nport=80\n[b]\nother=2\n" {
+		t.Fatalf("fuzzy hunk not applied: %q", got)
+	}
+}
@@ -0,0 +1,64 @@
+package integration
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFSWritePreservesMetadata(t *testing.T) {
+	tmp := t.TempDir()
+	writeTree(t, tmp, map[string]string{"run.sh": "#!/bin/sh\necho old\n"})
+	script := filepath.Join(tmp, "run.sh")
+	if err := os.Chmod(script, 0750); err != nil {
+		t.Fatal(err)
+	}
+	before, _ := os.Stat(script)
+	c := newStdioClient(t, testConfig(tmp))
+	sessionID := c.openSession(tmp)
+
+	c.result("fs.edit", map[string]any{"session_id": sessionID, "path": "run.sh", "old_string": "old", "new_string": "new"})
+	after, err := os.Stat(script)
+	if err != nil || after.Mode().Perm() != 0750 {
+		t.Fatalf("expected edit to preserve mode 0750, got %v %v", after.Mode(), err)
+	}
+	if os.SameFile(before, after) {
+		t.Fatalf("expected atomic replace to swap in a new inode")
+	}
+
+	c.result("fs.write", map[string]any{"session_id": sessionID, "path": "secret.env", "content": "TOKEN=1\n", "perm": "0600"})
+	if st, _ := os.Stat(filepath.Join(tmp, "secret.env")); st.Mode().Perm() != 0600 {
+		t.Fatalf("expected perm 0600, got %v", st.Mode())
+	}
+	if c.errorCode("fs.write", map[string]any{"session_id": sessionID, "path": "secret.env", "content": "x", "mode": "create"}) == 0 {
+		t.Fatalf("expected create mode to refuse an existing file")
+	}
+
+	res := c.result("fs.chmod", map[string]any{"session_id": sessionID, "path": "secret.env", "perm": "640"})
+	if res["perm"] != "0640" {
+		t.Fatalf("unexpected chmod result: %+v", res)
+	}
+	if c.errorCode("fs.chmod", map[string]any{"session_id": sessionID, "path": "secret.env", "perm": "rwx"}) == 0 {
+		t.Fatalf("expected invalid perm to be rejected")
+	}
+
+	stat := c.result("fs.stat", map[string]any{"session_id": sessionID, "path": "run.sh"})
+	if stat["perm"] != "0750" || stat["uid"] == nil || stat["gid"] == nil || stat["inode"] == nil {
+		t.Fatalf("expected perm, uid, gid and inode in stat: %+v", stat)
+	}
+	list := c.result("fs.list", map[string]any{"session_id": sessionID, "path": "."})
+	for _, e := range list["entries"].([]any) {
+		entry := e.(map[string]any)
+		if entry["name"] == "secret.env" && entry["perm"] != "0640" {
+			t.Fatalf("expected list perm 0640, got %+v", entry)
+		}
+	}
+
+	entries, _ := os.ReadDir(tmp)
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".tmp") {
+			t.Fatalf("temp file left behind: %s", e.Name())
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package integration
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/samiralibabic/rexd/internal/config"
+)
+
+func TestFSDenyRulesHideSecrets(t *testing.T) {
+	tmp := t.TempDir()
+	writeTree(t, tmp, map[string]string{
+		".env":             "TOKEN=secret\n",
+		"certs/server.pem": "TOKEN=secret\n",
+		"private/notes.md": "TOKEN=secret\n",
+		"src/main.go":      "// TOKEN=public\n",
+	})
+	if err := os.Symlink(".env", filepath.Join(tmp, "env-link")); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.Default()
+	cfg.Security.Deny = []string{".env", "*.pem"}
+	cfg.Security.AllowedRoot = []config.AllowedRoot{{Path: tmp, Deny: []string{"private"}}}
+	c := newStdioClient(t, cfg)
+	sessionID := c.openSession(tmp)
+
+	resp := c.call("fs.read", map[string]any{"session_id": sessionID, "path": ".env"})
+	data := errorData(t, resp)
+	if code := resp["error"].(map[string]any)["code"]; code != float64(-32009) || data["reason"] != "deny" || data["rule"] != ".env" {
+		t.Fatalf("expected deny error, got %v %+v", code, data)
+	}
+	for _, p := range []string{"env-link", "private/notes.md", "certs/server.pem"} {
+		if code := c.errorCode("fs.read", map[string]any{"session_id": sessionID, "path": p}); code != -32009 {
+			t.Fatalf("%s: expected -32009, got %d", p, code)
+		}
+	}
+	if code := c.errorCode("fs.write", map[string]any{"session_id": sessionID, "path": "sub/.env", "content": "x", "mkdir_parents": true}); code != -32009 {
+		t.Fatalf("expected write to a denied path to fail, got %d", code)
+	}
+	if code := c.errorCode("exec.start", map[string]any{"session_id": sessionID, "argv": []string{"true"}, "cwd": "private"}); code != -32009 {
+		t.Fatalf("expected denied cwd to fail, got %d", code)
+	}
+
+	list := c.result("fs.list", map[string]any{"session_id": sessionID, "path": ".", "recursive": true})
+	for _, e := range list["entries"].([]any) {
+		name := e.(map[string]any)["path"].(string)
+		if strings.HasSuffix(name, ".env") || strings.HasSuffix(name, ".pem") || strings.Contains(name, "private") {
+			t.Fatalf("denied entry listed: %s", name)
+		}
+	}
+	glob := c.result("fs.glob", map[string]any{"session_id": sessionID, "pattern": "**/*"})
+	for _, m := range glob["matches"].([]any) {
+		if strings.Contains(m.(string), "private") || strings.HasSuffix(m.(string), ".pem") {
+			t.Fatalf("denied path globbed: %s", m)
+		}
+	}
+	search := c.result("fs.search", map[string]any{"session_id": sessionID, "pattern": "TOKEN", "hidden": true})
+	matches := search["matches"].([]any)
+	if len(matches) != 1 || matches[0].(map[string]any)["path"] != filepath.Join(tmp, "src/main.go") {
+		t.Fatalf("search should only see public files: %+v", matches)
+	}
+}
+
+func TestFSReadOnlyRoots(t *testing.T) {
+	tmp := t.TempDir()
+	writeTree(t, tmp, map[string]string{"vendor/lib.go": "package lib\n", "app/main.go": "package main\n"})
+	cfg := config.Default()
+	cfg.Security.AllowedRoot = []config.AllowedRoot{
+		{Path: filepath.Join(tmp, "app")},
+		{Path: filepath.Join(tmp, "vendor"), Mode: "ro"},
+	}
+	c := newStdioClient(t, cfg)
+	sessionID := c.openSession(filepath.Join(tmp, "app"))
+	lib := filepath.Join(tmp, "vendor/lib.go")
+
+	if res := c.result("fs.read", map[string]any{"session_id": sessionID, "path": lib}); res["content"] != "package lib\n" {
+		t.Fatalf("read-only root should stay readable: %+v", res)
+	}
+	resp := c.call("fs.write", map[string]any{"session_id": sessionID, "path": lib, "content": "changed\n"})
+	if data := errorData(t, resp); data["reason"] != "read_only" || resp["error"].(map[string]any)["code"] != float64(-32009) {
+		t.Fatalf("expected read-only error, got %+v", resp["error"])
+	}
+	for _, call := range []struct {
+		method string
+		params map[string]any
+	}{
+		{"fs.mkdir", map[string]any{"path": filepath.Join(tmp, "vendor/new")}},
+		{"fs.remove", map[string]any{"path": lib}},
+		{"fs.move", map[string]any{"from": lib, "to": "lib.go"}},
+		{"fs.edit", map[string]any{"path": lib, "old_string": "lib", "new_string": "x"}},
+	} {
+		call.params["session_id"] = sessionID
+		if code := c.errorCode(call.method, call.params); code != -32009 {
+			t.Fatalf("%s: expected -32009, got %d", call.method, code)
+		}
+	}
+	c.result("fs.copy", map[string]any{"session_id": sessionID, "from": lib, "to": "lib.go"})
+	if got, _ := os.ReadFile(lib); string(got) != "package lib\n" {
+		t.Fatalf("read-only file changed: %q", got)
+	}
+	if got, _ := os.ReadFile(filepath.Join(tmp, "app/lib.go")); string(got) != "package lib\n" {
+		t.Fatalf("copy out of a read-only root failed: %q", got)
+	}
+}
+
+func TestFSTreeOperationsRespectDeniedAndReadOnlyDescendants(t *testing.T) {
+	tmp := t.TempDir()
+	writeTree(t, tmp, map[string]string{
+		"app/config/secrets/key":  "secret\n",
+		"app/config/settings.ini": "a=1\n",
+		"app/vendor/lib.go":       "package lib\n",
+		"app/tmp/scratch.txt":     "x\n",
+	})
+	cfg := config.Default()
+	cfg.Security.AllowedRoot = []config.AllowedRoot{
+		{Path: tmp, Deny: []string{"app/config/secrets"}},
+		{Path: filepath.Join(tmp, "app/vendor"), Mode: "ro"},
+	}
+	c := newStdioClient(t, cfg)
+	sessionID := c.openSession(tmp)
+
+	for _, call := range []struct {
+		method string
+		params map[string]any
+		reason string
+	}{
+		{"fs.move", map[string]any{"from": "app/config", "to": "moved"}, "deny"},
+		{"fs.remove", map[string]any{"path": "app/config", "recursive": true}, "deny"},
+		{"fs.remove", map[string]any{"path": "app", "recursive": true}, "read_only"},
+		{"fs.move", map[string]any{"from": "app", "to": "app2"}, "read_only"},
+		{"fs.move", map[string]any{"from": "app/tmp", "to": "app/config", "overwrite": true}, "deny"},
+	} {
+		call.params["session_id"] = sessionID
+		resp := c.call(call.method, call.params)
+		if data := errorData(t, resp); data["reason"] != call.reason {
+			t.Fatalf("%s %v: expected %s error, got %+v", call.method, call.params, call.reason, resp["error"])
+		}
+	}
+	if _, err := os.Stat(filepath.Join(tmp, "app/config/secrets/key")); err != nil {
+		t.Fatalf("denied file must stay in place: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmp, "app/vendor/lib.go")); err != nil {
+		t.Fatalf("read-only root must stay in place: %v", err)
+	}
+	c.result("fs.remove", map[string]any{"session_id": sessionID, "path": "app/tmp", "recursive": true})
+}
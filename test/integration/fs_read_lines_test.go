@@ -0,0 +1,90 @@
+package integration
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestFSReadLinesAndBinaryDetection(t *testing.T) {
+	tmp := t.TempDir()
+	writeTree(t, tmp, map[string]string{
+		"notes.txt": "one\ntwo\nthree\n" + strings.Repeat("x", 50) + "\nfive",
+		"image.png": "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR",
+	})
+	c := newStdioClient(t, testConfig(tmp))
+	sessionID := c.openSession(tmp)
+
+	res := c.result("fs.read", map[string]any{
+		"session_id":      sessionID,
+		"path":            "notes.txt",
+		"start_line":      2,
+		"max_lines":       3,
+		"line_numbers":    true,
+		"max_line_length": 10,
+	})
+	want := "     2\ttwo\n     3\tthree\n     4\t" + strings.Repeat("x", 10) + "…\n"
+	if res["content"] != want {
+		t.Fatalf("unexpected content:\n%q\nwant:\n%q", res["content"], want)
+	}
+	if res["start_line"].(float64) != 2 || res["end_line"].(float64) != 4 || res["total_lines"].(float64) != 5 {
+		t.Fatalf("unexpected line bookkeeping: %+v", res)
+	}
+	if res["truncated"] != true || res["lines_truncated"].(float64) != 1 {
+		t.Fatalf("expected truncation flags: %+v", res)
+	}
+
+	res = c.result("fs.read", map[string]any{"session_id": sessionID, "path": "notes.txt", "offset": 4, "length": 3})
+	if _, ok := res["total_lines"]; res["content"] != "two" || ok || res["binary"] != false {
+		t.Fatalf("byte-range read changed: %+v", res)
+	}
+
+	res = c.result("fs.read", map[string]any{"session_id": sessionID, "path": "image.png"})
+	if res["binary"] != true || res["encoding"] != "base64" || res["mime"] != "image/png" {
+		t.Fatalf("expected binary detection with base64 output, got %+v", res)
+	}
+	if data, _ := base64.StdEncoding.DecodeString(res["content"].(string)); !strings.HasPrefix(string(data), "\x89PNG") {
+		t.Fatalf("unexpected decoded content %q", data)
+	}
+	if c.errorCode("fs.read", map[string]any{"session_id": sessionID, "path": "image.png", "on_binary": "error"}) == 0 {
+		t.Fatalf("expected on_binary=error to refuse binary file")
+	}
+	if c.errorCode("fs.read", map[string]any{"session_id": sessionID, "path": "image.png", "max_lines": 10}) == 0 {
+		t.Fatalf("expected line-oriented read of binary file to fail")
+	}
+}
+
+func TestFSReadLinesBoundsLongLines(t *testing.T) {
+	tmp := t.TempDir()
+	utf16 := []byte{0xFF, 0xFE}
+	for _, r := range "héllo\nwörld\n" {
+		utf16 = append(utf16, byte(r), byte(r>>8))
+	}
+	writeTree(t, tmp, map[string]string{
+		"huge.txt":    strings.Repeat("y", 200000) + "\nsecond\n",
+		"oneline.txt": strings.Repeat("z", 300000),
+		"wide.txt":    string(utf16),
+	})
+	cfg := testConfig(tmp)
+	cfg.Limits.MaxFileReadBytes = 1000
+	c := newStdioClient(t, cfg)
+	sessionID := c.openSession(tmp)
+
+	res := c.result("fs.read", map[string]any{"session_id": sessionID, "path": "huge.txt", "start_line": 1})
+	if content := res["content"].(string); len(content) != 1000 || strings.Trim(content, "y") != "" {
+		t.Fatalf("expected first line cut to the read limit, got %d bytes", len(content))
+	}
+	if res["truncated"] != true || res["lines"].(float64) != 1 || res["total_lines"].(float64) != 2 {
+		t.Fatalf("unexpected bookkeeping for oversized first line: %+v", res)
+	}
+
+	res = c.result("fs.read", map[string]any{"session_id": sessionID, "path": "oneline.txt", "max_line_length": 10})
+	if res["content"] != strings.Repeat("z", 10)+"…" || res["total_lines"].(float64) != 1 || res["lines_truncated"].(float64) != 1 {
+		t.Fatalf("unexpected newline-free read: %+v", res)
+	}
+
+	res = c.result("fs.read", map[string]any{"session_id": sessionID, "path": "wide.txt", "start_line": 2})
+	if res["content"] != "wörld\n" || res["text_encoding"] != "utf16le" {
+		t.Fatalf("unexpected UTF-16 line read: %+v", res)
+	}
+}
@@ -0,0 +1,116 @@
+package integration
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for rel, content := range files {
+		p := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("mkdir %s: %v", rel, err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatalf("write %s: %v", rel, err)
+		}
+	}
+}
+
+func TestFSSearchStructuredResults(t *testing.T) {
+	tmp := t.TempDir()
+	writeTree(t, tmp, map[string]string{
+		".gitignore":         "build/\n*.log\n",
+		"src/main.go":        "package main\n\nfunc main() {\n\tTODO(\"wire\")\n}\n",
+		"src/util.ts":        "// todo: later\nexport const x = 1\n",
+		"build/out.go":       "TODO ignored build output\n",
+		"debug.log":          "TODO ignored log\n",
+		"assets/image.bin":   "TODO\x00binary",
+		"docs/notes/a.md":    "nothing here\n",
+		"docs/notes/todo.md": "- [ ] TODO one\n- [ ] TODO two TODO\n",
+	})
+	c := newStdioClient(t, testConfig(tmp))
+	sessionID := c.openSession(tmp)
+
+	res := c.result("fs.search", map[string]any{
+		"session_id": sessionID,
+		"pattern":    "TODO",
+		"literal":    true,
+		"context":    1,
+	})
+	matches := res["matches"].([]any)
+	if len(matches) != 3 {
+		t.Fatalf("expected 3 matching lines, got %d: %+v", len(matches), matches)
+	}
+	first := matches[0].(map[string]any)
+	if first["path"] != filepath.Join(tmp, "docs/notes/todo.md") || first["line"].(float64) != 1 || first["column"].(float64) != 7 {
+		t.Fatalf("unexpected first match: %+v", first)
+	}
+	second := matches[1].(map[string]any)
+	if subs, _ := second["submatches"].([]any); len(subs) != 2 {
+		t.Fatalf("expected two submatches on line 2, got %+v", second)
+	}
+	code := matches[2].(map[string]any)
+	if code["path"] != filepath.Join(tmp, "src/main.go") || code["line"].(float64) != 4 {
+		t.Fatalf("unexpected code match: %+v", code)
+	}
+	if before := code["context_before"].([]any); len(before) != 1 || before[0] != "func main() {" {
+		t.Fatalf("unexpected context: %+v", code["context_before"])
+	}
+	if res["binary_skipped"].(float64) != 1 {
+		t.Fatalf("expected binary file to be skipped, got %v", res["binary_skipped"])
+	}
+
+	res = c.result("fs.search", map[string]any{
+		"session_id": sessionID,
+		"pattern":    "todo",
+		"smart_case": true,
+		"include":    []string{"src/**/*.{ts,go}"},
+	})
+	if n := len(res["matches"].([]any)); n != 2 {
+		t.Fatalf("expected smart-case include search to match 2 lines, got %d", n)
+	}
+
+	res = c.result("fs.search", map[string]any{
+		"session_id":  sessionID,
+		"pattern":     "TODO",
+		"no_ignore":   true,
+		"exclude":     []string{"*.md", "assets/**"},
+		"max_matches": 1,
+	})
+	if n := len(res["matches"].([]any)); n != 1 || res["truncated"] != true {
+		t.Fatalf("expected max_matches to truncate, got %d matches truncated=%v", n, res["truncated"])
+	}
+
+	if code := c.errorCode("fs.search", map[string]any{"session_id": sessionID, "pattern": "x", "path": "/etc"}); code != -32002 {
+		t.Fatalf("expected forbidden path, got %d", code)
+	}
+}
+
+func TestFSSearchIgnoresGitignoreAboveAllowedRoot(t *testing.T) {
+	tmp := t.TempDir()
+	writeTree(t, tmp, map[string]string{
+		".git/HEAD":         "ref: refs/heads/main\n",
+		".gitignore":        "*.txt\n",
+		"ws/notes.txt":      "TODO visible\n",
+		"ws/sub/.gitignore": "skip.txt\n",
+		"ws/sub/skip.txt":   "TODO hidden\n",
+		"ws/sub/keep.txt":   "TODO kept\n",
+	})
+	root := filepath.Join(tmp, "ws")
+	c := newStdioClient(t, testConfig(root))
+	sessionID := c.openSession(root)
+
+	res := c.result("fs.search", map[string]any{"session_id": sessionID, "pattern": "TODO"})
+	matches := res["matches"].([]any)
+	if len(matches) != 2 {
+		t.Fatalf("expected 2 matches, got %+v", matches)
+	}
+	for i, want := range []string{"ws/notes.txt", "ws/sub/keep.txt"} {
+		if got := matches[i].(map[string]any)["path"]; got != filepath.Join(tmp, want) {
+			t.Fatalf("match %d: expected %s, got %v", i, want, got)
+		}
+	}
+}
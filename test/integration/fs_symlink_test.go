@@ -0,0 +1,126 @@
+package integration
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	fssvc "github.com/samiralibabic/rexd/internal/fs"
+	"github.com/samiralibabic/rexd/internal/policy"
+)
+
+func TestFSSymlinksCannotEscapeRoots(t *testing.T) {
+	tmp := t.TempDir()
+	root := filepath.Join(tmp, "ws")
+	outside := filepath.Join(tmp, "outside")
+	writeTree(t, root, map[string]string{"real/a.txt": "inside"})
+	writeTree(t, outside, map[string]string{"secret.txt": "secret"})
+	for link, target := range map[string]string{
+		"escape":   outside,
+		"dangling": filepath.Join(outside, "created.txt"),
+		"alias":    "real",
+		"absolute": filepath.Join(root, "real"),
+	} {
+		if err := os.Symlink(target, filepath.Join(root, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := newStdioClient(t, testConfig(root))
+	sessionID := c.openSession(root)
+
+	if code := c.errorCode("fs.read", map[string]any{"session_id": sessionID, "path": "escape/secret.txt"}); code != -32002 {
+		t.Fatalf("expected read through escaping symlink to be forbidden, got %d", code)
+	}
+	if code := c.errorCode("fs.write", map[string]any{"session_id": sessionID, "path": "escape/new.txt", "content": "x"}); code != -32002 {
+		t.Fatalf("expected write through escaping symlink to be forbidden, got %d", code)
+	}
+	if code := c.errorCode("fs.write", map[string]any{"session_id": sessionID, "path": "dangling", "content": "x"}); code != -32002 {
+		t.Fatalf("expected write through dangling symlink to be forbidden, got %d", code)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "created.txt")); !os.IsNotExist(err) {
+		t.Fatalf("file was created outside the root: %v", err)
+	}
+	for _, p := range []string{"alias/a.txt", "absolute/a.txt"} {
+		res := c.result("fs.read", map[string]any{"session_id": sessionID, "path": p})
+		if res["content"] != "inside" {
+			t.Fatalf("expected in-root symlink %s to be readable, got %+v", p, res)
+		}
+	}
+
+	cfg := testConfig(root)
+	cfg.Security.AllowSymlinks = false
+	strict := newStdioClient(t, cfg)
+	strictSession := strict.openSession(root)
+	if code := strict.errorCode("fs.read", map[string]any{"session_id": strictSession, "path": "alias/a.txt"}); code != -32002 {
+		t.Fatalf("expected in-root symlink to be forbidden when allow_symlinks=false, got %d", code)
+	}
+	res := strict.result("fs.read", map[string]any{"session_id": strictSession, "path": "real/a.txt"})
+	if res["content"] != "inside" {
+		t.Fatalf("expected plain path to be readable, got %+v", res)
+	}
+}
+
+func TestFSMutationsRefuseParentSwappedForSymlink(t *testing.T) {
+	for _, allowSymlinks := range []bool{false, true} {
+		tmp := t.TempDir()
+		root := filepath.Join(tmp, "ws")
+		outside := filepath.Join(tmp, "outside")
+		writeTree(t, root, map[string]string{"dir/victim.txt": "inside", "other.txt": "other"})
+		writeTree(t, outside, map[string]string{"victim.txt": "outside", "sub/keep.txt": "keep"})
+		pol, err := policy.New(policy.Options{AllowedRoots: []string{root}, AllowSymlinks: allowSymlinks})
+		if err != nil {
+			t.Fatal(err)
+		}
+		svc := fssvc.NewService(1<<20, pol.OpenFile, pol.IsDenied, pol.RootFor)
+		dir := filepath.Join(root, "dir")
+		for _, p := range []string{"victim.txt", "new.txt", "sub"} {
+			if _, err := pol.ResolvePath(root, filepath.Join(dir, p)); err != nil {
+				t.Fatalf("resolve %s: %v", p, err)
+			}
+		}
+
+		if err := os.Rename(dir, dir+".real"); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(outside, dir); err != nil {
+			t.Fatal(err)
+		}
+
+		other := filepath.Join(root, "other.txt")
+		attempts := map[string]error{}
+		_, attempts["write"] = svc.Write(filepath.Join(dir, "new.txt"), []byte("x"), fssvc.WriteOptions{Mode: "replace", Atomic: true})
+		_, attempts["overwrite"] = svc.Write(filepath.Join(dir, "victim.txt"), []byte("x"), fssvc.WriteOptions{Mode: "replace", Atomic: true})
+		_, attempts["mkdir"] = svc.Mkdir(filepath.Join(dir, "made"), false, 0)
+		_, attempts["move"] = svc.Move(other, filepath.Join(dir, "moved.txt"), false, false, 0, 0)
+		_, attempts["copy"] = svc.Copy(other, filepath.Join(dir, "copied.txt"), false, false, false, 0, 0)
+		_, attempts["remove"] = svc.Remove(filepath.Join(dir, "victim.txt"), false, 0, 0)
+		_, attempts["remove_tree"] = svc.Remove(filepath.Join(dir, "sub"), true, 0, 0)
+		_, attempts["chmod"] = svc.Chmod(filepath.Join(dir, "victim.txt"), 0777, 0)
+		for op, err := range attempts {
+			if err == nil {
+				t.Errorf("allow_symlinks=%v: expected %s through the swapped parent to fail", allowSymlinks, op)
+			}
+		}
+
+		entries, err := os.ReadDir(outside)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 2 {
+			t.Fatalf("allow_symlinks=%v: expected outside directory untouched, got %d entries", allowSymlinks, len(entries))
+		}
+		st, err := os.Stat(filepath.Join(outside, "victim.txt"))
+		if err != nil || st.Mode().Perm() != 0644 {
+			t.Fatalf("allow_symlinks=%v: expected outside file untouched, got %v, %v", allowSymlinks, st, err)
+		}
+		if data, _ := os.ReadFile(filepath.Join(outside, "victim.txt")); string(data) != "outside" {
+			t.Fatalf("allow_symlinks=%v: outside file was rewritten: %q", allowSymlinks, data)
+		}
+		if _, err := os.Stat(filepath.Join(outside, "sub", "keep.txt")); err != nil {
+			t.Fatalf("allow_symlinks=%v: outside tree was removed: %v", allowSymlinks, err)
+		}
+		if _, err := os.Stat(other); err != nil {
+			t.Fatalf("allow_symlinks=%v: source of the refused move is gone: %v", allowSymlinks, err)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package integration
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"unicode/utf16"
+)
+
+func encodeUTF16LE(s string) []byte {
+	out := []byte{0xFF, 0xFE}
+	for _, u := range utf16.Encode([]rune(s)) {
+		out = append(out, byte(u), byte(u>>8))
+	}
+	return out
+}
+
+func TestFSTextEncodingAndLineEndingsArePreserved(t *testing.T) {
+	tmp := t.TempDir()
+	writeTree(t, tmp, map[string]string{
+		"crlf.txt":   "alpha\r\nbeta\r\ngamma\r\n",
+		"latin1.txt": "caf\xe9\nna\xefve\n",
+	})
+	utf16Path := filepath.Join(tmp, "wide.txt")
+	if err := os.WriteFile(utf16Path, encodeUTF16LE("héllo\r\nwörld\r\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := newStdioClient(t, testConfig(tmp))
+	sessionID := c.openSession(tmp)
+
+	res := c.result("fs.read", map[string]any{"session_id": sessionID, "path": "wide.txt"})
+	if res["content"] != "héllo\r\nwörld\r\n" || res["text_encoding"] != "utf16le" || res["line_ending"] != "crlf" || res["binary"] != false {
+		t.Fatalf("unexpected utf16 read: %+v", res)
+	}
+	res = c.result("fs.read", map[string]any{"session_id": sessionID, "path": "latin1.txt", "max_lines": 1})
+	if res["content"] != "café\n" || res["text_encoding"] != "latin1" {
+		t.Fatalf("unexpected latin1 read: %+v", res)
+	}
+
+	c.result("fs.edit", map[string]any{"session_id": sessionID, "path": "crlf.txt", "old_string": "beta\ngamma", "new_string": "beta\nBETA\ngamma"})
+	if got, _ := os.ReadFile(filepath.Join(tmp, "crlf.txt")); string(got) != "alpha\r\nbeta\r\nBETA\r\ngamma\r\n" {
+		t.Fatalf("edit broke CRLF line endings: %q", got)
+	}
+
+	c.result("fs.edit", map[string]any{"session_id": sessionID, "path": "wide.txt", "old_string": "wörld", "new_string": "wörld\nagain"})
+	if got, _ := os.ReadFile(utf16Path); !bytes.Equal(got, encodeUTF16LE("héllo\r\nwörld\r\nagain\r\n")) {
+		t.Fatalf("edit did not keep UTF-16LE with BOM and CRLF: % x", got)
+	}
+
+	c.result("fs.patch", map[string]any{
+		"session_id": sessionID,
+		"patch_text": "*** Begin Patch\n*** Update File: crlf.txt\n@@\n alpha\n-beta\n+delta\n*** Update File: latin1.txt\n@@\n-café\n+crème\n*** End Patch",
+	})
+	if got, _ := os.ReadFile(filepath.Join(tmp, "crlf.txt")); string(got) != "alpha\r\ndelta\r\nBETA\r\ngamma\r\n" {
+		t.Fatalf("patch broke CRLF line endings: %q", got)
+	}
+	if got, _ := os.ReadFile(filepath.Join(tmp, "latin1.txt")); string(got) != "cr\xe8me\nna\xefve\n" {
+		t.Fatalf("patch did not keep latin1: %q", got)
+	}
+
+	res = c.result("fs.write", map[string]any{"session_id": sessionID, "path": "crlf.txt", "content": "one\ntwo\n", "text_encoding": "preserve", "line_ending": "preserve"})
+	if got, _ := os.ReadFile(filepath.Join(tmp, "crlf.txt")); string(got) != "one\r\ntwo\r\n" || res["line_ending"] != "crlf" {
+		t.Fatalf("write did not preserve CRLF: %q %+v", got, res)
+	}
+	res = c.result("fs.write", map[string]any{"session_id": sessionID, "path": "latin1.txt", "content": "raw\n"})
+	if got, _ := os.ReadFile(filepath.Join(tmp, "latin1.txt")); string(got) != "raw\n" || res["text_encoding"] != nil {
+		t.Fatalf("write without overrides should store the content as sent: %q %+v", got, res)
+	}
+	c.result("fs.write", map[string]any{"session_id": sessionID, "path": "latin1.txt", "content": "caf\u00e9\n", "text_encoding": "latin1"})
+	c.result("fs.write", map[string]any{"session_id": sessionID, "path": "crlf.txt", "content": "one\r\ntwo\r\n", "line_ending": "lf", "text_encoding": "utf8-bom"})
+	if got, _ := os.ReadFile(filepath.Join(tmp, "crlf.txt")); string(got) != "\xef\xbb\xbfone\ntwo\n" {
+		t.Fatalf("write overrides not applied: %q", got)
+	}
+	if code := c.errorCode("fs.write", map[string]any{"session_id": sessionID, "path": "latin1.txt", "content": "日本\n", "text_encoding": "preserve"}); code != -32602 {
+		t.Fatalf("expected unencodable latin1 write to fail with -32602, got %d", code)
+	}
+	if code := c.errorCode("fs.write", map[string]any{"session_id": sessionID, "path": "x.txt", "content": "eA==", "encoding": "base64", "line_ending": "crlf"}); code != -32602 {
+		t.Fatalf("expected line_ending with base64 content to fail, got %d", code)
+	}
+}
+
+func TestFSEditLeavesStrayAndMixedLineEndingsAlone(t *testing.T) {
+	tmp := t.TempDir()
+	writeTree(t, tmp, map[string]string{
+		"progress.txt": "progress\r50%\nfoo\nbar\n",
+		"mixed.txt":    "a\r\nb\nc\nd\n",
+	})
+	c := newStdioClient(t, testConfig(tmp))
+	sessionID := c.openSession(tmp)
+
+	c.result("fs.edit", map[string]any{"session_id": sessionID, "path": "progress.txt", "old_string": "foo", "new_string": "baz"})
+	if got, _ := os.ReadFile(filepath.Join(tmp, "progress.txt")); string(got) != "progress\r50%\nbaz\nbar\n" {
+		t.Fatalf("edit rewrote a stray carriage return: %q", got)
+	}
+	c.result("fs.multi_edit", map[string]any{"session_id": sessionID, "path": "mixed.txt", "edits": []map[string]any{{"old_string": "c", "new_string": "x"}}})
+	if got, _ := os.ReadFile(filepath.Join(tmp, "mixed.txt")); string(got) != "a\r\nb\nx\nd\n" {
+		t.Fatalf("multi_edit rewrote mixed line endings: %q", got)
+	}
+	if code := c.errorCode("fs.patch", map[string]any{
+		"session_id": sessionID,
+		"patch_text": "*** Begin Patch\n*** Update File: mixed.txt\n@@\n b\n-x\n+y\n*** End Patch",
+	}); code != -32602 {
+		t.Fatalf("expected a patch on mixed line endings to be refused, got %d", code)
+	}
+	if got, _ := os.ReadFile(filepath.Join(tmp, "mixed.txt")); string(got) != "a\r\nb\nx\nd\n" {
+		t.Fatalf("refused patch changed the file: %q", got)
+	}
+}
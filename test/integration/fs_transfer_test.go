@@ -0,0 +1,199 @@
+package integration
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFSChunkedUpload(t *testing.T) {
+	tmp := t.TempDir()
+	c := newStdioClient(t, testConfig(tmp))
+	sessionID := c.openSession(tmp)
+
+	payload := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+	sum := sha256.Sum256(payload)
+	res := c.result("fs.upload.begin", map[string]any{
+		"session_id":    sessionID,
+		"path":          "data/blob.bin",
+		"size":          len(payload),
+		"mkdir_parents": true,
+	})
+	uploadID := res["upload_id"].(string)
+
+	chunk := 10000
+	for offset := 0; offset < len(payload); offset += chunk {
+		end := min(offset+chunk, len(payload))
+		res = c.result("fs.upload.chunk", map[string]any{
+			"session_id": sessionID,
+			"upload_id":  uploadID,
+			"offset":     offset,
+			"data":       base64.StdEncoding.EncodeToString(payload[offset:end]),
+		})
+		if int(res["received"].(float64)) != end {
+			t.Fatalf("expected received=%d, got %+v", end, res)
+		}
+		if offset == 0 {
+			c.result("fs.upload.chunk", map[string]any{
+				"session_id": sessionID,
+				"upload_id":  uploadID,
+				"offset":     0,
+				"data":       base64.StdEncoding.EncodeToString(payload[:end]),
+			})
+		}
+	}
+	if c.errorCode("fs.upload.chunk", map[string]any{
+		"session_id": sessionID,
+		"upload_id":  uploadID,
+		"offset":     len(payload) + 10,
+		"data":       "AA==",
+	}) == 0 {
+		t.Fatalf("expected gap in offsets to be rejected")
+	}
+	if code := c.errorCode("fs.upload.commit", map[string]any{"session_id": sessionID, "upload_id": uploadID, "sha256": hex.EncodeToString(make([]byte, 32))}); code != -32006 {
+		t.Fatalf("expected checksum mismatch, got %d", code)
+	}
+	if _, err := os.Stat(filepath.Join(tmp, "data/blob.bin")); !os.IsNotExist(err) {
+		t.Fatalf("target must not exist before a successful commit: %v", err)
+	}
+	res = c.result("fs.upload.commit", map[string]any{"session_id": sessionID, "upload_id": uploadID, "sha256": hex.EncodeToString(sum[:])})
+	if res["sha256"] != hex.EncodeToString(sum[:]) || res["created"] != true {
+		t.Fatalf("unexpected commit result: %+v", res)
+	}
+	got, err := os.ReadFile(filepath.Join(tmp, "data/blob.bin"))
+	if err != nil || !bytes.Equal(got, payload) {
+		t.Fatalf("uploaded content mismatch: %v", err)
+	}
+	entries, _ := os.ReadDir(filepath.Join(tmp, "data"))
+	if len(entries) != 1 {
+		t.Fatalf("expected temp file to be gone, got %v", entries)
+	}
+
+	res = c.result("fs.upload.begin", map[string]any{"session_id": sessionID, "path": "data/aborted.bin"})
+	c.result("fs.upload.abort", map[string]any{"session_id": sessionID, "upload_id": res["upload_id"]})
+	if entries, _ := os.ReadDir(filepath.Join(tmp, "data")); len(entries) != 1 {
+		t.Fatalf("expected abort to remove temp file, got %v", entries)
+	}
+	if code := c.errorCode("fs.upload.begin", map[string]any{"session_id": sessionID, "path": "data/blob.bin"}); code != -32006 {
+		t.Fatalf("expected existing target without overwrite to conflict, got %d", code)
+	}
+}
+
+func TestFSDownloadFlowControl(t *testing.T) {
+	tmp := t.TempDir()
+	payload := bytes.Repeat([]byte("rexd-download "), 5000)
+	if err := os.WriteFile(filepath.Join(tmp, "big.txt"), payload, 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := newStdioClient(t, testConfig(tmp))
+	sessionID := c.openSession(tmp)
+
+	res := c.result("fs.download", map[string]any{
+		"session_id": sessionID,
+		"path":       "big.txt",
+		"chunk_size": 4096,
+		"window":     2,
+	})
+	downloadID := res["download_id"].(string)
+	if int(res["size"].(float64)) != len(payload) {
+		t.Fatalf("unexpected size: %+v", res)
+	}
+	isChunk := func(p map[string]any) bool { return p["download_id"] == downloadID }
+
+	first := c.waitEvent("fs.data", isChunk)
+	second := c.waitEvent("fs.data", isChunk)
+	if first["seq"].(float64) != 1 || second["seq"].(float64) != 2 {
+		t.Fatalf("unexpected chunk order: %v %v", first["seq"], second["seq"])
+	}
+	time.Sleep(100 * time.Millisecond)
+	c.result("session.info", map[string]any{"session_id": sessionID})
+	for _, evt := range c.events {
+		if params, _ := evt["params"].(map[string]any); evt["method"] == "fs.data" && isChunk(params) {
+			t.Fatalf("received chunk beyond the window before ack: %+v", params["seq"])
+		}
+	}
+
+	var got bytes.Buffer
+	for _, chunk := range []map[string]any{first, second} {
+		data, _ := base64.StdEncoding.DecodeString(chunk["data"].(string))
+		got.Write(data)
+	}
+	c.result("fs.download.ack", map[string]any{"session_id": sessionID, "download_id": downloadID, "seq": 2})
+	for {
+		chunk := c.waitEvent("fs.data", isChunk)
+		data, _ := base64.StdEncoding.DecodeString(chunk["data"].(string))
+		got.Write(data)
+		c.result("fs.download.ack", map[string]any{"session_id": sessionID, "download_id": downloadID, "seq": chunk["seq"]})
+		if chunk["eof"] == true {
+			sum := sha256.Sum256(payload)
+			if chunk["sha256"] != hex.EncodeToString(sum[:]) {
+				t.Fatalf("unexpected sha256 in final chunk: %+v", chunk)
+			}
+			break
+		}
+	}
+	if !bytes.Equal(got.Bytes(), payload) {
+		t.Fatalf("downloaded %d bytes, want %d", got.Len(), len(payload))
+	}
+}
+
+func TestFSDownloadTimesOutWithoutAcks(t *testing.T) {
+	tmp := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmp, "big.txt"), bytes.Repeat([]byte("x"), 3*4096), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := testConfig(tmp)
+	cfg.Limits.DownloadIdleTimeoutMs = 200
+	c := newStdioClient(t, cfg)
+	sessionID := c.openSession(tmp)
+
+	res := c.result("fs.download", map[string]any{
+		"session_id": sessionID,
+		"path":       "big.txt",
+		"chunk_size": 4096,
+		"window":     1,
+	})
+	downloadID := res["download_id"].(string)
+	isChunk := func(p map[string]any) bool { return p["download_id"] == downloadID }
+	if first := c.waitEvent("fs.data", isChunk); first["seq"].(float64) != 1 {
+		t.Fatalf("unexpected first chunk: %+v", first)
+	}
+	failed := c.waitEvent("fs.data", isChunk)
+	if msg, _ := failed["error"].(string); !strings.Contains(msg, "no fs.download.ack") || failed["eof"] != true {
+		t.Fatalf("expected an idle timeout error, got %+v", failed)
+	}
+	if code := c.errorCode("fs.download.ack", map[string]any{"session_id": sessionID, "download_id": downloadID, "seq": 1}); code == 0 {
+		t.Fatalf("expected the timed out download to be gone")
+	}
+}
+
+func TestFSUploadOverwriteKeepsMode(t *testing.T) {
+	tmp := t.TempDir()
+	script := filepath.Join(tmp, "run.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\necho old\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	c := newStdioClient(t, testConfig(tmp))
+	sessionID := c.openSession(tmp)
+
+	for _, path := range []string{"run.sh", "new.txt"} {
+		uploadID := c.result("fs.upload.begin", map[string]any{"session_id": sessionID, "path": path, "overwrite": true})["upload_id"].(string)
+		c.result("fs.upload.chunk", map[string]any{"session_id": sessionID, "upload_id": uploadID, "offset": 0, "data": base64.StdEncoding.EncodeToString([]byte("echo new\n"))})
+		c.result("fs.upload.commit", map[string]any{"session_id": sessionID, "upload_id": uploadID})
+	}
+	for path, want := range map[string]os.FileMode{"run.sh": 0755, "new.txt": 0644} {
+		st, err := os.Stat(filepath.Join(tmp, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st.Mode().Perm() != want {
+			t.Fatalf("%s: expected mode %o, got %o", path, want, st.Mode().Perm())
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package integration
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func watchChanges(params map[string]any) map[string]string {
+	out := map[string]string{}
+	for _, c := range params["changes"].([]any) {
+		change := c.(map[string]any)
+		out[change["path"].(string)] = change["type"].(string)
+	}
+	return out
+}
+
+func TestFSWatchReportsDebouncedChanges(t *testing.T) {
+	tmp := t.TempDir()
+	writeTree(t, tmp, map[string]string{
+		"src/main.go":     "package main\n",
+		"build/ignore.o":  "",
+		"src/old_name.go": "package main\n",
+	})
+	c := newStdioClient(t, testConfig(tmp))
+	sessionID := c.openSession(tmp)
+
+	res := c.result("fs.watch", map[string]any{
+		"session_id":  sessionID,
+		"exclude":     []string{"build/**"},
+		"debounce_ms": 50,
+	})
+	watchID := res["watch_id"].(string)
+
+	writeTree(t, tmp, map[string]string{
+		"src/pkg/new.go": "package pkg\n",
+		"build/out.o":    "ignored",
+	})
+	if err := os.WriteFile(filepath.Join(tmp, "src/main.go"), []byte("package main\n\nfunc main() {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(tmp, "src/old_name.go"), filepath.Join(tmp, "src/new_name.go")); err != nil {
+		t.Fatal(err)
+	}
+
+	seen := map[string]string{}
+	for len(seen) < 4 {
+		params := c.waitEvent("fs.changed", func(p map[string]any) bool { return p["watch_id"] == watchID })
+		for p, kind := range watchChanges(params) {
+			seen[p] = kind
+		}
+	}
+	want := map[string]string{
+		filepath.Join(tmp, "src/pkg"):         "created",
+		filepath.Join(tmp, "src/pkg/new.go"):  "created",
+		filepath.Join(tmp, "src/main.go"):     "modified",
+		filepath.Join(tmp, "src/new_name.go"): "renamed",
+	}
+	for p, kind := range want {
+		if seen[p] != kind {
+			t.Fatalf("expected %s to be %s, got %+v", p, kind, seen)
+		}
+	}
+	if _, ok := seen[filepath.Join(tmp, "build/out.o")]; ok {
+		t.Fatalf("excluded path reported: %+v", seen)
+	}
+
+	if err := os.Remove(filepath.Join(tmp, "src/pkg/new.go")); err != nil {
+		t.Fatal(err)
+	}
+	params := c.waitEvent("fs.changed", func(p map[string]any) bool { return p["watch_id"] == watchID })
+	if kind := watchChanges(params)[filepath.Join(tmp, "src/pkg/new.go")]; kind != "deleted" {
+		t.Fatalf("expected delete event, got %+v", params)
+	}
+
+	c.result("fs.unwatch", map[string]any{"session_id": sessionID, "watch_id": watchID})
+	if code := c.errorCode("fs.unwatch", map[string]any{"session_id": sessionID, "watch_id": watchID}); code != -32602 {
+		t.Fatalf("expected unknown watch error, got %d", code)
+	}
+	if code := c.errorCode("fs.watch", map[string]any{"session_id": sessionID, "path": "/etc"}); code != -32002 {
+		t.Fatalf("expected forbidden path error, got %d", code)
+	}
+}
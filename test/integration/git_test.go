@@ -0,0 +1,109 @@
+package integration
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func gitRun(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=Ada", "GIT_AUTHOR_EMAIL=ada@example.com",
+		"GIT_COMMITTER_NAME=Ada", "GIT_COMMITTER_EMAIL=ada@example.com",
+		"GIT_CONFIG_GLOBAL=/dev/null", "GIT_CONFIG_NOSYSTEM=1",
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, out)
+	}
+}
+
+func TestGitMethodsReturnStructuredResults(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	tmp := t.TempDir()
+	writeTree(t, tmp, map[string]string{"a.txt": "one\ntwo\n", ".env": "TOKEN=1\n", "old.txt": "old\n"})
+	gitRun(t, tmp, "init", "-q", "-b", "main")
+	gitRun(t, tmp, "add", ".")
+	gitRun(t, tmp, "commit", "-q", "-m", "initial import")
+	writeTree(t, tmp, map[string]string{"a.txt": "one\nTWO\nthree\n", ".env": "TOKEN=2\n", "new.txt": "new\n"})
+	gitRun(t, tmp, "mv", "old.txt", "renamed.txt")
+	gitRun(t, tmp, "commit", "-q", "-m", "rename old\n\nwith a body")
+
+	cfg := testConfig(tmp)
+	cfg.Security.AllowShell = false
+	cfg.Security.Deny = []string{".env"}
+	c := newStdioClient(t, cfg)
+	sessionID := c.openSession(tmp)
+
+	status := c.result("git.status", map[string]any{"session_id": sessionID})
+	branch := status["branch"].(map[string]any)
+	if branch["head"] != "main" || status["clean"] != false || status["root"] != tmp {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+	entries := status["entries"].([]any)
+	if len(entries) != 2 {
+		t.Fatalf("expected a.txt and new.txt only, got %+v", entries)
+	}
+	if e := entries[0].(map[string]any); e["path"] != "a.txt" || e["kind"] != "changed" || e["worktree"] != "M" {
+		t.Fatalf("unexpected entry: %+v", e)
+	}
+	if e := entries[1].(map[string]any); e["path"] != "new.txt" || e["kind"] != "untracked" {
+		t.Fatalf("unexpected entry: %+v", e)
+	}
+
+	diff := c.result("git.diff", map[string]any{"session_id": sessionID, "context": 0})
+	files := diff["files"].([]any)
+	if len(files) != 1 || diff["added"] != float64(2) || diff["removed"] != float64(1) {
+		t.Fatalf("unexpected diff: %+v", diff)
+	}
+	hunk := files[0].(map[string]any)["hunks"].([]any)[0].(map[string]any)
+	if hunk["old_start"] != float64(2) || len(hunk["lines"].([]any)) != 3 {
+		t.Fatalf("unexpected hunk: %+v", hunk)
+	}
+	diff = c.result("git.diff", map[string]any{"session_id": sessionID, "base": "HEAD~1", "target": "HEAD"})
+	if f := diff["files"].([]any)[0].(map[string]any); f["status"] != "renamed" || f["old_path"] != "old.txt" || f["path"] != "renamed.txt" {
+		t.Fatalf("unexpected rename diff: %+v", diff)
+	}
+
+	log := c.result("git.log", map[string]any{"session_id": sessionID})
+	commits := log["commits"].([]any)
+	first := commits[0].(map[string]any)
+	if len(commits) != 2 || first["subject"] != "rename old" || first["body"] != "with a body" || first["author"].(map[string]any)["name"] != "Ada" {
+		t.Fatalf("unexpected log: %+v", log)
+	}
+	if log = c.result("git.log", map[string]any{"session_id": sessionID, "max_entries": 1}); log["truncated"] != true || len(log["commits"].([]any)) != 1 {
+		t.Fatalf("expected truncated log: %+v", log)
+	}
+
+	blame := c.result("git.blame", map[string]any{"session_id": sessionID, "path": "renamed.txt"})
+	line := blame["lines"].([]any)[0].(map[string]any)
+	if line["text"] != "old" || line["author"] != "Ada" || line["summary"] != "initial import" || line["line"] != float64(1) {
+		t.Fatalf("unexpected blame: %+v", blame)
+	}
+	if code := c.errorCode("git.blame", map[string]any{"session_id": sessionID, "path": ".env"}); code != -32009 {
+		t.Fatalf("expected denied blame, got %d", code)
+	}
+	if code := c.errorCode("git.log", map[string]any{"session_id": sessionID, "rev": "--output=/tmp/x"}); code != -32602 {
+		t.Fatalf("expected option-like revision to be rejected, got %d", code)
+	}
+}
+
+func TestGitMethodsRequireARepository(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	tmp := t.TempDir()
+	if err := os.Mkdir(filepath.Join(tmp, "plain"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	c := newStdioClient(t, testConfig(filepath.Join(tmp, "plain")))
+	sessionID := c.openSession(filepath.Join(tmp, "plain"))
+	if code := c.errorCode("git.status", map[string]any{"session_id": sessionID}); code != -32602 {
+		t.Fatalf("expected error outside a repository, got %d", code)
+	}
+}
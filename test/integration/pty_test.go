@@ -0,0 +1,92 @@
+package integration
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/samiralibabic/rexd/internal/protocol"
+)
+
+func TestPTYSharedViewerAndHandoff(t *testing.T) {
+	tmp := t.TempDir()
+	c := newStdioClient(t, testConfig(tmp))
+	agent := c.openSession(tmp)
+	human := c.openSession(tmp)
+
+	opened := c.result("pty.open", map[string]any{
+		"session_id": agent,
+		"argv":       []string{"cat"},
+		"cwd":        tmp,
+	})
+	ptyID := opened["pty_id"].(string)
+
+	if code := c.errorCode("pty.attach", map[string]any{"session_id": human, "pty_id": ptyID}); code != protocol.ErrUnauthorized {
+		t.Fatalf("expected attach without a grant to be rejected, got %d", code)
+	}
+	c.result("pty.grant", map[string]any{"session_id": agent, "pty_id": ptyID, "to_session_id": human, "role": "viewer"})
+	attached := c.result("pty.attach", map[string]any{"session_id": human, "pty_id": ptyID})
+	if attached["role"] != "viewer" {
+		t.Fatalf("expected default viewer role, got %v", attached["role"])
+	}
+
+	if code := c.errorCode("pty.input", map[string]any{"session_id": human, "pty_id": ptyID, "data": "nope\n"}); code != protocol.ErrUnauthorized {
+		t.Fatalf("expected viewer input to be rejected with %d, got %d", protocol.ErrUnauthorized, code)
+	}
+
+	c.result("pty.input", map[string]any{"session_id": agent, "pty_id": ptyID, "data": "from-agent\n"})
+	for _, sid := range []string{agent, human} {
+		c.waitEvent("pty.output", func(p map[string]any) bool {
+			return p["session_id"] == sid && strings.Contains(p["data"].(string), "from-agent")
+		})
+	}
+
+	handoff := c.result("pty.handoff", map[string]any{"session_id": agent, "pty_id": ptyID, "to_session_id": human})
+	if handoff["owner"] != human {
+		t.Fatalf("expected %s to own pty after handoff, got %v", human, handoff["owner"])
+	}
+	if code := c.errorCode("pty.input", map[string]any{"session_id": agent, "pty_id": ptyID, "data": "late\n"}); code != protocol.ErrUnauthorized {
+		t.Fatalf("expected previous owner to be read-only, got %d", code)
+	}
+	c.result("pty.input", map[string]any{"session_id": human, "pty_id": ptyID, "data": "from-human\n"})
+	c.waitEvent("pty.output", func(p map[string]any) bool {
+		return p["session_id"] == agent && strings.Contains(p["data"].(string), "from-human")
+	})
+	c.result("pty.close", map[string]any{"session_id": human, "pty_id": ptyID})
+}
+
+func TestPTYWriterRoleRequiresOwnerGrant(t *testing.T) {
+	tmp := t.TempDir()
+	c := newStdioClient(t, testConfig(tmp))
+	owner := c.openSession(tmp)
+	other := c.openSession(tmp)
+	third := c.openSession(tmp)
+
+	ptyID := c.result("pty.open", map[string]any{"session_id": owner, "argv": []string{"cat"}, "cwd": tmp})["pty_id"].(string)
+	if code := c.errorCode("pty.attach", map[string]any{"session_id": other, "pty_id": ptyID, "role": "writer"}); code != protocol.ErrUnauthorized {
+		t.Fatalf("expected self-attach as writer to be rejected with %d, got %d", protocol.ErrUnauthorized, code)
+	}
+	for _, sid := range []string{other, third} {
+		c.result("pty.grant", map[string]any{"session_id": owner, "pty_id": ptyID, "to_session_id": sid, "role": "viewer"})
+		c.result("pty.attach", map[string]any{"session_id": sid, "pty_id": ptyID})
+	}
+	if code := c.errorCode("pty.attach", map[string]any{"session_id": other, "pty_id": ptyID, "role": "writer"}); code != protocol.ErrUnauthorized {
+		t.Fatalf("expected a viewer grant not to allow writing, got %d", code)
+	}
+	if code := c.errorCode("pty.grant", map[string]any{"session_id": third, "pty_id": ptyID, "to_session_id": other, "role": "writer"}); code != protocol.ErrUnauthorized {
+		t.Fatalf("expected grant from a non-owner to be rejected, got %d", code)
+	}
+
+	c.result("pty.grant", map[string]any{"session_id": owner, "pty_id": ptyID, "to_session_id": other, "role": "writer"})
+	c.result("pty.input", map[string]any{"session_id": other, "pty_id": ptyID, "data": "granted\n"})
+	c.waitEvent("pty.output", func(p map[string]any) bool {
+		return p["session_id"] == owner && strings.Contains(p["data"].(string), "granted")
+	})
+	c.result("session.close", map[string]any{"session_id": third})
+	opened := c.result("pty.attach", map[string]any{"session_id": other, "pty_id": ptyID})
+	for _, p := range opened["participants"].([]any) {
+		if p.(map[string]any)["session_id"] == third {
+			t.Fatalf("closed session still listed as a participant: %+v", opened["participants"])
+		}
+	}
+	c.result("pty.close", map[string]any{"session_id": owner, "pty_id": ptyID})
+}
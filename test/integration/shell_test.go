@@ -0,0 +1,111 @@
+package integration
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestShellSessionKeepsStateAcrossCommands(t *testing.T) {
+	tmp := t.TempDir()
+	sub := filepath.Join(tmp, "sub")
+	if err := os.MkdirAll(sub, 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	c := newStdioClient(t, testConfig(tmp))
+	sessionID := c.openSession(tmp)
+
+	opened := c.result("shell.open", map[string]any{"session_id": sessionID, "cwd": tmp})
+	shellID := opened["shell_id"].(string)
+
+	res := c.result("shell.run", map[string]any{
+		"session_id": sessionID,
+		"shell_id":   shellID,
+		"command":    "cd sub && export REXD_SHELL_MARK=kept && printf partial; echo oops >&2",
+	})
+	if res["stdout"] != "partial" || res["stderr"] != "oops\n" {
+		t.Fatalf("unexpected split output: stdout=%q stderr=%q", res["stdout"], res["stderr"])
+	}
+	if res["cwd"] != sub {
+		t.Fatalf("expected cwd %s, got %v", sub, res["cwd"])
+	}
+	env := res["env"].(map[string]any)
+	if env["REXD_SHELL_MARK"] != "kept" {
+		t.Fatalf("expected exported env to be reported, got %v", env["REXD_SHELL_MARK"])
+	}
+	if _, ok := env["PATH"]; ok {
+		t.Fatalf("expected daemon environment to stay out of the reported env, got %v", env)
+	}
+
+	res = c.result("shell.run", map[string]any{
+		"session_id": sessionID,
+		"shell_id":   shellID,
+		"command":    "pwd; echo \"$REXD_SHELL_MARK\"; exit_status() { return 3; }; exit_status",
+	})
+	if res["stdout"] != sub+"\nkept\n" {
+		t.Fatalf("expected state to persist, got %q", res["stdout"])
+	}
+	if code := res["exit_code"].(float64); code != 3 {
+		t.Fatalf("expected exit code 3, got %v", code)
+	}
+
+	info := c.result("session.info", map[string]any{"session_id": sessionID})
+	if info["cwd"] != sub {
+		t.Fatalf("expected session cwd to sync to %s, got %v", sub, info["cwd"])
+	}
+	if sessEnv := info["env"].(map[string]any); sessEnv["REXD_SHELL_MARK"] != "kept" || sessEnv["PATH"] != nil {
+		t.Fatalf("expected session env to hold only exported variables, got %v", sessEnv)
+	}
+
+	resp := c.call("shell.run", map[string]any{
+		"session_id": sessionID,
+		"shell_id":   shellID,
+		"command":    "echo bye; exit 7",
+	})
+	data := errorData(t, resp)
+	if msg := resp["error"].(map[string]any)["message"].(string); !strings.Contains(msg, "shell exited with code 7") {
+		t.Fatalf("expected a shell exited error, got %q", msg)
+	}
+	if data["stdout"] != "bye\n" {
+		t.Fatalf("expected output of the last command in error data, got %v", data)
+	}
+}
+
+func TestSessionCloseStopsShellsAndPTYs(t *testing.T) {
+	tmp := t.TempDir()
+	c := newStdioClient(t, testConfig(tmp))
+	sessionID := c.openSession(tmp)
+
+	shellPid := int(c.result("shell.open", map[string]any{"session_id": sessionID})["pid"].(float64))
+	pidFile := filepath.Join(tmp, "pty.pid")
+	c.result("pty.open", map[string]any{"session_id": sessionID, "argv": []string{"sh", "-c", "echo $$ > " + pidFile + "; exec cat"}})
+	var ptyPid int
+	waitFor(t, func() bool {
+		data, err := os.ReadFile(pidFile)
+		if err != nil || !strings.HasSuffix(string(data), "\n") {
+			return false
+		}
+		ptyPid, err = strconv.Atoi(strings.TrimSpace(string(data)))
+		return err == nil
+	})
+
+	c.result("session.close", map[string]any{"session_id": sessionID})
+	for _, pid := range []int{shellPid, ptyPid} {
+		waitFor(t, func() bool { return syscall.Kill(pid, 0) == syscall.ESRCH })
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met before deadline")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
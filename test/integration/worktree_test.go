@@ -0,0 +1,150 @@
+package integration
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/samiralibabic/rexd/internal/config"
+)
+
+func TestWorktreesIsolateSessions(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	tmp := t.TempDir()
+	repo := filepath.Join(tmp, "repo")
+	writeTree(t, repo, map[string]string{"README.md": "hello\n"})
+	gitRun(t, repo, "init", "-q", "-b", "main")
+	gitRun(t, repo, "add", ".")
+	gitRun(t, repo, "commit", "-q", "-m", "initial")
+
+	cfg := testConfig(repo)
+	cfg.Workspace.WorktreeRoot = filepath.Join(tmp, "scratch")
+	cfg.Journal.Enabled = true
+	c := newStdioClient(t, cfg)
+	a := c.openSession(repo)
+	b := c.openSession(repo)
+
+	res := c.result("workspace.worktree.create", map[string]any{"session_id": a, "name": "agent-a"})
+	wt := res["worktree"].(map[string]any)
+	path := filepath.Join(tmp, "scratch", "agent-a")
+	if wt["path"] != path || wt["branch"] != "rexd/agent-a" || res["cwd"] != path {
+		t.Fatalf("unexpected worktree: %+v", res)
+	}
+	c.result("fs.write", map[string]any{"session_id": a, "path": "notes.txt", "content": "mine\n"})
+	if _, err := os.Stat(filepath.Join(path, "notes.txt")); err != nil {
+		t.Fatalf("relative write should land in the worktree: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(repo, "notes.txt")); !os.IsNotExist(err) {
+		t.Fatalf("main checkout must not change: %v", err)
+	}
+	status := c.result("git.status", map[string]any{"session_id": a})
+	if status["branch"].(map[string]any)["head"] != "rexd/agent-a" || len(status["entries"].([]any)) != 1 {
+		t.Fatalf("unexpected worktree status: %+v", status)
+	}
+
+	if code := c.errorCode("fs.read", map[string]any{"session_id": b, "path": filepath.Join(path, "README.md")}); code != -32002 {
+		t.Fatalf("other sessions must not reach the worktree, got %d", code)
+	}
+	if list := c.result("workspace.worktree.list", map[string]any{"session_id": b}); len(list["worktrees"].([]any)) != 0 {
+		t.Fatalf("unexpected worktrees for b: %+v", list)
+	}
+	if list := c.result("workspace.worktree.list", map[string]any{"session_id": a}); len(list["worktrees"].([]any)) != 1 {
+		t.Fatalf("unexpected worktrees for a: %+v", list)
+	}
+
+	if code := c.errorCode("workspace.worktree.remove", map[string]any{"session_id": a, "name": "agent-a"}); code != -32602 {
+		t.Fatalf("expected dirty worktree removal to fail without force, got %d", code)
+	}
+	res = c.result("workspace.worktree.remove", map[string]any{"session_id": a, "name": "agent-a", "force": true, "delete_branch": true})
+	if res["branch_deleted"] != true {
+		t.Fatalf("expected branch to be deleted: %+v", res)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("worktree directory should be gone: %v", err)
+	}
+	if info := c.result("session.info", map[string]any{"session_id": a}); info["cwd"] != repo {
+		t.Fatalf("cwd should fall back to the workspace root: %+v", info)
+	}
+	if code := c.errorCode("fs.stat", map[string]any{"session_id": a, "path": path}); code != -32002 {
+		t.Fatalf("removed worktree should no longer be an allowed root, got %d", code)
+	}
+	if history := c.result("fs.history", map[string]any{"session_id": a}); history["total"].(float64) != 0 {
+		t.Fatalf("journal entries under the removed worktree should be pruned: %+v", history)
+	}
+	c.errorCode("fs.undo", map[string]any{"session_id": a})
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("undo must not recreate the removed worktree: %v", err)
+	}
+}
+
+func TestWorktreesRequireConfiguredRoot(t *testing.T) {
+	tmp := t.TempDir()
+	c := newStdioClient(t, testConfig(tmp))
+	sessionID := c.openSession(tmp)
+	if code := c.errorCode("workspace.worktree.create", map[string]any{"session_id": sessionID}); code != -32007 {
+		t.Fatalf("expected unsupported capability, got %d", code)
+	}
+}
+
+func TestWorktreesRejectReadOnlyRepositories(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	tmp := t.TempDir()
+	repo := filepath.Join(tmp, "repo")
+	writeTree(t, repo, map[string]string{"README.md": "hello\n"})
+	gitRun(t, repo, "init", "-q", "-b", "main")
+	gitRun(t, repo, "add", ".")
+	gitRun(t, repo, "commit", "-q", "-m", "initial")
+
+	cfg := testConfig(repo)
+	cfg.Security.AllowedRoot = []config.AllowedRoot{{Path: repo, Mode: "ro"}}
+	cfg.Workspace.WorktreeRoot = filepath.Join(tmp, "scratch")
+	c := newStdioClient(t, cfg)
+	sessionID := c.openSession(repo)
+
+	resp := c.call("workspace.worktree.create", map[string]any{"session_id": sessionID, "name": "agent-a"})
+	if data := errorData(t, resp); data["reason"] != "read_only" {
+		t.Fatalf("expected read-only error, got %+v", resp["error"])
+	}
+	if _, err := os.Stat(filepath.Join(repo, ".git", "worktrees")); !os.IsNotExist(err) {
+		t.Fatalf("read-only repository must not gain worktree metadata: %v", err)
+	}
+}
+
+func TestWorktreesInheritRootDenyRules(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	tmp := t.TempDir()
+	repo := filepath.Join(tmp, "repo")
+	writeTree(t, repo, map[string]string{
+		"README.md":     "hello\n",
+		"secrets/token": "s3cret\n",
+		"certs/key.pem": "key\n",
+	})
+	gitRun(t, repo, "init", "-q", "-b", "main")
+	gitRun(t, repo, "add", ".")
+	gitRun(t, repo, "commit", "-q", "-m", "initial")
+
+	cfg := testConfig(tmp)
+	cfg.Security.AllowedRoot = []config.AllowedRoot{{Path: tmp, Deny: []string{"repo/secrets/*", "*.pem"}}}
+	cfg.Workspace.WorktreeRoot = filepath.Join(t.TempDir(), "scratch")
+	c := newStdioClient(t, cfg)
+	sessionID := c.openSession(repo)
+
+	res := c.result("workspace.worktree.create", map[string]any{"session_id": sessionID, "cwd": repo, "name": "agent-a"})
+	path := res["worktree"].(map[string]any)["path"].(string)
+	if got := c.result("fs.read", map[string]any{"session_id": sessionID, "path": "README.md"}); got["content"] != "hello\n" {
+		t.Fatalf("unexpected worktree read: %+v", got)
+	}
+	for _, rel := range []string{"secrets/token", "certs/key.pem"} {
+		resp := c.call("fs.read", map[string]any{"session_id": sessionID, "path": filepath.Join(path, rel)})
+		if data := errorData(t, resp); data["reason"] != "deny" {
+			t.Fatalf("expected %s to stay denied in the worktree, got %+v", rel, resp["error"])
+		}
+	}
+}